@@ -0,0 +1,159 @@
+//Package analysis parses a demo into an in-memory MatchResult, without touching the filesystem or the database.
+//Outputs are persisted by the sinks given in the options.
+package analysis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+	"github.com/mrdbarros/csgo_analyze/demo_source"
+	utils "github.com/mrdbarros/csgo_analyze/utils"
+)
+
+//ErrSkip is returned by Options.Prepare to stop the analysis before the demo is parsed
+var ErrSkip = errors.New("demo skipped")
+
+//Options of a single demo analysis
+type Options struct {
+	TickRate      float64 //forced tick rate, detected from the demo when 0
+	Pipeline      composite_handlers.PipelineConfig
+	Hash          string             //identifies the demo in the result, hashed by Hasher while it is parsed when empty
+	Hasher        demo_source.Hasher //full hash when nil
+	FileName      string
+	MatchDatetime time.Time
+	Sinks         []composite_handlers.MatchSink
+
+	//Prepare, if set, is called with the demo header before the demo is parsed.
+	//It returns sinks added to Sinks, or ErrSkip to stop without parsing the demo.
+	Prepare func(header common.DemoHeader) ([]composite_handlers.MatchSink, error)
+
+	//Classified, if set, is called once the start of the demo is classified, before any round is written.
+	//It returns sinks added to Sinks, or ErrSkip to stop parsing the demo.
+	Classified func(class Classification) ([]composite_handlers.MatchSink, error)
+}
+
+//Analyze parses the demo read from r and returns everything the pipeline generated.
+//Parsing stops when ctx is done. Returned errors are tagged with the stage where they happened.
+func Analyze(ctx context.Context, r io.Reader, opts Options) (result *composite_handlers.MatchResult, err error) {
+	stage := utils.StageHeader //stage reported if the parser panics
+	defer func() {
+		if r := recover(); r != nil {
+			err = utils.WithStage(stage, utils.RecoveredError(r))
+		}
+	}()
+
+	var hasher demo_source.Hasher
+	if opts.Hash == "" {
+		hasher = opts.Hasher
+		if hasher == nil {
+			hasher, _ = demo_source.NewHasher(demo_source.HashFull)
+		}
+		r = io.TeeReader(r, hasher)
+	}
+
+	p := dem.NewParser(r)
+	defer p.Close()
+
+	header, err := p.ParseHeader()
+	if err != nil {
+		return nil, utils.WithStage(utils.StageHeader, err)
+	}
+
+	sinks := opts.Sinks
+	if opts.Prepare != nil {
+		stage = utils.StageSetup
+		preparedSinks, err := opts.Prepare(header)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(append([]composite_handlers.MatchSink{}, sinks...), preparedSinks...)
+	}
+
+	stage = utils.StageSetup
+	var basicHandler composite_handlers.BasicHandler
+	err = basicHandler.Setup(&p, opts.TickRate, header, metadata.MapNameToMap[header.MapName], opts.MatchDatetime, opts.FileName)
+	if err != nil {
+		return nil, utils.WithStage(utils.StageSetup, err)
+	}
+	if opts.Pipeline.MatchFormat != nil {
+		basicHandler.SetMatchFormat(*opts.Pipeline.MatchFormat)
+	}
+	basicHandler.RegisterBasicEvents()
+	defer func() {
+		if closeErr := basicHandler.Close(); closeErr != nil && err == nil {
+			err = utils.WithStage(utils.StageOutput, closeErr)
+		}
+	}()
+
+	pipeline, err := composite_handlers.BuildPipeline(&basicHandler, opts.Pipeline)
+	if err != nil {
+		return nil, utils.WithStage(utils.StageSetup, err)
+	}
+
+	var infoHandler composite_handlers.InfoGenerationHandler
+	if err = basicHandler.Attach(&infoHandler); err != nil {
+		return nil, utils.WithStage(utils.StageSetup, err)
+	}
+	err = infoHandler.Setup(opts.Pipeline.UpdateInterval, opts.Hash, sinks,
+		&pipeline.IconGenerators, &pipeline.TabularGenerators, &pipeline.StatGenerators, &pipeline.PlayerStatCalculators)
+	if err != nil {
+		return nil, utils.WithStage(utils.StageSetup, err)
+	}
+	infoHandler.SetDerivedStatistics(pipeline.DerivedStatistics)
+
+	//checked between frames, the parser can only be cancelled from its own goroutine once
+	p.RegisterEventHandler(func(events.FrameDone) {
+		if ctx.Err() != nil {
+			basicHandler.SetError(utils.StageParse, ctx.Err())
+		}
+	})
+
+	stage = utils.StageParse
+	class, err := classify(p, header)
+	if err != nil {
+		return infoHandler.Result(), utils.WithStage(utils.StageParse, err)
+	}
+	if opts.Classified != nil {
+		stage = utils.StageSetup
+		classifiedSinks, err := opts.Classified(class)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(append([]composite_handlers.MatchSink{}, sinks...), classifiedSinks...)
+		infoHandler.AddSinks(classifiedSinks...)
+	}
+
+	stage = utils.StageParse
+	err = p.ParseToEnd()
+	result = infoHandler.Result()
+	result.Metadata.DemoType = class.DemoType
+	if basicHandler.Err() != nil {
+		return result, basicHandler.Err()
+	}
+	if err != nil {
+		return result, utils.WithStage(utils.StageParse, err)
+	}
+
+	if hasher != nil {
+		//the parser stops at the stop command, hash whatever follows it
+		if _, err = io.Copy(ioutil.Discard, r); err != nil {
+			return result, utils.WithStage(utils.StageHash, err)
+		}
+		result.Metadata.Hash = hasher.Sum()
+	}
+
+	for _, sink := range sinks {
+		if err = sink.WriteMatch(result); err != nil {
+			return result, utils.WithStage(utils.StageOutput, err)
+		}
+	}
+	return result, nil
+}
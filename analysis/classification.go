@@ -0,0 +1,77 @@
+package analysis
+
+import (
+	"strings"
+	"time"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+)
+
+const (
+	DemoTypeGOTV = "gotv" //recorded by the server, every player is seen
+	DemoTypePOV  = "pov"  //recorded by a player, from their own point of view
+)
+
+//classificationTime is the demo time parsed at most to classify a demo that does not announce its game rules
+//or its players.
+//No round can be played in it, nothing is written before the demo is classified.
+const classificationTime = 5 * time.Second
+
+//Classification is what the header and the first seconds of a demo tell about it
+type Classification struct {
+	GameMode composite_handlers.GameMode `json:"gameMode"`
+	DemoType string                      `json:"demoType"`
+}
+
+//Class names the classification: its demo type for POV demos, its game mode otherwise
+func (c Classification) Class() string {
+	if c.DemoType == DemoTypePOV {
+		return DemoTypePOV
+	}
+	return string(c.GameMode)
+}
+
+//demoType tells a POV demo by its client name, the name of the player who recorded it.
+//GOTV demos are named after the tv_name of the server, which can be anything, or after the GOTV bot.
+func demoType(header common.DemoHeader, players []*common.Player) string {
+	if strings.Contains(strings.ToLower(header.ClientName), "gotv") {
+		return DemoTypeGOTV
+	}
+	for _, player := range players {
+		if !player.IsBot && player.Name == header.ClientName {
+			return DemoTypePOV
+		}
+	}
+	return DemoTypeGOTV
+}
+
+func hasHumanPlayer(players []*common.Player) bool {
+	for _, player := range players {
+		if !player.IsBot {
+			return true
+		}
+	}
+	return false
+}
+
+//classify parses the start of the demo until its game mode and players are announced or classificationTime is reached
+func classify(p dem.Parser, header common.DemoHeader) (Classification, error) {
+	class := Classification{GameMode: composite_handlers.GameModeUnknown, DemoType: DemoTypeGOTV}
+	for {
+		class.GameMode = composite_handlers.GameModeFromConVars(p.GameState().ConVars())
+		players := p.GameState().Participants().All()
+		class.DemoType = demoType(header, players)
+		if (class.GameMode != composite_handlers.GameModeUnknown && hasHumanPlayer(players)) ||
+			p.CurrentTime() >= classificationTime {
+			return class, nil
+		}
+		more, err := p.ParseNextFrame()
+		if err != nil || !more {
+			class.GameMode = composite_handlers.GameModeFromConVars(p.GameState().ConVars())
+			class.DemoType = demoType(header, p.GameState().Participants().All())
+			return class, err
+		}
+	}
+}
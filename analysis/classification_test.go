@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+)
+
+func TestDemoType(t *testing.T) {
+	players := []*common.Player{{Name: "FACEIT TV", IsBot: true}, {Name: "player1"}, {Name: "player2"}}
+	cases := []struct {
+		clientName string
+		want       string
+	}{
+		{"GOTV Demo", DemoTypeGOTV},
+		{"FACEIT TV", DemoTypeGOTV}, //the tv bot of the server is not the recorder
+		{"ESEA", DemoTypeGOTV},
+		{"player2", DemoTypePOV},
+	}
+	for _, c := range cases {
+		if got := demoType(common.DemoHeader{ClientName: c.clientName}, players); got != c.want {
+			t.Errorf("demoType(%q) = %s, want %s", c.clientName, got, c.want)
+		}
+	}
+}
+
+//frame is the game state of the fake parser after each frame
+type frame struct {
+	conVars map[string]string
+	players []*common.Player
+}
+
+type fakeParser struct {
+	dem.Parser
+	frames  []frame
+	current int
+}
+
+func (p *fakeParser) GameState() dem.GameState {
+	return fakeGameState{frame: p.frames[p.current]}
+}
+
+func (p *fakeParser) CurrentTime() time.Duration {
+	return time.Duration(p.current) * time.Second
+}
+
+func (p *fakeParser) ParseNextFrame() (bool, error) {
+	if p.current < len(p.frames)-1 {
+		p.current++
+	}
+	return p.current < len(p.frames)-1, nil
+}
+
+type fakeGameState struct {
+	dem.GameState
+	frame frame
+}
+
+func (gs fakeGameState) ConVars() map[string]string {
+	return gs.frame.conVars
+}
+
+func (gs fakeGameState) Participants() dem.Participants {
+	return fakeParticipants{players: gs.frame.players}
+}
+
+type fakeParticipants struct {
+	dem.Participants
+	players []*common.Player
+}
+
+func (pa fakeParticipants) All() []*common.Player {
+	return pa.players
+}
+
+func TestClassify(t *testing.T) {
+	competitive := map[string]string{"game_type": "0", "game_mode": "1"}
+	players := []*common.Player{{Name: "ESEA", IsBot: true}, {Name: "recorder"}}
+	cases := []struct {
+		name       string
+		clientName string
+		frames     []frame
+		want       Classification
+		wantFrame  int
+	}{
+		{"players announced after the game mode", "recorder",
+			[]frame{{}, {conVars: competitive}, {conVars: competitive, players: players}, {}},
+			Classification{GameMode: composite_handlers.GameModeCompetitive, DemoType: DemoTypePOV}, 2},
+		{"custom tv name", "ESEA",
+			[]frame{{conVars: competitive, players: players}, {}},
+			Classification{GameMode: composite_handlers.GameModeCompetitive, DemoType: DemoTypeGOTV}, 0},
+		{"nothing announced", "recorder", make([]frame, 10),
+			Classification{GameMode: composite_handlers.GameModeUnknown, DemoType: DemoTypeGOTV},
+			int(classificationTime / time.Second)},
+	}
+	for _, c := range cases {
+		p := &fakeParser{frames: c.frames}
+		got, err := classify(p, common.DemoHeader{ClientName: c.clientName})
+		if err != nil || got != c.want || p.current != c.wantFrame {
+			t.Errorf("%s: got %+v at frame %d (%v), want %+v at frame %d", c.name, got, p.current, err, c.want,
+				c.wantFrame)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mrdbarros/csgo_analyze/analysis"
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+)
+
+//actions of a classification policy
+const (
+	classActionProcess = "process"
+	classActionSkip    = "skip"  //the demo is not parsed further, or its outputs are removed once parsed
+	classActionRoute   = "route" //processed with its outputs under a directory of the output named after the class
+)
+
+//classificationPolicy tells what to do with each class of demo.
+//Game mode and demo type are known from the start of the demo, warmup only and abandoned demos once parsed.
+type classificationPolicy struct {
+	GameModes  map[composite_handlers.GameMode]string `json:"gameModes"` //action per game mode, process when missing
+	POV        string                                 `json:"pov"`
+	WarmupOnly string                                 `json:"warmupOnly"` //no round was played, process or skip
+	Abandoned  string                                 `json:"abandoned"`  //the demo ends before the match does, process or skip
+}
+
+func defaultClassificationPolicy() classificationPolicy {
+	return classificationPolicy{
+		GameModes: map[composite_handlers.GameMode]string{composite_handlers.GameModeCasual: classActionSkip,
+			composite_handlers.GameModeOther: classActionSkip},
+		POV:        classActionSkip,
+		WarmupOnly: classActionSkip,
+		Abandoned:  classActionProcess,
+	}
+}
+
+//loadClassificationPolicy reads a json policy. Classes missing from the file keep their default action.
+func loadClassificationPolicy(path string) (classificationPolicy, error) {
+	policy := defaultClassificationPolicy()
+	f, err := os.Open(path)
+	if err != nil {
+		return policy, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&policy); err != nil {
+		return policy, fmt.Errorf("classification policy %s: %v", path, err)
+	}
+	if err = policy.validate(); err != nil {
+		return policy, fmt.Errorf("classification policy %s: %v", path, err)
+	}
+	return policy, nil
+}
+
+func (cp classificationPolicy) validate() error {
+	for mode, action := range cp.GameModes {
+		if err := checkClassAction("gameModes."+string(mode), action, true); err != nil {
+			return err
+		}
+	}
+	if err := checkClassAction("pov", cp.POV, true); err != nil {
+		return err
+	}
+	if err := checkClassAction("warmupOnly", cp.WarmupOnly, false); err != nil {
+		return err
+	}
+	return checkClassAction("abandoned", cp.Abandoned, false)
+}
+
+func checkClassAction(class string, action string, canRoute bool) error {
+	switch {
+	case action == classActionProcess || action == classActionSkip:
+		return nil
+	case action == classActionRoute && canRoute:
+		return nil
+	}
+	return fmt.Errorf("%s: unknown action %q", class, action)
+}
+
+//onStart returns the action for a demo classified from its start, and the reason when it is not processed as usual
+func (cp classificationPolicy) onStart(class analysis.Classification) (action string, reason string) {
+	if class.DemoType == analysis.DemoTypePOV && cp.POV != classActionProcess {
+		return cp.POV, "pov demo"
+	}
+	if action, ok := cp.GameModes[class.GameMode]; ok && action != classActionProcess {
+		return action, "game mode " + string(class.GameMode)
+	}
+	return classActionProcess, ""
+}
+
+//onEnd returns the action for a parsed demo, and the reason when its outputs are not kept
+func (cp classificationPolicy) onEnd(match *composite_handlers.MatchResult) (action string, reason string) {
+	if len(match.Rounds) == 0 && cp.WarmupOnly != classActionProcess {
+		return cp.WarmupOnly, "warmup only"
+	}
+	if len(match.Rounds) > 0 && !match.Finished && cp.Abandoned != classActionProcess {
+		return cp.Abandoned, fmt.Sprintf("abandoned after %d rounds", len(match.Rounds))
+	}
+	return classActionProcess, ""
+}
+
+//routedDestDir returns the output directory of a demo routed by its class
+func routedDestDir(destDir string, class analysis.Classification) string {
+	return filepath.Join(destDir, class.Class())
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mrdbarros/csgo_analyze/analysis"
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+)
+
+func TestClassificationPolicy(t *testing.T) {
+	policy, err := loadClassificationPolicy("configs/classification_policy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		class  analysis.Classification
+		action string
+	}{
+		{analysis.Classification{GameMode: composite_handlers.GameModeCompetitive, DemoType: analysis.DemoTypeGOTV}, classActionProcess},
+		{analysis.Classification{GameMode: composite_handlers.GameModeUnknown, DemoType: analysis.DemoTypeGOTV}, classActionProcess},
+		{analysis.Classification{GameMode: composite_handlers.GameModeCasual, DemoType: analysis.DemoTypeGOTV}, classActionSkip},
+		{analysis.Classification{GameMode: composite_handlers.GameModeWingman, DemoType: analysis.DemoTypeGOTV}, classActionRoute},
+		{analysis.Classification{GameMode: composite_handlers.GameModeCompetitive, DemoType: analysis.DemoTypePOV}, classActionRoute},
+	}
+	for _, c := range cases {
+		if action, reason := policy.onStart(c.class); action != c.action || (action != classActionProcess && reason == "") {
+			t.Errorf("%+v: got %q (%q), want %q", c.class, action, reason, c.action)
+		}
+	}
+	if dir := routedDestDir("out", cases[4].class); dir != "out/pov" {
+		t.Errorf("pov demos should be routed to out/pov, got %q", dir)
+	}
+
+	if action, reason := policy.onEnd(&composite_handlers.MatchResult{}); action != classActionSkip || reason != "warmup only" {
+		t.Errorf("warmup only demo: got %q (%q)", action, reason)
+	}
+	abandoned := &composite_handlers.MatchResult{Rounds: make([]composite_handlers.RoundResult, 7)}
+	if action, _ := policy.onEnd(abandoned); action != classActionProcess {
+		t.Errorf("abandoned demos should be kept by the policy, got %q", action)
+	}
+
+	policy.Abandoned = classActionRoute
+	if policy.validate() == nil {
+		t.Error("demos only known once parsed can not be routed")
+	}
+}
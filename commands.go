@@ -0,0 +1,596 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+	"github.com/mrdbarros/csgo_analyze/database"
+	"github.com/mrdbarros/csgo_analyze/demo_source"
+	"github.com/mrdbarros/csgo_analyze/journal"
+	"github.com/mrdbarros/csgo_analyze/service"
+	utils "github.com/mrdbarros/csgo_analyze/utils"
+)
+
+//command is a single subcommand of the cli
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+func allCommands() []command {
+	return []command{
+		{name: "process", description: "process a single demo file", run: runProcess},
+		{name: "batch", description: "process every demo found under a directory", run: runBatch},
+		{name: "watch", description: "process the demos added to directories as they are written", run: runWatch},
+		{name: "reprocess", description: "process a demo file or directory again, overwriting previous results", run: runReprocess},
+		{name: "status", description: "show the state of the demos recorded in a batch journal", run: runStatus},
+		{name: "validate", description: "check that demo files can be parsed without processing them", run: runValidate},
+		{name: "serve", description: "serve the statistics service over http", run: runServe},
+		{name: "handlers", description: "list the handler names usable in pipeline configs", run: runHandlers},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	for _, cmd := range allCommands() {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun '%s <command> -h' for the flags of a command\n", filepath.Base(os.Args[0]))
+}
+
+func runCommand(args []string) error {
+	if len(args) == 0 {
+		usage()
+		return errors.New("no command given")
+	}
+	for _, cmd := range allCommands() {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	if args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage()
+		return nil
+	}
+	usage()
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+//interruptContext returns a context cancelled on the first SIGINT or SIGTERM, a second signal kills the process
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Println("Received", sig, "- stopping, send it again to kill")
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+//processFlags holds the flags shared by every command that processes demos
+type processFlags struct {
+	configPath     string
+	policyPath     string
+	tradeInterval  float64
+	updateInterval float64
+	imgSize        int
+	generateIcons  bool
+	progressMode   string
+	eventsPath     string
+	eventsFile     *os.File
+}
+
+//progress modes
+const (
+	progressJSON = "json" //json lines on stderr, or in the -events file
+	progressTerm = "term" //a single terminal line on stderr, json lines only in the -events file
+	progressNone = "none"
+)
+
+//addProcessFlags registers the flags shared by every command that processes demos
+func addProcessFlags(fs *flag.FlagSet, opts *ProcessOptions) *processFlags {
+	pf := new(processFlags)
+	defaults := composite_handlers.DefaultPipelineConfig()
+	fs.StringVar(&opts.DestDir, "out", "", "output directory for processed matches (required)")
+	fs.Float64Var(&opts.TickRate, "tickrate", 0, "tick rate forced on every demo, detected from each demo when 0")
+	fs.StringVar(&pf.configPath, "config", "", "json pipeline config listing the handlers to run (default: all statistics, no icons)")
+	fs.StringVar(&pf.policyPath, "policy", "", "json classification policy telling which demos to process, skip or route by game mode, "+
+		"demo type and completeness (default: skip casual, other modes, pov and warmup only demos)")
+	fs.IntVar(&pf.imgSize, "imgsize", defaults.ImgSize, "width in pixels of the generated map images, overrides the config")
+	fs.Float64Var(&pf.updateInterval, "interval", defaults.UpdateInterval, "seconds between periodic data frames, overrides the config")
+	fs.Float64Var(&pf.tradeInterval, "tradewindow", defaults.TradeInterval, "max seconds between two kills for them to count as a trade, overrides the config")
+	fs.StringVar(&opts.HashMode, "hash", demo_source.HashFull, "how the demo hash identifying processed matches is computed: "+
+		demo_source.HashFull+" hashes the whole demo while it is parsed, "+demo_source.HashFingerprint+" samples a few blocks of the demo. "+
+		"Fingerprints differ from the hashes of the demos already processed with "+demo_source.HashFull+", which are then processed again")
+	fs.DurationVar(&opts.Timeout, "timeout", 0, "maximum time spent on a single demo, e.g. 10m (default unlimited)")
+	fs.BoolVar(&pf.generateIcons, "icons", false, "generate map images with player and utility icons, overrides the config")
+	fs.StringVar(&pf.progressMode, "progress", progressJSON, "progress output: "+progressJSON+" events, a "+progressTerm+" status line or "+progressNone)
+	fs.StringVar(&pf.eventsPath, "events", "", "file the json progress events are appended to (default stderr in "+progressJSON+" mode)")
+	return pf
+}
+
+//resolve builds the pipeline config from the config file and the explicitly set flags
+func (pf *processFlags) resolve(fs *flag.FlagSet, opts *ProcessOptions) error {
+	var err error
+	opts.Pipeline = composite_handlers.DefaultPipelineConfig()
+	if pf.configPath != "" {
+		opts.Pipeline, err = composite_handlers.LoadPipelineConfig(pf.configPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts.Policy = defaultClassificationPolicy()
+	if pf.policyPath != "" {
+		opts.Policy, err = loadClassificationPolicy(pf.policyPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.HashMode != demo_source.HashFingerprint && opts.HashMode != demo_source.HashFull {
+		return fmt.Errorf("unknown hash mode %q", opts.HashMode)
+	}
+	if opts.Progress, err = pf.progressReporter(); err != nil {
+		return err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "imgsize":
+			opts.Pipeline.ImgSize = pf.imgSize
+		case "interval":
+			opts.Pipeline.UpdateInterval = pf.updateInterval
+		case "tradewindow":
+			opts.Pipeline.TradeInterval = pf.tradeInterval
+		case "icons":
+			if !pf.generateIcons {
+				opts.Pipeline.IconGenerators = nil
+			} else if len(opts.Pipeline.IconGenerators) == 0 {
+				opts.Pipeline.IconGenerators = composite_handlers.DefaultIconGenerators
+			}
+		}
+	})
+	return opts.Pipeline.Validate()
+}
+
+func (pf *processFlags) progressReporter() (*progressReporter, error) {
+	var events, view io.Writer
+	switch pf.progressMode {
+	case progressJSON:
+		events = os.Stderr
+	case progressTerm:
+		view = os.Stderr
+	case progressNone:
+	default:
+		return nil, fmt.Errorf("unknown progress mode %q", pf.progressMode)
+	}
+	if pf.eventsPath != "" {
+		var err error
+		pf.eventsFile, err = os.OpenFile(pf.eventsPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		events = pf.eventsFile
+	}
+	return newProgressReporter(events, view), nil
+}
+
+//close releases the files opened by resolve
+func (pf *processFlags) close() {
+	if pf.eventsFile != nil {
+		pf.eventsFile.Close()
+	}
+}
+
+func requireFlag(fs *flag.FlagSet, name string, value string) error {
+	if value == "" {
+		fs.Usage()
+		return fmt.Errorf("%s: flag -%s is required", fs.Name(), name)
+	}
+	return nil
+}
+
+func runProcess(args []string) error {
+	var opts ProcessOptions
+	var demPath string
+	fs := flag.NewFlagSet("process", flag.ExitOnError)
+	fs.StringVar(&demPath, "in", "", "demo file, compressed demo or zip archive of demos to process (required)")
+	pf := addProcessFlags(fs, &opts)
+	fs.Parse(args)
+	if err := requireFlag(fs, "in", demPath); err != nil {
+		return err
+	}
+	if err := requireFlag(fs, "out", opts.DestDir); err != nil {
+		return err
+	}
+	if err := pf.resolve(fs, &opts); err != nil {
+		return err
+	}
+	defer pf.close()
+
+	opts.SkipProcessed = true
+	ctx, stop := interruptContext()
+	defer stop()
+	return processDemos(ctx, demPath, opts)
+}
+
+//processDemos processes every demo stored in the file at demPath, stopping at the first failure
+func processDemos(ctx context.Context, demPath string, opts ProcessOptions) error {
+	demos, err := demo_source.List(demPath)
+	if err != nil {
+		return err
+	}
+	if len(demos) == 0 {
+		return fmt.Errorf("no demo found in %s", demPath)
+	}
+	for fileID, demo := range demos {
+		opts.Progress.DemoStarted(demo.ID(), demo.Name(), demo.Size)
+		result, err := ProcessDemo(ctx, demo, fileID, opts)
+		opts.Progress.DemoFinished(demo.ID(), newDemoReport(demo.ID(), result, err))
+		if err != nil {
+			return fmt.Errorf("%s: %w", demo.ID(), err)
+		}
+	}
+	return nil
+}
+
+func runBatch(args []string) error {
+	var opts ProcessOptions
+	var demDir string
+	var workerCount int
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	fs.StringVar(&demDir, "in", "", "directory walked for demo files (required)")
+	var settings batchSettings
+	fs.IntVar(&workerCount, "workers", 7, "number of demos processed in parallel")
+	fs.StringVar(&settings.reportPath, "report", "", "json lines report of every demo processed (default <out>/batch_report.jsonl)")
+	fs.StringVar(&settings.journalPath, "journal", "", "job journal used to resume interrupted batches (default <out>/batch_journal.jsonl)")
+	fs.IntVar(&settings.retries, "retries", 1, "number of times a failed demo is retried, within and across batches. Timed out demos are only retried by later batches")
+	pf := addProcessFlags(fs, &opts)
+	fs.Parse(args)
+	if err := requireFlag(fs, "in", demDir); err != nil {
+		return err
+	}
+	if err := requireFlag(fs, "out", opts.DestDir); err != nil {
+		return err
+	}
+	if err := pf.resolve(fs, &opts); err != nil {
+		return err
+	}
+	defer pf.close()
+
+	opts.SkipProcessed = true
+	settings.useJournal = true
+	ctx, stop := interruptContext()
+	defer stop()
+	return processBatch(ctx, demDir, workerCount, opts, settings)
+}
+
+//batchSettings holds the flags of commands processing directories
+type batchSettings struct {
+	reportPath  string
+	journalPath string
+	useJournal  bool
+	retries     int
+}
+
+func defaultJournalPath(destDir string) string {
+	return filepath.Join(destDir, "batch_journal.jsonl")
+}
+
+//processBatch processes a directory of demos, writing the outcome of each demo to the batch report
+//Demos being processed when ctx is done are reported as interrupted and left queued in the journal.
+func processBatch(ctx context.Context, demDir string, workerCount int, opts ProcessOptions, settings batchSettings) error {
+	run, err := openBatchRun(ctx, opts, &settings)
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	err = run.processDir(demDir, workerCount)
+	if ctx.Err() != nil {
+		return fmt.Errorf("batch interrupted, run it again to resume: %w", ctx.Err())
+	}
+	if err != nil {
+		return err
+	}
+	if run.report.FailedCount() > 0 {
+		return fmt.Errorf("%d demo(s) failed, see %s", run.report.FailedCount(), settings.reportPath)
+	}
+	return nil
+}
+
+//openBatchRun opens the report and, if used, the journal of a batch, filling in their default paths in settings
+func openBatchRun(ctx context.Context, opts ProcessOptions, settings *batchSettings) (*batchRun, error) {
+	if err := os.MkdirAll(opts.DestDir, 0700); err != nil {
+		return nil, err
+	}
+	if settings.reportPath == "" {
+		settings.reportPath = filepath.Join(opts.DestDir, "batch_report.jsonl")
+	}
+	report, err := openReportWriter(settings.reportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &batchRun{ctx: ctx, opts: opts, report: report, maxAttempts: settings.retries + 1}
+	if settings.useJournal {
+		if settings.journalPath == "" {
+			settings.journalPath = defaultJournalPath(opts.DestDir)
+		}
+		run.journal, err = journal.Open(settings.journalPath)
+		if err != nil {
+			report.Close()
+			return nil, err
+		}
+		for _, msg := range run.journal.Ignored() {
+			opts.Progress.Warning("", msg)
+		}
+	}
+	return run, nil
+}
+
+func runWatch(args []string) error {
+	var opts ProcessOptions
+	var dirList string
+	var workerCount int
+	var pollInterval, settleTime time.Duration
+	var addr string
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	fs.StringVar(&dirList, "in", "", "comma separated directories watched for demo files (required)")
+	var settings batchSettings
+	fs.IntVar(&workerCount, "workers", 7, "number of demos processed in parallel")
+	fs.DurationVar(&pollInterval, "poll", 10*time.Second, "time between two scans of the directories")
+	fs.DurationVar(&settleTime, "settle", 30*time.Second, "time the size of a file must stay the same before it is processed")
+	fs.StringVar(&addr, "addr", "", "http address serving the queue state as json, e.g. :8081 (default disabled)")
+	fs.StringVar(&settings.reportPath, "report", "", "json lines report of every demo processed (default <out>/batch_report.jsonl)")
+	fs.StringVar(&settings.journalPath, "journal", "", "job journal holding the queue between restarts (default <out>/batch_journal.jsonl)")
+	fs.IntVar(&settings.retries, "retries", 1, "number of times a failed demo is retried, timed out demos are not retried")
+	pf := addProcessFlags(fs, &opts)
+	fs.Parse(args)
+	if err := requireFlag(fs, "in", dirList); err != nil {
+		return err
+	}
+	if err := requireFlag(fs, "out", opts.DestDir); err != nil {
+		return err
+	}
+	if pollInterval <= 0 {
+		return errors.New("watch: -poll must be positive")
+	}
+	if err := pf.resolve(fs, &opts); err != nil {
+		return err
+	}
+	defer pf.close()
+
+	opts.SkipProcessed = true
+	opts.SkipKnown = true
+	settings.useJournal = true
+	ctx, stop := interruptContext()
+	defer stop()
+	run, err := openBatchRun(ctx, opts, &settings)
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	var dirs []string
+	for _, dir := range strings.Split(dirList, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	w := newWatcher(run, dirs, settleTime)
+	if addr != "" {
+		server := &http.Server{Addr: addr, Handler: w}
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				opts.Progress.Warning("", "watch: queue state server stopped: "+err.Error())
+			}
+		}()
+		defer server.Close()
+	}
+
+	fmt.Fprintln(os.Stderr, "Watching", strings.Join(dirs, ", "))
+	w.watch(ctx, workerCount, pollInterval)
+	fmt.Fprintln(os.Stderr, "Watch stopped, queued demos are processed on the next start")
+	return nil
+}
+
+func runReprocess(args []string) error {
+	var opts ProcessOptions
+	var demPath string
+	var workerCount int
+	fs := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	fs.StringVar(&demPath, "in", "", "demo file or directory to process again (required)")
+	var settings batchSettings
+	fs.IntVar(&workerCount, "workers", 7, "number of demos processed in parallel when -in is a directory")
+	fs.StringVar(&settings.reportPath, "report", "", "json lines report of every demo processed when -in is a directory (default <out>/batch_report.jsonl)")
+	pf := addProcessFlags(fs, &opts)
+	fs.Parse(args)
+	if err := requireFlag(fs, "in", demPath); err != nil {
+		return err
+	}
+	if err := requireFlag(fs, "out", opts.DestDir); err != nil {
+		return err
+	}
+	if err := pf.resolve(fs, &opts); err != nil {
+		return err
+	}
+	defer pf.close()
+
+	opts.SkipProcessed = false
+	info, err := os.Stat(demPath)
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	if info.IsDir() {
+		return processBatch(ctx, demPath, workerCount, opts, settings)
+	}
+	return processDemos(ctx, demPath, opts)
+}
+
+func runStatus(args []string) error {
+	var destDir string
+	var journalPath string
+	var verbose bool
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	fs.StringVar(&destDir, "out", "", "output directory of the batch, used to find its journal")
+	fs.StringVar(&journalPath, "journal", "", "job journal to inspect (default <out>/batch_journal.jsonl)")
+	fs.BoolVar(&verbose, "v", false, "list every demo instead of only the failed ones")
+	fs.Parse(args)
+	if journalPath == "" {
+		if err := requireFlag(fs, "out", destDir); err != nil {
+			return err
+		}
+		journalPath = defaultJournalPath(destDir)
+	}
+	if exists, _ := utils.Exists(journalPath); !exists {
+		return fmt.Errorf("no journal at %s", journalPath)
+	}
+
+	jobJournal, err := journal.Load(journalPath)
+	if err != nil {
+		return err
+	}
+	for _, msg := range jobJournal.Ignored() {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+	counts := jobJournal.Counts()
+	for _, status := range []journal.Status{journal.StatusQueued, journal.StatusRunning, journal.StatusDone,
+		journal.StatusSkipped, journal.StatusFailed, journal.StatusTimedOut} {
+		fmt.Printf("%-8s %d\n", status, counts[status])
+	}
+	for _, entry := range jobJournal.Entries() {
+		if entry.IsFailed() {
+			fmt.Printf("%-8s %s (attempts: %d, stage: %s): %s\n", entry.Status, entry.Path, entry.Attempts, entry.Stage, entry.Error)
+		} else if verbose {
+			fmt.Printf("%-8s %s %s\n", entry.Status, entry.Path, entry.Hash)
+		}
+	}
+	return nil
+}
+
+func runValidate(args []string) error {
+	var demPath string
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.StringVar(&demPath, "in", "", "demo file or directory to validate (required)")
+	fs.Parse(args)
+	if err := requireFlag(fs, "in", demPath); err != nil {
+		return err
+	}
+
+	invalidCount := 0
+	err := filepath.Walk(demPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		demos, err := demo_source.List(path)
+		if err != nil {
+			fmt.Printf("INVALID %s: %v\n", path, err)
+			invalidCount++
+			return nil
+		}
+		for _, demo := range demos {
+			mapName, err := validateDemo(demo)
+			if err != nil {
+				fmt.Printf("INVALID %s: %v\n", demo.ID(), err)
+				invalidCount++
+			} else {
+				fmt.Printf("OK      %s (%s)\n", demo.ID(), mapName)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if invalidCount > 0 {
+		return fmt.Errorf("%d invalid demo file(s)", invalidCount)
+	}
+	return nil
+}
+
+//validateDemo parses the header of a demo and returns its map name
+func validateDemo(demo demo_source.Demo) (mapName string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = utils.RecoveredError(r)
+		}
+	}()
+	f, err := demo.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	p := dem.NewParser(f)
+	defer p.Close()
+	header, err := p.ParseHeader()
+	if err != nil {
+		return "", err
+	}
+	if header.MapName == "" {
+		return "", errors.New("demo header has no map name")
+	}
+	return header.MapName, nil
+}
+
+func runServe(args []string) error {
+	var addr string
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&addr, "addr", ":8080", "http listen address")
+	fs.Parse(args)
+
+	logger := kitlog.NewLogfmtLogger(os.Stderr)
+	logger = kitlog.With(logger, "service", "statistics", "ts", kitlog.DefaultTimestampUTC)
+
+	dbConn, err := database.OpenDBConn()
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	ctx := context.Background()
+	srv := service.NewService(service.NewRepo(dbConn, logger), logger)
+	handler := service.NewHTTPServer(ctx, service.MakeEndpoints(srv))
+
+	logger.Log("msg", "listening", "addr", addr)
+	return http.ListenAndServe(addr, handler)
+}
+
+func runHandlers(args []string) error {
+	fs := flag.NewFlagSet("handlers", flag.ExitOnError)
+	fs.Parse(args)
+	for _, name := range composite_handlers.RegisteredHandlerNames() {
+		fmt.Println(name)
+	}
+	return nil
+}
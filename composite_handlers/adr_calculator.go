@@ -6,13 +6,20 @@ type ADRCalculator struct {
 	statisticHolder
 }
 
+const statTotalDamage = "total_damage"
+
+var adrStatistics = RegisterStatistics(sideSum(statTotalDamage, "Total Damage Done", UnitHP,
+	"health damage done to enemies, minus the damage done to teammates"))
+
 func (kc *ADRCalculator) Register(bh *BasicHandler) error {
-	kc.basicHandler = bh
-	bh.RegisterPlayerHurtSubscriber(interface{}(kc).(PlayerHurtSubscriber))
-	bh.RegisterRoundFreezetimeEndSubscriber(interface{}(kc).(RoundFreezetimeEndSubscriber))
-	kc.baseStatsHeaders = []string{"Total Damage Done", "Total Damage Done_T", "Total Damage Done_CT"}
-	kc.defaultValues = make(map[string]float64)
-	return nil
+	err := kc.setupStatistics(bh, adrStatistics...)
+	if err != nil {
+		return err
+	}
+	kc.subscriptions, err = bh.SubscribeAll(
+		Subscription{kc.PlayerHurtHandler, GateRound},
+		Subscription{kc.RoundFreezetimeEndHandler, GateAlways})
+	return err
 }
 
 func (kc *ADRCalculator) RoundFreezetimeEndHandler(e events.RoundFreezetimeEnd) {
@@ -31,7 +38,7 @@ func (kc *ADRCalculator) PlayerHurtHandler(e events.PlayerHurt) {
 		} else {
 			addAmmount = -float64(e.HealthDamageTaken)
 		}
-		kc.addToPlayerStat(e.Attacker, addAmmount, "Total Damage Done")
+		kc.addToPlayerStat(e.Attacker, addAmmount, statTotalDamage)
 	}
 
 }
@@ -1,16 +1,16 @@
 package composite_handlers
 
 import (
-	"fmt"
+	"reflect"
 	"strconv"
 	"time"
 
-	dp "github.com/markus-wa/godispatch"
-
 	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
 	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
 	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/msg"
+	dp "github.com/markus-wa/godispatch"
 	utils "github.com/mrdbarros/csgo_analyze/utils"
 )
 
@@ -23,78 +23,32 @@ type playerMapping struct {
 //basic shared handler for parsing
 type BasicHandler struct {
 	parser      *dem.Parser
-	tickRate    int
 	mapMetadata metadata.Map
-	statisticHolder
-
-	roundStartHandlerID   dp.HandlerIdentifier
-	roundStartSubscribers []RoundStartSubscriber
-
-	roundEndHandlerID   dp.HandlerIdentifier
-	roundEndSubscribers []RoundEndSubscriber
-
-	grenadeEventIfHandlerID   dp.HandlerIdentifier
-	grenadeEventIfSubscribers []GrenadeEventIfSubscriber
-
-	roundFreezeTimeEndHandlerID   dp.HandlerIdentifier
-	roundFreezeTimeEndSubscribers []RoundFreezetimeEndSubscriber
-
-	bombPlantedHandlerID   dp.HandlerIdentifier
-	bombPlantedSubscribers []BombPlantedSubscriber
-
-	frameDoneHandlerID   dp.HandlerIdentifier
-	frameDoneSubscribers []FrameDoneSubscriber
-
-	roundEndOfficialHandlerID   dp.HandlerIdentifier
-	roundEndOfficialSubscribers []RoundEndOfficialSubscriber
-
-	bombDroppedHandlerID   dp.HandlerIdentifier
-	bombDroppedSubscribers []BombDroppedSubscriber
-
-	bombDefusedHandlerID   dp.HandlerIdentifier
-	bombDefusedSubscribers []BombDefusedSubscriber
-
-	flashExplodeHandlerID   dp.HandlerIdentifier
-	flashExplodeSubscribers []FlashExplodeSubscriber
-
-	bombPickupHandlerID   dp.HandlerIdentifier
-	bombPickupSubscribers []BombPickupSubscriber
-
-	footstepHandlerID   dp.HandlerIdentifier
-	footstepSubscribers []FootstepSubscriber
-
-	scoreUpdatedHandlerID   dp.HandlerIdentifier
-	scoreUpdatedSubscribers []ScoreUpdatedSubscriber
-
-	heExplodeHandlerID   dp.HandlerIdentifier
-	heExplodeSubscribers []HeExplodeSubscriber
-
-	itemDropHandlerID   dp.HandlerIdentifier
-	itemDropSubscribers []ItemDropSubscriber
-
-	itemPickupHandlerID   dp.HandlerIdentifier
-	itemPickupSubscribers []ItemPickupSubscriber
-
-	killHandlerID   dp.HandlerIdentifier
-	killSubscribers []KillSubscriber
 
-	playerFlashedHandlerID   dp.HandlerIdentifier
-	playerFlashedSubscribers []PlayerFlashedSubscriber
-
-	playerHurtHandlerID   dp.HandlerIdentifier
-	playerHurtSubscribers []PlayerHurtSubscriber
-
-	weaponReloadHandlerID   dp.HandlerIdentifier
-	weaponReloadSubscribers []WeaponReloadSubscriber
-
-	isWarmupPeriodChangedHandlerID   dp.HandlerIdentifier
-	isWarmupPeriodChangedSubscribers []IsWarmupPeriodChangedSubscriber
+	tickRate               float64 //tick rate used for timings, the override if set
+	tickRateSource         string
+	detectedTickRate       float64 //tick rate found in the demo, regardless of the override
+	detectedTickRateSource string
+	matchFormat            MatchFormat
+	matchFormatSource      string
+	gameMode               GameMode
+	teamSize               int //players of each side, set when the match starts
+	teams                  teamTracker
+	roster                 rosterTracker
+	statisticHolder
 
-	playerTeamChangeHandlerID   dp.HandlerIdentifier
-	playerTeamChangeSubscribers []PlayerTeamChangeSubscriber
+	subscriptions       map[reflect.Type][]subscription //keyed by the event type taken by the handlers
+	lastSubscriptionID  SubscriptionID
+	parserHandlers      map[reflect.Type]*parserHandler //keyed by the event type the parser sends to the basic handler
+	serverInfoHandlerID dp.HandlerIdentifier
+	attachedHandlers    []CompositeEventHandler
 
-	playerDisconnectedHandlerID   dp.HandlerIdentifier
-	playerDisconnectedSubscribers []PlayerDisconnectedSubscriber
+	state          RoundState
+	roundEndReason events.RoundEndReason //reason of the last round end event of the current round
+	roundEndWon    bool                  //the last round end event of the current round had a winner
+	finalizedRound int                   //number of the last round finalized, rounds from it back are rolled back
+	scoreAwaited   bool                  //the last round finalized was won but the score did not count it yet
+	staleStart     bool                  //the round start is put off until the score counts the last round finalized
 
 	roundStartTime          float64
 	currentTime             float64
@@ -115,7 +69,24 @@ type BasicHandler struct {
 	roundProcessed          bool
 	scoreUpdated            bool
 	playerMappings          []map[uint64]playerMapping
+	roundStartTicks         []int //ingame tick of the start of each round, as playerMappings
+	rollbacks               []Rollback
 	matchDatetime           time.Time
+	err                     error
+}
+
+//SetError records the first error raised by a composite handler and stops parsing
+func (bh *BasicHandler) SetError(stage string, err error) {
+	if err == nil || bh.err != nil {
+		return
+	}
+	bh.err = utils.WithStage(stage, err)
+	(*bh.parser).Cancel()
+}
+
+//Err returns the error that stopped parsing, if any
+func (bh *BasicHandler) Err() error {
+	return bh.err
 }
 
 func (bh *BasicHandler) Register(basicHand *BasicHandler) error {
@@ -129,29 +100,110 @@ func (bh *BasicHandler) Update() {
 
 func (bh *BasicHandler) RegisterBasicEvents() error {
 	parser := *(bh.parser)
-	bh.roundStartHandlerID = parser.RegisterEventHandler(bh.RoundStartHandler)
-	bh.roundEndHandlerID = parser.RegisterEventHandler(bh.RoundEndHandler)
-	bh.roundFreezeTimeEndHandlerID = parser.RegisterEventHandler(bh.RoundFreezetimeEndHandler)
-	bh.playerDisconnectedHandlerID = parser.RegisterEventHandler(bh.PlayerDisconnectedHandler)
-	bh.scoreUpdatedHandlerID = parser.RegisterEventHandler(bh.ScoreUpdatedHandler)
-	bh.footstepHandlerID = parser.RegisterEventHandler(bh.FootstepHandler)
+	for _, eventType := range []reflect.Type{reflect.TypeOf(events.RoundStart{}), reflect.TypeOf(events.RoundEnd{}),
+		reflect.TypeOf(events.RoundFreezetimeEnd{}), reflect.TypeOf(events.RoundEndOfficial{}),
+		reflect.TypeOf(events.PlayerDisconnected{}), reflect.TypeOf(events.ScoreUpdated{}),
+		reflect.TypeOf(events.Footstep{})} {
+		bh.registerParserHandler(eventType, true)
+	}
+	bh.serverInfoHandlerID = parser.RegisterNetMessageHandler(bh.ServerInfoHandler)
+	return nil
+}
+
+//Unregister removes every subscription and every handler the basic handler registered on the parser
+func (bh *BasicHandler) Unregister() error {
+	parser := *(bh.parser)
+	for _, handler := range bh.parserHandlers {
+		parser.UnregisterEventHandler(handler.id)
+	}
+	if bh.serverInfoHandlerID != nil {
+		parser.UnregisterNetMessageHandler(bh.serverInfoHandlerID)
+		bh.serverInfoHandlerID = nil
+	}
+	bh.subscriptions, bh.parserHandlers = nil, nil
 	return nil
 }
 
-func (bh *BasicHandler) Setup(parser *dem.Parser, tickRate int, mapMetadata metadata.Map, matchDateTime time.Time, fileName string) error {
+const statRounds = "rounds"
+
+var basicStatistics = RegisterStatistics(sideSum(statRounds, "Rounds", UnitRounds, "rounds played from their freezetime end"))
+
+//Setup prepares the handler for a demo. A tickRateOverride of 0 uses the tick rate detected from the demo.
+func (bh *BasicHandler) Setup(parser *dem.Parser, tickRateOverride float64, header common.DemoHeader, mapMetadata metadata.Map,
+	matchDateTime time.Time, fileName string) error {
 	bh.parser = parser
-	bh.tickRate = tickRate
+	bh.detectedTickRate, bh.detectedTickRateSource = utils.HeaderTickRate(header)
+	bh.tickRate, bh.tickRateSource = bh.detectedTickRate, bh.detectedTickRateSource
+	if tickRateOverride > 0 {
+		bh.tickRate, bh.tickRateSource = tickRateOverride, utils.TickRateOverride
+	}
 	bh.mapMetadata = mapMetadata
-	bh.statisticHolder.baseStatsHeaders = []string{"Rounds", "Rounds_T", "Rounds_CT"}
-	bh.basicHandler = bh
+	bh.matchFormat, bh.matchFormatSource = DefaultMatchFormat(), MatchFormatDefault
+	bh.gameMode = GameModeUnknown
+	if err := bh.statisticHolder.setupStatistics(bh, basicStatistics...); err != nil {
+		return err
+	}
 	bh.matchDatetime = matchDateTime
 	bh.fileName = fileName
 
 	return nil
 }
 
+//ServerInfoHandler replaces the tick rate estimated from the header with the one the server announces
+func (bh *BasicHandler) ServerInfoHandler(m *msg.CSVCMsg_ServerInfo) {
+	tickRate := utils.TickRateFromInterval(m.TickInterval)
+	if tickRate <= 0 {
+		return
+	}
+	bh.detectedTickRate, bh.detectedTickRateSource = tickRate, utils.TickRateServerInfo
+	if bh.tickRateSource != utils.TickRateOverride {
+		bh.tickRate, bh.tickRateSource = tickRate, utils.TickRateServerInfo
+	}
+}
+
+//TickRate returns the tick rate used for timings and where it came from
+func (bh *BasicHandler) TickRate() (float64, string) {
+	return bh.tickRate, bh.tickRateSource
+}
+
+//DetectedTickRate returns the tick rate found in the demo and where it came from, ignoring any override
+func (bh *BasicHandler) DetectedTickRate() (float64, string) {
+	return bh.detectedTickRate, bh.detectedTickRateSource
+}
+
+//SetMatchFormat replaces the format detected from the demo, it must be called after Setup
+func (bh *BasicHandler) SetMatchFormat(format MatchFormat) {
+	bh.matchFormat, bh.matchFormatSource = format, MatchFormatConfig
+}
+
+//MatchFormat returns the format of the match and where it came from
+func (bh *BasicHandler) MatchFormat() (MatchFormat, string) {
+	return bh.matchFormat, bh.matchFormatSource
+}
+
+//updateMatchFormat reads the format from the game rules, unless it was set in the config
+func (bh *BasicHandler) updateMatchFormat(gs dem.GameState) {
+	if bh.matchFormatSource == MatchFormatConfig {
+		return
+	}
+	fallback := bh.gameMode.DefaultMatchFormat()
+	if format, ok := MatchFormatFromConVars(gs.ConVars(), fallback); ok {
+		bh.matchFormat, bh.matchFormatSource = format, MatchFormatConVars
+	} else {
+		bh.matchFormat, bh.matchFormatSource = fallback, MatchFormatDefault
+	}
+}
+
+//timingTickRate returns the tick rate given to utils.GetCurrentTime, 0 when the parser times ticks from the server info
+func (bh *BasicHandler) timingTickRate() float64 {
+	if bh.tickRateSource == utils.TickRateServerInfo {
+		return 0
+	}
+	return bh.tickRate
+}
+
 func (bh *BasicHandler) UpdateTime() {
-	bh.currentTime = utils.GetCurrentTime(*(bh.parser), bh.tickRate)
+	bh.currentTime = utils.GetCurrentTime(*(bh.parser), bh.timingTickRate())
 }
 
 func (bh *BasicHandler) GetPeriodicTabularData() ([]string, []float64, error) {
@@ -165,16 +217,6 @@ func (bh *BasicHandler) GetPeriodicTabularData() ([]string, []float64, error) {
 
 }
 
-func (bh *BasicHandler) RegisterRoundStartSubscriber(rs RoundStartSubscriber) {
-	parser := *(bh.parser)
-	if bh.roundStartHandlerID == nil {
-		bh.roundStartHandlerID = parser.RegisterEventHandler(bh.RoundStartHandler)
-	}
-
-	bh.roundStartSubscribers = append(bh.roundStartSubscribers, rs)
-
-}
-
 //this a workaround for demos that update score after round start event (wtf)
 func (bh *BasicHandler) createPreRoundStartInfo() {
 
@@ -182,30 +224,45 @@ func (bh *BasicHandler) createPreRoundStartInfo() {
 	bh.scoreUpdated = false
 	gs := parser.GameState()
 	bh.roundStructureCreated = false
-	currentMappings := currentPlayerMappings(parser.GameState())
+	sides := sidePlayers(gs)
 
 	bh.roundNumber = gs.TeamCounterTerrorists().Score() + gs.TeamTerrorists().Score() + 1
-	if len(currentMappings) > 0 && !bh.isMatchEnded && !gs.IsWarmupPeriod() && bh.roundNumber-1 <= len(bh.playerMappings) {
+	if len(sides[0])+len(sides[1]) > 0 && !bh.isMatchEnded && !gs.IsWarmupPeriod() && bh.roundNumber-1 <= len(bh.playerMappings) {
 		bh.isValidRoundStart = true
 	} else {
 		bh.isValidRoundStart = false
 	}
 
+	if !bh.isValidRoundStart && bh.state != StateMatchEnded {
+		//no round is played until the next valid round start
+		if !bh.isMatchStarted || gs.IsWarmupPeriod() {
+			bh.state = StateWarmup
+		} else {
+			bh.state = StatePostRound
+		}
+	}
+
 	if bh.isValidRoundStart {
+		bh.state = StateFreezetime
 		bh.roundWinnerDetermined = false
 		bh.roundFreezeTime = true
 		bh.roundWinner = ""
+		bh.roundEndReason = 0
+		bh.roundEndWon = false
 		bh.frameGroup = 0
-		bh.isMatchStarted = true
-		tTeam := gs.TeamTerrorists()
-		ctTeam := gs.TeamCounterTerrorists()
-
-		scoreDiff := utils.Abs((tTeam.Score() - ctTeam.Score()))
-		isTMatchPoint := (tTeam.Score() >= 15 && tTeam.Score()%3 == 0 && scoreDiff >= 1 && tTeam.Score() > ctTeam.Score())
-		isCTMatchPoint := (ctTeam.Score() >= 15 && ctTeam.Score()%3 == 0 && scoreDiff >= 1 && ctTeam.Score() > tTeam.Score())
-		if isTMatchPoint {
+		if !bh.isMatchStarted {
+			bh.isMatchStarted = true
+			bh.notifyMatchStart()
+		}
+		bh.updateGameMode(gs, sides)
+		bh.updateMatchFormat(gs)
+		bh.teams.assignSides(gs, sides, bh.roundNumber, bh.matchFormat)
+		currentMappings := bh.roster.assign(bh.roundNumber, sides, bh.teams.tTeam, bh.teamSize)
+		tScore := gs.TeamTerrorists().Score()
+		ctScore := gs.TeamCounterTerrorists().Score()
+		if bh.matchFormat.IsMatchPoint(tScore, ctScore) {
 			bh.matchPointTeam = "t"
-		} else if isCTMatchPoint {
+		} else if bh.matchFormat.IsMatchPoint(ctScore, tScore) {
 			bh.matchPointTeam = "ct"
 		} else {
 			bh.matchPointTeam = ""
@@ -214,15 +271,7 @@ func (bh *BasicHandler) createPreRoundStartInfo() {
 			utils.PadLeft(strconv.Itoa(gs.TeamCounterTerrorists().Score()), "0", 2) +
 			"_t_" + utils.PadLeft(strconv.Itoa(gs.TeamTerrorists().Score()), "0", 2)
 		if !bh.isMatchEnded && bh.isMatchStarted {
-			if bh.roundNumber-1 < len(bh.playerMappings) {
-				bh.CropData(bh.roundNumber - 1)
-			}
-
-			bh.playerMappings = append(bh.playerMappings, currentMappings)
-
-			for _, subscriber := range bh.roundStartSubscribers {
-				subscriber.RoundStartHandler(events.RoundStart{})
-			}
+			bh.startRound(currentMappings, gs.IngameTick())
 		}
 
 	}
@@ -251,70 +300,32 @@ func (bh *BasicHandler) getPlayersAlive(team common.Team) (playersAlive []*commo
 
 func (bh *BasicHandler) CropData(index int) {
 	bh.playerMappings = bh.playerMappings[:index]
-}
-
-func (bh *BasicHandler) RegisterRoundEndSubscriber(rs RoundEndSubscriber) {
-	parser := *(bh.parser)
-	if bh.roundEndHandlerID == nil {
-		bh.roundEndHandlerID = parser.RegisterEventHandler(bh.RoundEndHandler)
+	if index < len(bh.roundStartTicks) {
+		bh.roundStartTicks = bh.roundStartTicks[:index]
 	}
-
-	bh.roundEndSubscribers = append(bh.roundEndSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) RoundEndHandler(e events.RoundEnd) {
-	bh.UpdateTime()
-	if bh.roundStructureCreated && bh.isMatchStarted {
-		for _, subscriber := range bh.roundEndSubscribers {
-			subscriber.RoundEndHandler(e)
-		}
-	}
-
-}
-
-func (bh *BasicHandler) RegisterGrenadeEventIfSubscriber(rs GrenadeEventIfSubscriber) {
-	parser := *(bh.parser)
-	if bh.grenadeEventIfHandlerID == nil {
-		bh.grenadeEventIfHandlerID = parser.RegisterEventHandler(bh.GrenadeEventIfHandler)
-	}
-
-	bh.grenadeEventIfSubscribers = append(bh.grenadeEventIfSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) GrenadeEventIfHandler(e events.GrenadeEventIf) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.grenadeEventIfSubscribers {
-			subscriber.GrenadeEventIfHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterRoundFreezetimeEndSubscriber(rs RoundFreezetimeEndSubscriber) {
-	parser := *(bh.parser)
-	if bh.roundFreezeTimeEndHandlerID == nil {
-		bh.roundFreezeTimeEndHandlerID = parser.RegisterEventHandler(bh.RoundFreezetimeEndHandler)
-	}
-
-	bh.roundFreezeTimeEndSubscribers = append(bh.roundFreezeTimeEndSubscribers, rs)
-
 }
 
 //this is a workaround for replays that don't send freezetimeend event sometimes
 func (bh *BasicHandler) createRoundStructure() {
 
 	if bh.roundFreezeTime && bh.isValidRoundStart {
+		if bh.staleStart {
+			//the score never counted the round, it is played again
+			bh.scoreAwaited = false
+			bh.startRound(bh.playerMappings[bh.roundNumber-1], (*bh.parser).GameState().IngameTick())
+		}
 		bh.roundFreezeTime = false
 		bh.roundProcessed = false
 		if len(bh.playerMappings[bh.roundNumber-1]) > 0 && !bh.isMatchEnded {
 			bh.roundStructureCreated = true
+			bh.state = StateLive
 		} else {
 			bh.roundStructureCreated = false
 		}
 		parser := (*bh.parser)
-		currentMappings := currentPlayerMappings(parser.GameState())
+		sides := sidePlayers(parser.GameState())
+		bh.updateGameMode(parser.GameState(), sides)
+		currentMappings := bh.roster.assign(bh.roundNumber, sides, bh.teams.tTeam, bh.teamSize)
 		bh.playerMappings[len(bh.playerMappings)-1] = currentMappings
 		if bh.roundNumber-1 < len(bh.playerStats) {
 			bh.playerStats = bh.playerStats[:bh.roundNumber-1]
@@ -322,11 +333,12 @@ func (bh *BasicHandler) createRoundStructure() {
 		bh.AddNewRound() //adds new round for statistic holder
 
 		for _, player := range bh.playerMappings[bh.roundNumber-1] {
-			bh.statisticHolder.setPlayerStat(player.playerObject, 1, "Rounds")
+			bh.statisticHolder.setPlayerStat(player.playerObject, 1, statRounds)
 		}
 
-		for _, subscriber := range bh.roundFreezeTimeEndSubscribers {
-			subscriber.RoundFreezetimeEndHandler(events.RoundFreezetimeEnd{})
+		bh.publish(events.RoundFreezetimeEnd{})
+		if bh.roundStructureCreated {
+			bh.publish(RoundLive{Round: bh.roundNumber})
 		}
 	}
 
@@ -334,456 +346,84 @@ func (bh *BasicHandler) createRoundStructure() {
 
 func (bh *BasicHandler) RoundFreezetimeEndHandler(e events.RoundFreezetimeEnd) {
 	bh.UpdateTime()
-
-	// if !bh.isMatchEnded && bh.isMatchStarted && bh.isValidRoundStart {
-
-	// 	bh.createRoundStructure()
-	// }
-}
-
-func (bh *BasicHandler) RegisterBombPlantedSubscriber(rs BombPlantedSubscriber) {
-	parser := *(bh.parser)
-	if bh.bombPlantedHandlerID == nil {
-		bh.bombPlantedHandlerID = parser.RegisterEventHandler(bh.BombPlantedHandler)
-	}
-
-	bh.bombPlantedSubscribers = append(bh.bombPlantedSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) BombPlantedHandler(e events.BombPlanted) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.bombPlantedSubscribers {
-			subscriber.BombPlantedHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterFrameDoneSubscriber(rs FrameDoneSubscriber) {
-	parser := *(bh.parser)
-	if bh.frameDoneHandlerID == nil {
-		bh.frameDoneHandlerID = parser.RegisterEventHandler(bh.FrameDoneHandler)
+	if bh.state == StateFreezetime {
+		bh.createRoundStructure()
 	}
-
-	bh.frameDoneSubscribers = append(bh.frameDoneSubscribers, rs)
-
 }
 
-func (bh *BasicHandler) FrameDoneHandler(e events.FrameDone) {
+func (bh *BasicHandler) RoundEndHandler(e events.RoundEnd) {
 	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.frameDoneSubscribers {
-			subscriber.FrameDoneHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterRoundEndOfficialSubscriber(rs RoundEndOfficialSubscriber) {
-	parser := *(bh.parser)
-	if bh.roundEndOfficialHandlerID == nil {
-		bh.roundEndOfficialHandlerID = parser.RegisterEventHandler(bh.RoundEndOfficialHandler)
+	if bh.state == StateLive || bh.state == StatePostRound {
+		bh.roundEndReason = e.Reason
+		bh.roundEndWon = e.Winner == common.TeamTerrorists || e.Winner == common.TeamCounterTerrorists
 	}
-
-	bh.roundEndOfficialSubscribers = append(bh.roundEndOfficialSubscribers, rs)
-
+	bh.publish(e)
 }
 
 func (bh *BasicHandler) RoundEndOfficialHandler(e events.RoundEndOfficial) {
 	bh.UpdateTime()
 	if bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.roundEndOfficialSubscribers {
-			subscriber.RoundEndOfficialHandler(e)
+		bh.publish(e)
+		if !bh.roundProcessed {
+			bh.finalizedRound = bh.roundNumber
+			bh.scoreAwaited = bh.roundEndWon && !bh.roundWinnerDetermined
+			bh.publish(RoundFinalized{Round: bh.roundNumber, Winner: bh.roundWinner, Reason: bh.roundEndReason})
 		}
 		bh.roundProcessed = true
 	}
 }
 
-func (bh *BasicHandler) RegisterBombDroppedSubscriber(rs BombDroppedSubscriber) {
-	parser := *(bh.parser)
-	if bh.bombDroppedHandlerID == nil {
-		bh.bombDroppedHandlerID = parser.RegisterEventHandler(bh.BombDroppedHandler)
-	}
-
-	bh.bombDroppedSubscribers = append(bh.bombDroppedSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) BombDroppedHandler(e events.BombDropped) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.bombDroppedSubscribers {
-			subscriber.BombDroppedHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterBombDefusedSubscriber(rs BombDefusedSubscriber) {
-	parser := *(bh.parser)
-	if bh.bombDefusedHandlerID == nil {
-		bh.bombDefusedHandlerID = parser.RegisterEventHandler(bh.BombDefusedHandler)
-	}
-
-	bh.bombDefusedSubscribers = append(bh.bombDefusedSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) BombDefusedHandler(e events.BombDefused) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.bombDefusedSubscribers {
-			subscriber.BombDefusedHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterFlashExplodeSubscriber(rs FlashExplodeSubscriber) {
-	parser := *(bh.parser)
-	if bh.flashExplodeHandlerID == nil {
-		bh.flashExplodeHandlerID = parser.RegisterEventHandler(bh.FlashExplodeHandler)
-	}
-
-	bh.flashExplodeSubscribers = append(bh.flashExplodeSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) FlashExplodeHandler(e events.FlashExplode) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.flashExplodeSubscribers {
-			subscriber.FlashExplodeHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterBombPickupSubscriber(rs BombPickupSubscriber) {
-	parser := *(bh.parser)
-	if bh.bombPickupHandlerID == nil {
-		bh.bombPickupHandlerID = parser.RegisterEventHandler(bh.BombPickupHandler)
-	}
-
-	bh.bombPickupSubscribers = append(bh.bombPickupSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) BombPickupHandler(e events.BombPickup) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.bombPickupSubscribers {
-			subscriber.BombPickupHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterFootstepSubscriber(rs FootstepSubscriber) {
-	parser := *(bh.parser)
-	if bh.footstepHandlerID == nil {
-		bh.footstepHandlerID = parser.RegisterEventHandler(bh.FootstepHandler)
-	}
-
-	bh.footstepSubscribers = append(bh.footstepSubscribers, rs)
-
-}
-
 func (bh *BasicHandler) FootstepHandler(e events.Footstep) {
 	bh.UpdateTime()
-	if bh.isValidRoundStart && !bh.roundWinnerDetermined && !bh.roundStructureCreated {
-
+	//players only move once the round is live, for demos missing the freezetime end event
+	if bh.state == StateFreezetime {
 		bh.createRoundStructure()
-	} else if bh.isValidRoundStart && bh.scoreUpdated && !bh.roundWinnerDetermined {
-		bh.createPreRoundStartInfo()
-		if !bh.roundStructureCreated {
-			bh.createRoundStructure()
-		}
-
-	}
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.footstepSubscribers {
-			subscriber.FootstepHandler(e)
-		}
 	}
-}
-
-func (bh *BasicHandler) RegisterScoreUpdatedSubscriber(rs ScoreUpdatedSubscriber) {
-	parser := *(bh.parser)
-	if bh.scoreUpdatedHandlerID == nil {
-		bh.scoreUpdatedHandlerID = parser.RegisterEventHandler(bh.ScoreUpdatedHandler)
-	}
-
-	bh.scoreUpdatedSubscribers = append(bh.scoreUpdatedSubscribers, rs)
-
+	bh.publish(e)
 }
 
 func (bh *BasicHandler) ScoreUpdatedHandler(e events.ScoreUpdated) {
 	bh.UpdateTime()
 	bh.scoreUpdated = true
+	if bh.state == StateFreezetime {
+		//a round can not be won during freezetime, some demos update the score of the previous round
+		//after the round start event: the round start info is rebuilt from the new score
+		bh.createPreRoundStartInfo()
+		return
+	}
 	if !bh.roundWinnerDetermined && bh.roundStructureCreated {
 		winTeam := e.TeamState.Team()
-		tPoint := 0
-		ctPoint := 0
 		bh.isValidRoundStart = false
+		gs := (*bh.parser).GameState()
+		//the score of the winner comes from the event, the other team keeps its score
+		tScore := gs.TeamTerrorists().Score()
+		ctScore := gs.TeamCounterTerrorists().Score()
 		if winTeam == common.TeamTerrorists {
 			bh.roundWinner = "t"
-			tPoint += 1
+			tScore = e.NewScore
 		} else if winTeam == common.TeamCounterTerrorists {
 			bh.roundWinner = "ct"
-			ctPoint += 1
+			ctScore = e.NewScore
 		} else {
 			bh.roundWinner = "invalid"
 		}
 
-		gs := (*bh.parser).GameState()
-		if bh.roundNumber > 15 {
-			bh.terroristFirstTeamscore = gs.TeamCounterTerrorists().Score() + ctPoint
-			bh.ctFirstTeamScore = gs.TeamTerrorists().Score() + tPoint
-		} else {
-			bh.terroristFirstTeamscore = gs.TeamTerrorists().Score() + tPoint
-			bh.ctFirstTeamScore = gs.TeamCounterTerrorists().Score() + ctPoint
-		}
-		if bh.roundWinner == bh.matchPointTeam && bh.matchPointTeam != "" && bh.isMatchStarted {
+		bh.teams.setScores(tScore, ctScore)
+		bh.terroristFirstTeamscore, bh.ctFirstTeamScore = bh.teams.teams[0].Score, bh.teams.teams[1].Score
+		if bh.isMatchStarted && bh.matchFormat.IsMatchOver(tScore, ctScore) {
 			bh.isMatchEnded = true
 		}
-		if bh.isMatchStarted {
-			for _, subscriber := range bh.scoreUpdatedSubscribers {
-				subscriber.ScoreUpdatedHandler(e)
-			}
-		}
+		bh.publish(e)
 		bh.roundWinnerDetermined = true
+		bh.state = StatePostRound
 
 		if bh.isMatchEnded {
 			bh.RoundEndOfficialHandler(events.RoundEndOfficial{})
+			bh.state = StateMatchEnded
+			bh.publish(MatchFinalized{Rounds: bh.roundNumber, TerroristFirstTeamScore: bh.terroristFirstTeamscore,
+				CTFirstTeamScore: bh.ctFirstTeamScore})
+			bh.notifyMatchEnd()
 		}
 	}
 
 }
-
-func (bh *BasicHandler) RegisterHeExplodeSubscriber(rs HeExplodeSubscriber) {
-	parser := *(bh.parser)
-	if bh.heExplodeHandlerID == nil {
-		bh.heExplodeHandlerID = parser.RegisterEventHandler(bh.HeExplodeHandler)
-	}
-
-	bh.heExplodeSubscribers = append(bh.heExplodeSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) HeExplodeHandler(e events.HeExplode) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.heExplodeSubscribers {
-			subscriber.HeExplodeHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterItemDropSubscriber(rs ItemDropSubscriber) {
-	parser := *(bh.parser)
-	if bh.itemDropHandlerID == nil {
-		bh.itemDropHandlerID = parser.RegisterEventHandler(bh.ItemDropHandler)
-	}
-
-	bh.itemDropSubscribers = append(bh.itemDropSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) ItemDropHandler(e events.ItemDrop) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.itemDropSubscribers {
-			subscriber.ItemDropHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterItemPickupSubscriber(rs ItemPickupSubscriber) {
-	parser := *(bh.parser)
-	if bh.itemPickupHandlerID == nil {
-		bh.itemPickupHandlerID = parser.RegisterEventHandler(bh.ItemPickupHandler)
-	}
-
-	bh.itemPickupSubscribers = append(bh.itemPickupSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) ItemPickupHandler(e events.ItemPickup) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.itemPickupSubscribers {
-			subscriber.ItemPickupHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterKillSubscriber(rs KillSubscriber) {
-	parser := *(bh.parser)
-	if bh.killHandlerID == nil {
-		bh.killHandlerID = parser.RegisterEventHandler(bh.KillHandler)
-	}
-
-	bh.killSubscribers = append(bh.killSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) KillHandler(e events.Kill) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.killSubscribers {
-			subscriber.KillHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterPlayerFlashedSubscriber(rs PlayerFlashedSubscriber) {
-	parser := *(bh.parser)
-	if bh.playerFlashedHandlerID == nil {
-		bh.playerFlashedHandlerID = parser.RegisterEventHandler(bh.PlayerFlashedHandler)
-	}
-
-	bh.playerFlashedSubscribers = append(bh.playerFlashedSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) PlayerFlashedHandler(e events.PlayerFlashed) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.playerFlashedSubscribers {
-			subscriber.PlayerFlashedHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterPlayerHurtSubscriber(rs PlayerHurtSubscriber) {
-	parser := *(bh.parser)
-	if bh.playerHurtHandlerID == nil {
-		bh.playerHurtHandlerID = parser.RegisterEventHandler(bh.PlayerHurtHandler)
-	}
-
-	bh.playerHurtSubscribers = append(bh.playerHurtSubscribers, rs)
-}
-
-func (bh *BasicHandler) PlayerHurtHandler(e events.PlayerHurt) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.playerHurtSubscribers {
-			subscriber.PlayerHurtHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterWeaponReloadSubscriber(rs WeaponReloadSubscriber) {
-	parser := *(bh.parser)
-	if bh.weaponReloadHandlerID == nil {
-		bh.weaponReloadHandlerID = parser.RegisterEventHandler(bh.WeaponReloadHandler)
-	}
-
-	bh.weaponReloadSubscribers = append(bh.weaponReloadSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) WeaponReloadHandler(e events.WeaponReload) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.weaponReloadSubscribers {
-			subscriber.WeaponReloadHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterIsWarmupPeriodChangedSubscriber(rs IsWarmupPeriodChangedSubscriber) {
-	parser := *(bh.parser)
-	if bh.isWarmupPeriodChangedHandlerID == nil {
-		bh.isWarmupPeriodChangedHandlerID = parser.RegisterEventHandler(bh.IsWarmupPeriodChangedHandler)
-	}
-
-	bh.isWarmupPeriodChangedSubscribers = append(bh.isWarmupPeriodChangedSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) IsWarmupPeriodChangedHandler(e events.IsWarmupPeriodChanged) {
-	bh.UpdateTime()
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.roundStructureCreated {
-		for _, subscriber := range bh.isWarmupPeriodChangedSubscribers {
-			subscriber.IsWarmupPeriodChangedHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterPlayerTeamChangeSubscriber(rs PlayerTeamChangeSubscriber) {
-	parser := *(bh.parser)
-	if bh.playerTeamChangeHandlerID == nil {
-		bh.playerTeamChangeHandlerID = parser.RegisterEventHandler(bh.PlayerTeamChangeHandler)
-	}
-
-	bh.playerTeamChangeSubscribers = append(bh.playerTeamChangeSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) PlayerTeamChangeHandler(e events.PlayerTeamChange) {
-	bh.UpdateTime()
-
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.isValidRoundStart {
-
-		// if e.NewTeam == common.TeamCounterTerrorists || e.NewTeam == common.TeamTerrorists {
-		// 	if _, ok := bh.playerMappings[bh.roundNumber-1][e.Player.SteamID64]; !ok {
-		// 		bh.playerMappings[bh.roundNumber-1] = currentPlayerMappings((*bh.parser).GameState())
-		// 	}
-		// }
-		for _, subscriber := range bh.playerTeamChangeSubscribers {
-			subscriber.PlayerTeamChangeHandler(e)
-		}
-	}
-}
-
-func (bh *BasicHandler) RegisterPlayerDisconnectedSubscriber(rs PlayerDisconnectedSubscriber) {
-	parser := *(bh.parser)
-	if bh.playerDisconnectedHandlerID == nil {
-		bh.playerDisconnectedHandlerID = parser.RegisterEventHandler(bh.PlayerDisconnectedHandler)
-	}
-
-	bh.playerDisconnectedSubscribers = append(bh.playerDisconnectedSubscribers, rs)
-
-}
-
-func (bh *BasicHandler) PlayerDisconnectedHandler(e events.PlayerDisconnected) {
-	bh.UpdateTime()
-
-	if !bh.isMatchEnded && bh.isMatchStarted && bh.isValidRoundStart {
-
-		for _, subscriber := range bh.playerDisconnectedSubscribers {
-			subscriber.PlayerDisconnectedHandler(e)
-		}
-	}
-}
-
-func currentPlayerMappings(gs dem.GameState) map[uint64]playerMapping {
-	newAllPlayers := make(map[uint64]playerMapping)
-	players := gs.Participants().Playing()
-	ctCount := 0
-	tCount := 0
-	playerBasePos := 0
-	for _, player := range players {
-		isCT := (player.Team == 3)
-		isTR := (player.Team == 2)
-
-		if isTR && tCount > 4 || isCT && ctCount > 4 {
-			fmt.Println("invalid team size")
-			return make(map[uint64]playerMapping)
-		}
-
-		if !(isCT || isTR) {
-			fmt.Println("invalid team")
-			break
-		}
-
-		if isCT {
-			playerBasePos = ctCount + 5
-			ctCount++
-		} else if isTR {
-			playerBasePos = tCount
-			tCount++
-		}
-		newAllPlayers[player.SteamID64] = playerMapping{playerObject: player, currentSlot: playerBasePos}
-	}
-
-	return newAllPlayers
-}
@@ -15,17 +15,36 @@ type BombHandler struct {
 	bombCarrier     *common.Player
 }
 
+const (
+	statBombsPlanted  = "bombs_planted"
+	statBombsPickedUp = "bombs_picked_up"
+	statBombsDefused  = "bombs_defused"
+	statBombsDropped  = "bombs_dropped"
+)
+
+var bombStatistics = RegisterStatistics(
+	StatisticDefinition{Key: statBombsPlanted, Name: "Bombs Planted", Description: "bomb plants",
+		Unit: UnitCount, Aggregation: AggregationSum},
+	StatisticDefinition{Key: statBombsPickedUp, Name: "Bombs Picked Up", Description: "bomb pickups",
+		Unit: UnitCount, Aggregation: AggregationSum},
+	StatisticDefinition{Key: statBombsDefused, Name: "Bombs Defused", Description: "bomb defuses",
+		Unit: UnitCount, Aggregation: AggregationSum},
+	StatisticDefinition{Key: statBombsDropped, Name: "Bombs Dropped", Description: "bomb drops",
+		Unit: UnitCount, Aggregation: AggregationSum})
+
 func (bmbh *BombHandler) Register(bh *BasicHandler) error {
-	bmbh.basicHandler = bh
-	bh.RegisterBombPlantedSubscriber(interface{}(bmbh).(BombPlantedSubscriber))
-	bh.RegisterRoundStartSubscriber(interface{}(bmbh).(RoundStartSubscriber))
-	bh.RegisterBombDefusedSubscriber(interface{}(bmbh).(BombDefusedSubscriber))
-	bh.RegisterBombDroppedSubscriber(interface{}(bmbh).(BombDroppedSubscriber))
-	bh.RegisterBombPickupSubscriber(interface{}(bmbh).(BombPickupSubscriber))
-	bh.RegisterRoundFreezetimeEndSubscriber(interface{}(bmbh).(RoundFreezetimeEndSubscriber))
-	bmbh.baseStatsHeaders = []string{"Bombs Planted", "Bombs Picked Up", "Bombs Defused", "Bombs Dropped"}
-	bmbh.defaultValues = make(map[string]float64)
-	return nil
+	err := bmbh.setupStatistics(bh, bombStatistics...)
+	if err != nil {
+		return err
+	}
+	bmbh.subscriptions, err = bh.SubscribeAll(
+		Subscription{bmbh.BombPlantedHandler, GateRound},
+		Subscription{bmbh.RoundStartHandler, GateAlways},
+		Subscription{bmbh.BombDefusedHandler, GateRound},
+		Subscription{bmbh.BombDroppedHandler, GateRound},
+		Subscription{bmbh.BombPickupHandler, GateRound},
+		Subscription{bmbh.RoundFreezetimeEndHandler, GateAlways})
+	return err
 }
 
 func (bmbh *BombHandler) Update() {
@@ -35,7 +54,7 @@ func (bmbh *BombHandler) Update() {
 func (bh *BombHandler) BombPlantedHandler(e events.BombPlanted) {
 	bh.bombPlanted = true
 	bh.bombPlantedTime = bh.basicHandler.currentTime
-	bh.addToPlayerStat(e.Player, 1, "Bombs Planted")
+	bh.addToPlayerStat(e.Player, 1, statBombsPlanted)
 }
 
 func (bh *BombHandler) RoundStartHandler(e events.RoundStart) {
@@ -48,21 +67,21 @@ func (bh *BombHandler) RoundStartHandler(e events.RoundStart) {
 func (bh *BombHandler) BombDefusedHandler(e events.BombDefused) {
 
 	bh.bombDefused = true
-	bh.addToPlayerStat(e.Player, 1, "Bombs Defused")
+	bh.addToPlayerStat(e.Player, 1, statBombsDefused)
 }
 
 func (bh *BombHandler) BombDroppedHandler(e events.BombDropped) {
 
-	bh.addToPlayerStat(e.Player, 1, "Bombs Dropped")
+	bh.addToPlayerStat(e.Player, 1, statBombsDropped)
 	bh.bombCarrier = nil
 }
 
 func (bh *BombHandler) BombPickupHandler(e events.BombPickup) {
 	bh.bombCarrier = e.Player
 	if bh.bombCarrier != nil {
-		bh.addToPlayerStat(bh.bombCarrier, 1, "Bombs Dropped")
+		bh.addToPlayerStat(bh.bombCarrier, 1, statBombsDropped)
 	}
-	bh.addToPlayerStat(e.Player, 1, "Bombs Picked Up")
+	bh.addToPlayerStat(e.Player, 1, statBombsPickedUp)
 }
 
 func (bh *BombHandler) RoundFreezetimeEndHandler(e events.RoundFreezetimeEnd) {
@@ -0,0 +1,113 @@
+package composite_handlers
+
+import "fmt"
+
+//derived statistics, ratios of statistics of different calculators
+const (
+	statKPR               = "kpr"
+	statADR               = "adr"
+	statKD                = "kd"
+	statKASTPercent       = "kast_percent"
+	statHSPercent         = "hs_percent"
+	statOpeningWinPercent = "opening_win_percent"
+	statClutchWinPercent  = "clutch_win_percent"
+	statEnemiesPerHE      = "enemies_per_he"
+	statDamagePerMoney    = "damage_per_1000_spent"
+)
+
+//DefaultDerivedStatistics lists the derived statistics of pipeline configs that do not list theirs
+var DefaultDerivedStatistics = []string{statKPR, statADR, statKD, statKASTPercent, statHSPercent,
+	statOpeningWinPercent, statClutchWinPercent, statEnemiesPerHE, statDamagePerMoney}
+
+func init() {
+	side := []Dimension{DimensionSide}
+	RegisterStatistics(
+		StatisticDefinition{Key: statKPR, Name: "KPR", Description: "kills per round", Unit: UnitRatio,
+			Aggregation: AggregationRatio, Numerator: statKills, Denominator: statRounds, Dimensions: side},
+		StatisticDefinition{Key: statADR, Name: "ADR", Description: "damage per round", Unit: UnitHP,
+			Aggregation: AggregationRatio, Numerator: statTotalDamage, Denominator: statRounds, Dimensions: side},
+		StatisticDefinition{Key: statKD, Name: "K/D", Description: "kills per death, the kills when the player did not die",
+			Unit: UnitRatio, Aggregation: AggregationRatio, Numerator: statKills, Denominator: statDeaths, Dimensions: side,
+			ZeroDenominator: ZeroDenominatorNumerator},
+		StatisticDefinition{Key: statKASTPercent, Name: "KAST %", Description: "share of the rounds counted in KAST",
+			Unit: UnitPercent, Aggregation: AggregationRatio, Numerator: statKASTSum, Denominator: statRounds,
+			Dimensions: side, Scale: 100},
+		StatisticDefinition{Key: statHSPercent, Name: "HS %", Description: "share of the kills made with a headshot",
+			Unit: UnitPercent, Aggregation: AggregationRatio, Numerator: statHSKills, Denominator: statKills,
+			Dimensions: side, Scale: 100},
+		StatisticDefinition{Key: statOpeningWinPercent, Name: "Opening Duel Win %", Description: "share of the first duels won",
+			Unit: UnitPercent, Aggregation: AggregationRatio, Numerator: statFirstKills, Denominator: statFirstKillAttempts,
+			Dimensions: side, Scale: 100},
+		StatisticDefinition{Key: statClutchWinPercent, Name: "Clutch Win %", Description: "share of the clutches won",
+			Unit: UnitPercent, Aggregation: AggregationRatio, Numerator: statClutches, Denominator: statClutchAttempts,
+			Dimensions: side, Scale: 100},
+		StatisticDefinition{Key: statEnemiesPerHE, Name: "Enemies Hit per HE", Description: "enemies damaged per HE grenade thrown",
+			Unit: UnitRatio, Aggregation: AggregationRatio, Numerator: statHEEnemiesHit, Denominator: statHEThrown,
+			Dimensions: side},
+		StatisticDefinition{Key: statDamagePerMoney, Name: "Damage per $1000 Spent", Description: "damage per $1000 spent on equipment",
+			Unit: UnitHP, Aggregation: AggregationRatio, Numerator: statTotalDamage, Denominator: statMoneySpent,
+			Dimensions: side, Scale: 1000})
+}
+
+//checkDerivedStatistic checks that key is a registered ratio
+func checkDerivedStatistic(key string) error {
+	definition, err := LookupStatistic(key)
+	if err != nil {
+		return err
+	}
+	if definition.Aggregation != AggregationRatio {
+		return fmt.Errorf("statistic %q is not a ratio", key)
+	}
+	return nil
+}
+
+//DeriveStatistics computes the ratio statistics keys from values, the statistics of a player by header.
+//Columns whose terms are missing from values are left out, so that rows with the same headers get the same columns.
+func DeriveStatistics(keys []string, values map[string]float64) (columns []StatisticColumn, derived []float64, err error) {
+	for _, key := range keys {
+		definition, err := LookupStatistic(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		terms, err := definition.RatioTerms()
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, column := range definition.Columns() {
+			numerator, numeratorOK := values[terms[i][0]]
+			denominator, denominatorOK := values[terms[i][1]]
+			if !numeratorOK || !denominatorOK {
+				continue
+			}
+			columns = append(columns, column)
+			derived = append(derived, definition.Ratio(numerator, denominator))
+		}
+	}
+	return columns, derived, nil
+}
+
+//derive appends the derived statistics keys to every row of ps
+func (ps *PlayerStatistics) derive(keys []string) error {
+	for i := range ps.Players {
+		row := &ps.Players[i]
+		for len(row.Values) < len(ps.Headers) { //players missing from a calculator
+			row.Values = append(row.Values, 0)
+		}
+		values := make(map[string]float64, len(ps.Headers))
+		for j, header := range ps.Headers {
+			values[header] = row.Values[j]
+		}
+		columns, derived, err := DeriveStatistics(keys, values)
+		if err != nil {
+			return err
+		}
+		row.Values = append(row.Values, derived...)
+		if i == len(ps.Players)-1 {
+			for _, column := range columns {
+				ps.Headers = append(ps.Headers, column.Header)
+				ps.Columns = append(ps.Columns, column)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package composite_handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeriveStatistics(t *testing.T) {
+	stats := PlayerStatistics{
+		Headers: []string{"Rounds", "Rounds_T", "Rounds_CT", "Kills", "Kills_T", "Kills_CT", "Deaths", "Deaths_T", "Deaths_CT"},
+		Players: []PlayerStatisticsRow{{SteamID: 1, Values: []float64{20, 10, 10, 15, 10, 5, 0, 0, 0}},
+			{SteamID: 2, Values: []float64{20, 10, 10, 10, 4, 6, 20, 10, 10}}},
+	}
+	if err := stats.derive([]string{statKPR, statKD, statADR}); err != nil {
+		t.Fatal(err)
+	}
+	//ADR is left out, no damage was computed
+	wantHeaders := []string{"KPR", "KPR_T", "KPR_CT", "K/D", "K/D_T", "K/D_CT"}
+	if !reflect.DeepEqual(stats.Headers[9:], wantHeaders) || len(stats.Columns) != len(wantHeaders) {
+		t.Fatalf("unexpected derived headers %v", stats.Headers[9:])
+	}
+	if want := []float64{0.75, 1, 0.5, 15, 10, 5}; !reflect.DeepEqual(stats.Players[0].Values[9:], want) {
+		t.Errorf("a player without deaths: got %v, want %v", stats.Players[0].Values[9:], want)
+	}
+	if want := []float64{0.5, 0.4, 0.6, 0.5, 0.4, 0.6}; !reflect.DeepEqual(stats.Players[1].Values[9:], want) {
+		t.Errorf("got %v, want %v", stats.Players[1].Values[9:], want)
+	}
+
+	kast, _ := LookupStatistic(statKASTPercent)
+	if value := kast.Ratio(15, 20); value != 75 {
+		t.Errorf("KAST %% should be scaled to a percentage, got %v", value)
+	}
+	if value := kast.Ratio(0, 0); value != 0 {
+		t.Errorf("KAST %% without rounds should be 0, got %v", value)
+	}
+}
+
+func TestDerivedStatisticsAreValidated(t *testing.T) {
+	config := DefaultPipelineConfig()
+	config.DerivedStatistics = []string{statKPR, statKills}
+	if err := config.Validate(); err == nil {
+		t.Error("a base statistic should not be accepted as a derived statistic")
+	}
+	config.DerivedStatistics = []string{"kpr_typo"}
+	if err := config.Validate(); err == nil {
+		t.Error("an unknown derived statistic should not be accepted")
+	}
+}
@@ -0,0 +1,330 @@
+package composite_handlers
+
+import (
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+//BuyType classifies the buy of a team in a round. It is written as its number in the tabular outputs.
+type BuyType int
+
+const (
+	BuyUnknown BuyType = iota //no player on the side
+	BuyPistol
+	BuyEco
+	BuyForce
+	BuyHalf
+	BuyFull
+)
+
+func (bt BuyType) String() string {
+	switch bt {
+	case BuyPistol:
+		return "pistol"
+	case BuyEco:
+		return "eco"
+	case BuyForce:
+		return "force"
+	case BuyHalf:
+		return "half buy"
+	case BuyFull:
+		return "full buy"
+	}
+	return "unknown"
+}
+
+//tier orders the buys that can be compared, -1 for pistols and unknown buys
+func (bt BuyType) tier() int {
+	switch bt {
+	case BuyEco:
+		return 0
+	case BuyForce, BuyHalf:
+		return 1
+	case BuyFull:
+		return 2
+	}
+	return -1
+}
+
+//thresholds of the buy types, in equipment value and money per player
+const (
+	pistolStartMoney    = 800  //mp_startmoney
+	ecoEquipmentValue   = 1500 //below, the team saves
+	fullEquipmentValue  = 4000 //from there, rifles and armor for everyone
+	forceMoneyRemaining = 1000 //below, a team that is not full bought spent all it could
+
+	maxLossBonusLevel  = 4 //mp_consecutive_loss_max
+	halfLossBonusLevel = 1 //each half starts as if both teams had lost once
+)
+
+//classifyBuy classifies the buy of a team from its equipment value at freezetime end and the money it kept.
+//A force buy spends about everything on a buy short of a full buy, a half buy keeps money for the next round.
+func classifyBuy(isPistol bool, equipmentValue int, moneyLeft int, players int) BuyType {
+	switch {
+	case players == 0:
+		return BuyUnknown
+	case isPistol:
+		return BuyPistol
+	case equipmentValue < ecoEquipmentValue*players:
+		return BuyEco
+	case equipmentValue >= fullEquipmentValue*players:
+		return BuyFull
+	case moneyLeft < forceMoneyRemaining*players:
+		return BuyForce
+	}
+	return BuyHalf
+}
+
+//teamEconomy is the economy of a side in a round
+type teamEconomy struct {
+	players        int
+	startMoney     int
+	moneySpent     int
+	equipmentValue int //at freezetime end
+	lossBonusLevel int //at the start of the round
+	buy            BuyType
+	won            bool
+}
+
+//roundEconomy holds the economy of both sides in a round, t then ct
+type roundEconomy struct {
+	number int
+	sides  [2]teamEconomy
+}
+
+//EconomyCalculator records the money and the buys of players and teams in each round.
+//Team economies are in the round statistics and the money of each player in the tabular data.
+//
+//The loss bonus is not networked, it is counted from the results of the rounds seen: each half starts at level 1,
+//a loss raises it by one up to 4 and a win lowers it by one. A loss pays $1400 + $500 * level.
+//Rounds opening a half are pistol rounds, unless the overtime start money buys more than a pistol.
+type EconomyCalculator struct {
+	statisticHolder
+	rounds      []roundEconomy
+	playersInfo playersTabularInfoGatherer
+}
+
+const (
+	statStartMoney        = "start_money"
+	statMoneySpent        = "money_spent"
+	statEquipmentValue    = "equipment_value"
+	statLossBonusLevel    = "loss_bonus_level"
+	statKillsOnEco        = "kills_on_eco"
+	statUnderdogRoundsWon = "underdog_rounds_won"
+)
+
+var economyStatistics = RegisterStatistics(
+	StatisticDefinition{Key: statStartMoney, Name: "Start Money", Description: "money at the start of the round",
+		Unit: UnitMoney, Aggregation: AggregationMean},
+	sideSum(statMoneySpent, "Money Spent", UnitMoney, "money spent in the round"),
+	StatisticDefinition{Key: statEquipmentValue, Name: "Equipment Value",
+		Description: "value of the equipment at freezetime end", Unit: UnitMoney, Aggregation: AggregationMean},
+	StatisticDefinition{Key: statLossBonusLevel, Name: "Loss Bonus Level",
+		Description: "loss bonus level of the team at the start of the round", Unit: UnitCount, Aggregation: AggregationMean},
+	sideSum(statKillsOnEco, "Kills On Eco", UnitCount, "kills made while the team of the player saves"),
+	sideSum(statUnderdogRoundsWon, "Rounds Won As Underdog Buy", UnitRounds,
+		"rounds won with a cheaper buy than the opponents, pistol rounds aside"))
+
+func (ec *EconomyCalculator) Register(bh *BasicHandler) error {
+	ec.rounds = nil
+	err := ec.setupStatistics(bh, economyStatistics...)
+	if err != nil {
+		return err
+	}
+	ec.subscriptions, err = bh.SubscribeAll(
+		Subscription{ec.KillHandler, GateRound},
+		Subscription{ec.RoundFinalizedHandler, GateAlways},
+		Subscription{ec.RoundFreezetimeEndHandler, GateAlways})
+	return err
+}
+
+func sideIndex(team common.Team) int {
+	switch team {
+	case common.TeamTerrorists:
+		return 0
+	case common.TeamCounterTerrorists:
+		return 1
+	}
+	return -1
+}
+
+//currentRound returns the economy of the round being played, nil before its freezetime end
+func (ec *EconomyCalculator) currentRound() *roundEconomy {
+	if len(ec.rounds) == 0 || ec.rounds[len(ec.rounds)-1].number != ec.basicHandler.roundNumber {
+		return nil
+	}
+	return &ec.rounds[len(ec.rounds)-1]
+}
+
+//startLossBonusLevel returns the loss bonus level of side in round from its result in the previous round
+func (ec *EconomyCalculator) startLossBonusLevel(round int, side int) int {
+	if ec.basicHandler.matchFormat.IsHalfStart(round) || len(ec.rounds) == 0 ||
+		ec.rounds[len(ec.rounds)-1].number != round-1 {
+		return halfLossBonusLevel
+	}
+	previous := ec.rounds[len(ec.rounds)-1].sides[side]
+	if previous.won {
+		if previous.lossBonusLevel > 0 {
+			return previous.lossBonusLevel - 1
+		}
+		return 0
+	}
+	if previous.lossBonusLevel < maxLossBonusLevel {
+		return previous.lossBonusLevel + 1
+	}
+	return maxLossBonusLevel
+}
+
+//isPistolRound reports whether round is played with the start money of a half
+func (ec *EconomyCalculator) isPistolRound(round int) bool {
+	format := ec.basicHandler.matchFormat
+	if !format.IsHalfStart(round) {
+		return false
+	}
+	return !format.IsOvertime(round) || format.OvertimeStartMoney <= pistolStartMoney
+}
+
+func (ec *EconomyCalculator) RoundFreezetimeEndHandler(e events.RoundFreezetimeEnd) {
+	round := ec.basicHandler.roundNumber
+	if round-1 < len(ec.playerStats) {
+		ec.playerStats = ec.playerStats[:round-1]
+	}
+	for len(ec.rounds) > 0 && ec.rounds[len(ec.rounds)-1].number >= round { //rounds played again after a rollback
+		ec.rounds = ec.rounds[:len(ec.rounds)-1]
+	}
+	ec.AddNewRound()
+
+	economy := roundEconomy{number: round}
+	moneyLeft := [2]int{}
+	for _, playerMapping := range ec.basicHandler.playerMappings[round-1] {
+		player := playerMapping.playerObject
+		side := sideIndex(player.Team)
+		if side < 0 {
+			continue
+		}
+		spent := player.MoneySpentThisRound()
+		equipmentValue := player.EquipmentValueCurrent()
+		economy.sides[side].players++
+		economy.sides[side].startMoney += player.Money() + spent
+		economy.sides[side].equipmentValue += equipmentValue
+		moneyLeft[side] += player.Money()
+
+		ec.setPlayerStat(player, float64(player.Money()+spent), statStartMoney)
+		ec.setPlayerStat(player, float64(equipmentValue), statEquipmentValue)
+	}
+	isPistol := ec.isPistolRound(round)
+	for side := range economy.sides {
+		team := &economy.sides[side]
+		team.lossBonusLevel = ec.startLossBonusLevel(round, side)
+		team.buy = classifyBuy(isPistol, team.equipmentValue, moneyLeft[side], team.players)
+	}
+	ec.rounds = append(ec.rounds, economy)
+
+	for _, playerMapping := range ec.basicHandler.playerMappings[round-1] {
+		if side := sideIndex(playerMapping.playerObject.Team); side >= 0 {
+			ec.setPlayerStat(playerMapping.playerObject, float64(economy.sides[side].lossBonusLevel), statLossBonusLevel)
+		}
+	}
+}
+
+func (ec *EconomyCalculator) KillHandler(e events.Kill) {
+	economy := ec.currentRound()
+	if economy == nil || e.Killer == nil || e.Victim == nil || e.Killer.Team == e.Victim.Team {
+		return
+	}
+	if side := sideIndex(e.Killer.Team); side >= 0 && economy.sides[side].buy == BuyEco {
+		ec.addToPlayerStat(e.Killer, 1, statKillsOnEco)
+	}
+}
+
+//RoundFinalizedHandler records the money spent, buys can be made after freezetime end, and the winner of the round
+func (ec *EconomyCalculator) RoundFinalizedHandler(e RoundFinalized) {
+	economy := ec.currentRound()
+	if economy == nil {
+		return
+	}
+	winner := -1
+	switch ec.basicHandler.roundWinner {
+	case "t":
+		winner = 0
+	case "ct":
+		winner = 1
+	}
+	for side := range economy.sides {
+		economy.sides[side].moneySpent = 0
+		economy.sides[side].won = side == winner
+	}
+	for _, playerMapping := range ec.basicHandler.playerMappings[economy.number-1] {
+		player := playerMapping.playerObject
+		side := sideIndex(player.Team)
+		if side < 0 {
+			continue
+		}
+		spent := player.MoneySpentThisRound()
+		economy.sides[side].moneySpent += spent
+		ec.setPlayerStat(player, float64(spent), statMoneySpent)
+	}
+	ec.processUnderdogWin(economy, winner)
+}
+
+//processUnderdogWin counts the round for the players of winner when its buy was cheaper than the one of its opponents
+func (ec *EconomyCalculator) processUnderdogWin(economy *roundEconomy, winner int) {
+	if winner < 0 {
+		return
+	}
+	winnerTier := economy.sides[winner].buy.tier()
+	loserTier := economy.sides[1-winner].buy.tier()
+	if winnerTier < 0 || loserTier < 0 || winnerTier >= loserTier {
+		return
+	}
+	for _, playerMapping := range ec.basicHandler.playerMappings[economy.number-1] {
+		if sideIndex(playerMapping.playerObject.Team) == winner {
+			ec.setPlayerStat(playerMapping.playerObject, 1, statUnderdogRoundsWon)
+		}
+	}
+}
+
+//GetStatistics returns the economy of both teams in the round
+func (ec *EconomyCalculator) GetStatistics() ([]string, []float64, error) {
+	var header []string
+	var stats []float64
+	economy := ec.currentRound()
+	for side, sideName := range []string{"t", "ct"} {
+		var team teamEconomy
+		if economy != nil {
+			team = economy.sides[side]
+		}
+		header = append(header, sideName+"_start_money", sideName+"_money_spent", sideName+"_equipment_value",
+			sideName+"_loss_bonus_level", sideName+"_buy_type")
+		stats = append(stats, float64(team.startMoney), float64(team.moneySpent), float64(team.equipmentValue),
+			float64(team.lossBonusLevel), float64(team.buy))
+	}
+	return header, stats, nil
+}
+
+//Update reads the money and the equipment value of the players in each slot
+func (ec *EconomyCalculator) Update() {
+	ec.playersInfo.setup(ec.basicHandler.teamSize, []string{"money", "equipment_value"}, sameFieldName)
+	for _, playerMapping := range ec.basicHandler.playerMappings[ec.basicHandler.roundNumber-1] {
+		player := playerMapping.playerObject
+		base := playerMapping.currentSlot * ec.playersInfo.sizePerPlayer
+		ec.playersInfo.playersTabInfo[base] = float64(player.Money())
+		ec.playersInfo.playersTabInfo[base+1] = float64(player.EquipmentValueCurrent())
+	}
+}
+
+//GetPeriodicTabularData returns the money of each slot and the buy of each team, 0 before freezetime end
+func (ec *EconomyCalculator) GetPeriodicTabularData() ([]string, []float64, error) {
+	header := append([]string(nil), ec.playersInfo.header...)
+	data := append([]float64(nil), ec.playersInfo.playersTabInfo...)
+	economy := ec.currentRound()
+	for side, sideName := range []string{"t", "ct"} {
+		header = append(header, sideName+"_buy_type")
+		if economy != nil {
+			data = append(data, float64(economy.sides[side].buy))
+		} else {
+			data = append(data, float64(BuyUnknown))
+		}
+	}
+	return header, data, nil
+}
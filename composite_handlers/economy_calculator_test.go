@@ -0,0 +1,90 @@
+package composite_handlers
+
+import (
+	"testing"
+
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+func TestClassifyBuy(t *testing.T) {
+	cases := []struct {
+		isPistol       bool
+		equipmentValue int
+		moneyLeft      int
+		players        int
+		want           BuyType
+	}{
+		{false, 0, 0, 0, BuyUnknown},
+		{true, 4000, 0, 5, BuyPistol},
+		{false, 5000, 12000, 5, BuyEco},
+		{false, 24000, 3000, 5, BuyFull},
+		{false, 12000, 2000, 5, BuyForce},
+		{false, 12000, 15000, 5, BuyHalf},
+	}
+	for _, c := range cases {
+		if got := classifyBuy(c.isPistol, c.equipmentValue, c.moneyLeft, c.players); got != c.want {
+			t.Errorf("classifyBuy(%v, %d, %d, %d) = %v, want %v", c.isPistol, c.equipmentValue, c.moneyLeft, c.players,
+				got, c.want)
+		}
+	}
+}
+
+func TestEconomyLossBonusAndUnderdogWins(t *testing.T) {
+	terrorist := &common.Player{SteamID64: 1, Team: common.TeamTerrorists}
+	ct := &common.Player{SteamID64: 2, Team: common.TeamCounterTerrorists}
+	bh := &BasicHandler{matchFormat: DefaultMatchFormat(), roundNumber: 4, roundWinner: "t"}
+	for round := 0; round < bh.roundNumber; round++ {
+		bh.playerMappings = append(bh.playerMappings, map[uint64]playerMapping{1: {playerObject: terrorist},
+			2: {playerObject: ct, currentSlot: 1}})
+	}
+	var ec EconomyCalculator
+	if err := ec.setupStatistics(bh, economyStatistics...); err != nil {
+		t.Fatal(err)
+	}
+	ec.AddNewRound()
+	ec.rounds = []roundEconomy{{number: 3, sides: [2]teamEconomy{{lossBonusLevel: 3, won: true}, {lossBonusLevel: 4}}}}
+
+	if got := ec.startLossBonusLevel(4, 0); got != 2 {
+		t.Errorf("winner loss bonus level: got %d, want 2", got)
+	}
+	if got := ec.startLossBonusLevel(4, 1); got != maxLossBonusLevel {
+		t.Errorf("loser loss bonus level: got %d, want %d", got, maxLossBonusLevel)
+	}
+	ec.rounds = append(ec.rounds, roundEconomy{number: 15, sides: [2]teamEconomy{{lossBonusLevel: 1, won: true},
+		{lossBonusLevel: maxLossBonusLevel}}})
+	for side := range ec.rounds[1].sides {
+		if got := ec.startLossBonusLevel(16, side); got != halfLossBonusLevel {
+			t.Errorf("second half loss bonus level of side %d: got %d, want %d", side, got, halfLossBonusLevel)
+		}
+	}
+	ec.rounds = ec.rounds[:1]
+	if !ec.isPistolRound(16) || ec.isPistolRound(31) {
+		t.Error("pistol rounds open the halves of the regulation, overtimes start with more money")
+	}
+
+	ec.rounds = append(ec.rounds, roundEconomy{number: 4, sides: [2]teamEconomy{{buy: BuyEco}, {buy: BuyFull}}})
+	ec.KillHandler(events.Kill{Killer: terrorist, Victim: ct})
+	ec.KillHandler(events.Kill{Killer: ct, Victim: terrorist})
+	ec.processUnderdogWin(ec.currentRound(), 0)
+
+	for _, c := range []struct {
+		player *common.Player
+		stat   string
+		want   float64
+	}{
+		{terrorist, statKillsOnEco, 1},
+		{ct, statKillsOnEco, 0},
+		{terrorist, statUnderdogRoundsWon, 1},
+		{ct, statUnderdogRoundsWon, 0},
+	} {
+		if got := ec.getPlayerStat(c.player, c.stat); got != c.want {
+			t.Errorf("%s of player %d: got %v, want %v", c.stat, c.player.SteamID64, got, c.want)
+		}
+	}
+
+	header, stats, err := ec.GetStatistics()
+	if err != nil || len(header) != len(stats) || stats[4] != float64(BuyEco) || stats[9] != float64(BuyFull) {
+		t.Errorf("round statistics: got %v %v %v", header, stats, err)
+	}
+}
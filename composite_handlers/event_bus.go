@@ -0,0 +1,220 @@
+package composite_handlers
+
+import (
+	"fmt"
+	"reflect"
+
+	dp "github.com/markus-wa/godispatch"
+
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+//Gate is the state the match must be in for an event to be forwarded to a subscriber.
+//Gates combine, an event is forwarded when every condition of the gate holds.
+type Gate uint8
+
+const (
+	GateMatchStarted    Gate = 1 << iota //a valid round was started
+	GateMatchNotEnded                    //the winner of the final round is not known yet
+	GateRoundStructure                   //the structure of the current round was created, after its freezetime
+	GateValidRoundStart                  //the current round start is valid, before its winner is known
+
+	GateAlways Gate = 0 //every event, including warmup and the events after the match
+	//GateRound forwards the events happening during the rounds of the match, the gate of most subscribers
+	GateRound = GateMatchStarted | GateMatchNotEnded | GateRoundStructure
+	//GateRoundEnd forwards the end of every round, including the final one
+	GateRoundEnd = GateMatchStarted | GateRoundStructure
+	//GateRoster forwards changes of the players of the current round
+	GateRoster = GateMatchStarted | GateMatchNotEnded | GateValidRoundStart
+)
+
+//Subscription pairs an event handler, a func taking a single demoinfocs event, with its gate
+type Subscription struct {
+	Handler interface{}
+	Gate    Gate
+}
+
+//SubscriptionID identifies a subscription to remove it with Unsubscribe
+type SubscriptionID int
+
+type subscription struct {
+	id      SubscriptionID
+	handler reflect.Value
+	gate    Gate
+}
+
+//parserHandler is a handler the basic handler registered on the parser for one event type
+type parserHandler struct {
+	id     dp.HandlerIdentifier
+	pinned bool //registered by RegisterBasicEvents, kept without subscribers
+}
+
+//Subscribe forwards the events taken by handler, a func such as func(events.Kill), while gate holds.
+//The event can be any demoinfocs event type, or an interface such as events.GrenadeEventIf.
+func (bh *BasicHandler) Subscribe(handler interface{}, gate Gate) (SubscriptionID, error) {
+	handlerValue := reflect.ValueOf(handler)
+	handlerType := handlerValue.Type()
+	if handlerType.Kind() != reflect.Func || handlerType.NumIn() != 1 || handlerType.NumOut() != 0 {
+		return 0, fmt.Errorf("event handler must be a func taking a single event, got %T", handler)
+	}
+	eventType := handlerType.In(0)
+	bh.registerParserHandler(eventType, false)
+	bh.lastSubscriptionID++
+	bh.subscriptions[eventType] = append(bh.subscriptions[eventType],
+		subscription{id: bh.lastSubscriptionID, handler: handlerValue, gate: gate})
+	return bh.lastSubscriptionID, nil
+}
+
+//SubscribeAll subscribes every handler, in order. On error, the handlers already subscribed are unsubscribed.
+func (bh *BasicHandler) SubscribeAll(subscriptions ...Subscription) ([]SubscriptionID, error) {
+	var ids []SubscriptionID
+	for _, s := range subscriptions {
+		id, err := bh.Subscribe(s.Handler, s.Gate)
+		if err != nil {
+			bh.Unsubscribe(ids...)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+//Unsubscribe stops forwarding events to the given subscriptions. The parser handler of an event type
+//is removed with its last subscriber, unless the basic handler needs the event itself.
+func (bh *BasicHandler) Unsubscribe(ids ...SubscriptionID) {
+	removed := make(map[SubscriptionID]bool, len(ids))
+	for _, id := range ids {
+		removed[id] = true
+	}
+	for eventType, subscriptions := range bh.subscriptions {
+		//a new slice, events being dispatched keep the subscriptions they started with
+		var kept []subscription
+		for _, s := range subscriptions {
+			if !removed[s.id] {
+				kept = append(kept, s)
+			}
+		}
+		if len(kept) > 0 {
+			bh.subscriptions[eventType] = kept
+			continue
+		}
+		delete(bh.subscriptions, eventType)
+		if handler, ok := bh.parserHandlers[eventType]; ok && !handler.pinned {
+			(*bh.parser).UnregisterEventHandler(handler.id)
+			delete(bh.parserHandlers, eventType)
+		}
+	}
+}
+
+//registerParserHandler makes the parser send the events of eventType to the basic handler, once per type.
+//Events the basic handler processes itself go to its own handler, the others are forwarded as they come.
+func (bh *BasicHandler) registerParserHandler(eventType reflect.Type, pinned bool) {
+	if bh.subscriptions == nil {
+		bh.subscriptions = make(map[reflect.Type][]subscription)
+		bh.parserHandlers = make(map[reflect.Type]*parserHandler)
+	}
+	if handler, ok := bh.parserHandlers[eventType]; ok {
+		handler.pinned = handler.pinned || pinned
+		return
+	}
+	if isSyntheticEvent(eventType) {
+		return
+	}
+
+	handler, owned := bh.ownedHandler(eventType)
+	if !owned {
+		handler = reflect.MakeFunc(reflect.FuncOf([]reflect.Type{eventType}, nil, false), func(args []reflect.Value) []reflect.Value {
+			bh.UpdateTime()
+			bh.dispatch(eventType, args[0])
+			return nil
+		}).Interface()
+	}
+	bh.parserHandlers[eventType] = &parserHandler{id: (*bh.parser).RegisterEventHandler(handler), pinned: pinned}
+}
+
+//ownedHandler returns the handler of an event the basic handler needs to track the match state.
+//These handlers decide themselves when the event, or a synthetic one, is published to subscribers.
+func (bh *BasicHandler) ownedHandler(eventType reflect.Type) (interface{}, bool) {
+	switch eventType {
+	case reflect.TypeOf(events.RoundStart{}):
+		return bh.RoundStartHandler, true
+	case reflect.TypeOf(events.RoundEnd{}):
+		return bh.RoundEndHandler, true
+	case reflect.TypeOf(events.RoundFreezetimeEnd{}):
+		return bh.RoundFreezetimeEndHandler, true
+	case reflect.TypeOf(events.RoundEndOfficial{}):
+		return bh.RoundEndOfficialHandler, true
+	case reflect.TypeOf(events.ScoreUpdated{}):
+		return bh.ScoreUpdatedHandler, true
+	case reflect.TypeOf(events.Footstep{}):
+		return bh.FootstepHandler, true
+	}
+	return nil, false
+}
+
+//publish forwards e to the subscribers of its type whose gate holds
+func (bh *BasicHandler) publish(e interface{}) {
+	bh.dispatch(reflect.TypeOf(e), reflect.ValueOf(e))
+}
+
+func (bh *BasicHandler) dispatch(eventType reflect.Type, e reflect.Value) {
+	args := []reflect.Value{e}
+	for _, s := range bh.subscriptions[eventType] {
+		if bh.gateHolds(s.gate) {
+			s.handler.Call(args)
+		}
+	}
+}
+
+func (bh *BasicHandler) gateHolds(gate Gate) bool {
+	return (gate&GateMatchStarted == 0 || bh.isMatchStarted) &&
+		(gate&GateMatchNotEnded == 0 || !bh.isMatchEnded) &&
+		(gate&GateRoundStructure == 0 || bh.roundStructureCreated) &&
+		(gate&GateValidRoundStart == 0 || bh.isValidRoundStart)
+}
+
+//Attach registers handler and keeps it to call its lifecycle hooks and to detach it in Close
+func (bh *BasicHandler) Attach(handler CompositeEventHandler) error {
+	if err := handler.Register(bh); err != nil {
+		return err
+	}
+	bh.attachedHandlers = append(bh.attachedHandlers, handler)
+	return nil
+}
+
+func (bh *BasicHandler) notifyMatchStart() {
+	for _, handler := range bh.attachedHandlers {
+		if hook, ok := handler.(MatchStartHook); ok {
+			hook.OnMatchStart()
+		}
+	}
+}
+
+func (bh *BasicHandler) notifyMatchEnd() {
+	for _, handler := range bh.attachedHandlers {
+		if hook, ok := handler.(MatchEndHook); ok {
+			hook.OnMatchEnd()
+		}
+	}
+}
+
+//Close unregisters and closes the attached handlers, last attached first, then removes every handler
+//the basic handler registered on the parser. It returns the first error met.
+func (bh *BasicHandler) Close() error {
+	var firstErr error
+	for i := len(bh.attachedHandlers) - 1; i >= 0; i-- {
+		handler := bh.attachedHandlers[i]
+		err := handler.Unregister()
+		if closer, ok := handler.(HandlerCloser); ok && err == nil {
+			err = closer.Close()
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	bh.attachedHandlers = nil
+	if err := bh.Unregister(); firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
@@ -0,0 +1,103 @@
+package composite_handlers
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+func TestSubscriptionGates(t *testing.T) {
+	parser := dem.NewParser(bytes.NewReader(make([]byte, 1024))) //the parser buffers its input when created
+	defer parser.Close()
+	bh := &BasicHandler{parser: &parser}
+
+	var roundKills, allKills, grenades int
+	_, err := bh.SubscribeAll(
+		Subscription{func(events.Kill) { roundKills++ }, GateRound},
+		Subscription{func(events.Kill) { allKills++ }, GateAlways},
+		Subscription{func(events.GrenadeEventIf) { grenades++ }, GateAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bh.publish(events.Kill{}) //warmup
+	bh.isMatchStarted, bh.roundStructureCreated = true, true
+	bh.publish(events.Kill{})
+	bh.isMatchEnded = true
+	bh.publish(events.Kill{})
+	if roundKills != 1 || allKills != 3 {
+		t.Errorf("expected 1 round kill and 3 kills, got %d and %d", roundKills, allKills)
+	}
+
+	//the parser sends grenade events to the handler of their interface
+	bh.dispatch(reflect.TypeOf((*events.GrenadeEventIf)(nil)).Elem(), reflect.ValueOf(events.HeExplode{}))
+	if grenades != 1 {
+		t.Errorf("expected the grenade subscriber to get the event, got %d", grenades)
+	}
+
+	if _, err = bh.Subscribe(func(a, b events.Kill) {}, GateRound); err == nil {
+		t.Error("a handler taking two events should be rejected")
+	}
+}
+
+type lifecycleRecorder struct {
+	basicHandler  *BasicHandler
+	subscriptions []SubscriptionID
+	calls         []string
+}
+
+func (lr *lifecycleRecorder) Register(bh *BasicHandler) error {
+	lr.basicHandler = bh
+	var err error
+	lr.subscriptions, err = bh.SubscribeAll(Subscription{func(events.Kill) {}, GateRound})
+	return err
+}
+
+func (lr *lifecycleRecorder) Unregister() error {
+	lr.basicHandler.Unsubscribe(lr.subscriptions...)
+	lr.calls = append(lr.calls, "unregister")
+	return nil
+}
+
+func (lr *lifecycleRecorder) OnMatchEnd() { lr.calls = append(lr.calls, "match end") }
+
+func (lr *lifecycleRecorder) Close() error {
+	lr.calls = append(lr.calls, "close")
+	return nil
+}
+
+func TestUnsubscribeAndClose(t *testing.T) {
+	parser := dem.NewParser(bytes.NewReader(make([]byte, 1024)))
+	defer parser.Close()
+	bh := &BasicHandler{parser: &parser}
+	bh.RegisterBasicEvents()
+
+	recorder := new(lifecycleRecorder)
+	if err := bh.Attach(recorder); err != nil {
+		t.Fatal(err)
+	}
+	footstepID, _ := bh.Subscribe(func(events.Footstep) {}, GateRound)
+	killType, footstepType := reflect.TypeOf(events.Kill{}), reflect.TypeOf(events.Footstep{})
+	if bh.parserHandlers[killType] == nil || bh.parserHandlers[footstepType] == nil {
+		t.Fatal("subscribing should register the parser handlers")
+	}
+
+	bh.Unsubscribe(footstepID)
+	if bh.parserHandlers[footstepType] == nil {
+		t.Error("the basic handler needs footsteps itself, their parser handler should be kept")
+	}
+
+	bh.notifyMatchEnd()
+	if err := bh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.calls) != 3 || recorder.calls[0] != "match end" || recorder.calls[1] != "unregister" || recorder.calls[2] != "close" {
+		t.Errorf("unexpected lifecycle calls %v", recorder.calls)
+	}
+	if len(bh.parserHandlers) != 0 || len(bh.subscriptions) != 0 {
+		t.Errorf("closing should remove every parser handler, left %v", bh.parserHandlers)
+	}
+}
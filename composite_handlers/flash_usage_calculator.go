@@ -5,7 +5,6 @@ import (
 	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
 	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/sendtables"
 	map_builder "github.com/mrdbarros/csgo_analyze/map_builder"
-	utils "github.com/mrdbarros/csgo_analyze/utils"
 )
 
 type FlashUsageCalculator struct {
@@ -22,29 +21,60 @@ type flashInfo struct {
 	blindnessEndtime float64
 }
 
+const (
+	statFlashesThrown         = "flashes_thrown"
+	statEnemiesBlinded        = "enemies_blinded"
+	statTeammatesBlinded      = "teammates_blinded"
+	statEnemyBlindTime        = "enemy_blind_time"
+	statTeammateBlindTime     = "teammate_blind_time"
+	statFlashesEnemyDeath     = "flashes_enemy_death"
+	statFlashesTeammateDeath  = "flashes_teammate_death"
+	statNetPlayersBlinded     = "net_players_blinded"
+	statNetFlashesLeadToDeath = "net_flashes_lead_to_death"
+	statNetBlindTime          = "net_blind_time"
+)
+
+//netFlashStatistics are computed at round end as the enemies term minus the teammates term
+var netFlashStatistics = [][3]string{{statNetPlayersBlinded, statEnemiesBlinded, statTeammatesBlinded},
+	{statNetFlashesLeadToDeath, statFlashesEnemyDeath, statFlashesTeammateDeath},
+	{statNetBlindTime, statEnemyBlindTime, statTeammateBlindTime}}
+
+//flashStatistics lists the statistics of the calculator, in the order of the outputs
+var flashStatistics = RegisterStatistics(
+	sideSum(statFlashesThrown, "Flashes Thrown", UnitCount, "flashbangs exploded"),
+	sideSum(statEnemiesBlinded, "Enemies Blinded", UnitCount, "enemies blinded by the flashbangs of the player"),
+	sideSum(statTeammatesBlinded, "Teammates Blinded", UnitCount, "teammates blinded by the flashbangs of the player"),
+	sideSum(statEnemyBlindTime, "Total Enemy Blind Time", UnitSeconds, "blind time of the enemies flashed"),
+	sideSum(statTeammateBlindTime, "Total Teammate Blind Time", UnitSeconds, "blind time of the teammates flashed"),
+	sideSum(statFlashesEnemyDeath, "Flashes Leading To Enemy Death", UnitCount, "enemies killed while blinded by the player"),
+	sideSum(statFlashesTeammateDeath, "Flashes Leading To Teammate Death", UnitCount,
+		"teammates killed while blinded by the player"),
+	sideSum(statNetPlayersBlinded, "Net Players Blinded (Enemies-Teammates)", UnitCount,
+		"enemies blinded minus teammates blinded"),
+	sideSum(statNetFlashesLeadToDeath, "Net Flashes Leading To Death (Enemies-Teammates)", UnitCount,
+		"flashes leading to an enemy death minus flashes leading to a teammate death"),
+	sideSum(statNetBlindTime, "Net Blind Time (Enemies-Teammates)", UnitSeconds,
+		"enemy blind time minus teammate blind time"))
+
 func (fc *FlashUsageCalculator) Register(bh *BasicHandler) error {
-	fc.basicHandler = bh
-	bh.RegisterRoundStartSubscriber(interface{}(fc).(RoundStartSubscriber))
-	bh.RegisterFlashExplodeSubscriber(interface{}(fc).(FlashExplodeSubscriber))
-	bh.RegisterKillSubscriber(interface{}(fc).(KillSubscriber))
-	bh.RegisterPlayerFlashedSubscriber(interface{}(fc).(PlayerFlashedSubscriber))
-	bh.RegisterRoundFreezetimeEndSubscriber(interface{}(fc).(RoundFreezetimeEndSubscriber))
-	bh.RegisterRoundEndOfficialSubscriber(interface{}(fc).(RoundEndOfficialSubscriber))
-	fc.baseStatsHeaders = []string{"Flashes Thrown", "Flashes Thrown_T", "Flashes Thrown_CT",
-		"Enemies Blinded", "Enemies Blinded_T", "Enemies Blinded_CT",
-		"Teammates Blinded", "Teammates Blinded_T", "Teammates Blinded_CT",
-		"Total Enemy Blind Time", "Total Enemy Blind Time_T", "Total Enemy Blind Time_CT",
-		"Total Teammate Blind Time", "Total Teammate Blind Time_T", "Total Teammate Blind Time_CT",
-		"Flashes Leading To Enemy Death", "Flashes Leading To Enemy Death_T", "Flashes Leading To Enemy Death_CT",
-		"Flashes Leading To Teammate Death", "Flashes Leading To Teammate Death_T", "Flashes Leading To Teammate Death_CT",
-		"Net Players Blinded (Enemies-Teammates)", "Net Players Blinded (Enemies-Teammates)_T", "Net Players Blinded (Enemies-Teammates)_CT",
-		"Net Flashes Leading To Death (Enemies-Teammates)", "Net Flashes Leading To Death (Enemies-Teammates)_T", "Net Flashes Leading To Death (Enemies-Teammates)_CT",
-		"Net Blind Time (Enemies-Teammates)", "Net Blind Time (Enemies-Teammates)_T", "Net Blind Time (Enemies-Teammates)_CT",
+	err := fc.setupStatistics(bh, flashStatistics...)
+	if err != nil {
+		return err
+	}
+	for _, netStat := range netFlashStatistics {
+		if err = fc.requireStatistics(netStat[:]...); err != nil {
+			return err
+		}
 	}
-
-	fc.defaultValues = make(map[string]float64)
 	fc.blindPlayers = make(map[uint64]flashInfo)
-	return nil
+	fc.subscriptions, err = bh.SubscribeAll(
+		Subscription{fc.RoundStartHandler, GateAlways},
+		Subscription{fc.FlashExplodeHandler, GateRound},
+		Subscription{fc.KillHandler, GateRound},
+		Subscription{fc.PlayerFlashedHandler, GateRound},
+		Subscription{fc.RoundFreezetimeEndHandler, GateAlways},
+		Subscription{fc.RoundFinalizedHandler, GateAlways})
+	return err
 }
 
 func (fc *FlashUsageCalculator) RoundStartHandler(e events.RoundStart) {
@@ -61,45 +91,29 @@ func (fc *FlashUsageCalculator) RoundFreezetimeEndHandler(e events.RoundFreezeti
 func (fc *FlashUsageCalculator) FlashExplodeHandler(e events.FlashExplode) {
 
 	if e.Thrower != nil {
-		fc.addToPlayerStat(e.Thrower, 1, "Flashes Thrown")
+		fc.addToPlayerStat(e.Thrower, 1, statFlashesThrown)
 	}
 
 }
 
-func (fc *FlashUsageCalculator) RoundEndOfficialHandler(e events.RoundEndOfficial) {
+//RoundFinalizedHandler completes the statistics of the round, before the info generation reads them
+func (fc *FlashUsageCalculator) RoundFinalizedHandler(e RoundFinalized) {
 
 	fc.processRoundEnd()
 
 }
 
 func (fc *FlashUsageCalculator) processRoundEnd() {
-	var statIndex int
-	var playerID uint64
-	var roundID int
-	var enemiesIndex int
-	var teammatesIndex int
-	roundID = len(fc.playerStats) - 1
+	roundID := len(fc.playerStats) - 1
 	for _, playerMapping := range fc.basicHandler.playerMappings[roundID] {
-		playerID = playerMapping.playerObject.SteamID64
-		for _, suffix := range [3]string{"", "_T", "_CT"} {
-
-			statIndex = utils.IndexOf("Net Players Blinded (Enemies-Teammates)"+suffix, fc.baseStatsHeaders)
-			enemiesIndex = utils.IndexOf("Enemies Blinded"+suffix, fc.baseStatsHeaders)
-			teammatesIndex = utils.IndexOf("Teammates Blinded"+suffix, fc.baseStatsHeaders)
-			fc.playerStats[roundID][playerID][statIndex] = fc.playerStats[roundID][playerID][enemiesIndex] - fc.playerStats[roundID][playerID][teammatesIndex]
-
-			statIndex = utils.IndexOf("Net Flashes Leading To Death (Enemies-Teammates)"+suffix, fc.baseStatsHeaders)
-			enemiesIndex = utils.IndexOf("Flashes Leading To Enemy Death"+suffix, fc.baseStatsHeaders)
-			teammatesIndex = utils.IndexOf("Flashes Leading To Teammate Death"+suffix, fc.baseStatsHeaders)
-			fc.playerStats[roundID][playerID][statIndex] = fc.playerStats[roundID][playerID][enemiesIndex] - fc.playerStats[roundID][playerID][teammatesIndex]
-
-			statIndex = utils.IndexOf("Net Blind Time (Enemies-Teammates)"+suffix, fc.baseStatsHeaders)
-			enemiesIndex = utils.IndexOf("Total Enemy Blind Time"+suffix, fc.baseStatsHeaders)
-			teammatesIndex = utils.IndexOf("Total Teammate Blind Time"+suffix, fc.baseStatsHeaders)
-			fc.playerStats[roundID][playerID][statIndex] = fc.playerStats[roundID][playerID][enemiesIndex] - fc.playerStats[roundID][playerID][teammatesIndex]
-
+		values := fc.playerStats[roundID][playerMapping.playerObject.SteamID64]
+		for _, netStat := range netFlashStatistics {
+			//the net statistic and its terms have the same variants, in the same order
+			enemiesIndices, teammatesIndices := fc.statColumns(netStat[1]), fc.statColumns(netStat[2])
+			for i, statIndex := range fc.statColumns(netStat[0]) {
+				values[statIndex] = values[enemiesIndices[i]] - values[teammatesIndices[i]]
+			}
 		}
-
 	}
 }
 
@@ -117,9 +131,9 @@ func (fc *FlashUsageCalculator) KillHandler(e events.Kill) {
 		if flashInfo, ok := fc.blindPlayers[e.Victim.SteamID64]; ok {
 			if flashInfo.blindnessEndtime > fc.basicHandler.currentTime {
 				if e.Victim.Team == flashInfo.attacker.Team {
-					fc.addToPlayerStat(flashInfo.attacker, 1, "Flashes Leading To Teammate Death")
+					fc.addToPlayerStat(flashInfo.attacker, 1, statFlashesTeammateDeath)
 				} else {
-					fc.addToPlayerStat(flashInfo.attacker, 1, "Flashes Leading To Enemy Death")
+					fc.addToPlayerStat(flashInfo.attacker, 1, statFlashesEnemyDeath)
 				}
 
 			}
@@ -152,11 +166,11 @@ func (fc *FlashUsageCalculator) PlayerFlashedHandler(e events.PlayerFlashed) {
 
 	if relevantFlashInfo {
 		if e.Attacker.Team == e.Player.Team {
-			fc.addToPlayerStat(e.Attacker, e.FlashDuration().Seconds(), "Total Teammate Blind Time")
-			fc.addToPlayerStat(e.Attacker, 1, "Teammates Blinded")
+			fc.addToPlayerStat(e.Attacker, e.FlashDuration().Seconds(), statTeammateBlindTime)
+			fc.addToPlayerStat(e.Attacker, 1, statTeammatesBlinded)
 		} else {
-			fc.addToPlayerStat(e.Attacker, e.FlashDuration().Seconds(), "Total Enemy Blind Time")
-			fc.addToPlayerStat(e.Attacker, 1, "Enemies Blinded")
+			fc.addToPlayerStat(e.Attacker, e.FlashDuration().Seconds(), statEnemyBlindTime)
+			fc.addToPlayerStat(e.Attacker, 1, statEnemiesBlinded)
 		}
 	}
 
@@ -0,0 +1,92 @@
+package composite_handlers
+
+import (
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+//GameMode is the mode of the match, read from the game_type and game_mode convars
+type GameMode string
+
+const (
+	GameModeCasual      GameMode = "casual"
+	GameModeCompetitive GameMode = "competitive"
+	GameModeWingman     GameMode = "wingman"
+	GameModeOther       GameMode = "other"   //a mode without rounds between two teams, such as deathmatch
+	GameModeUnknown     GameMode = "unknown" //the demo did not announce its mode
+)
+
+//maxTeamSize is the largest team the outputs have slots and icons for
+const maxTeamSize = 5
+
+//DefaultTeamSize is the team size of competitive matches, used by outputs that do not know the team size
+const DefaultTeamSize = 5
+
+//GameModeFromConVars reads the mode from the game rules convars of a demo
+func GameModeFromConVars(conVars map[string]string) GameMode {
+	gameType, typeFound := conVars["game_type"]
+	gameMode, modeFound := conVars["game_mode"]
+	if !typeFound || !modeFound {
+		return GameModeUnknown
+	}
+	if gameType != "0" {
+		return GameModeOther
+	}
+	switch gameMode {
+	case "0":
+		return GameModeCasual
+	case "1":
+		return GameModeCompetitive
+	case "2":
+		return GameModeWingman
+	}
+	return GameModeOther
+}
+
+//MaxTeamSize returns the most players a side of the mode can have in the outputs
+func (gm GameMode) MaxTeamSize() int {
+	if gm == GameModeWingman {
+		return 2
+	}
+	return maxTeamSize
+}
+
+//DefaultMatchFormat returns the format of the mode, for demos that do not announce theirs
+func (gm GameMode) DefaultMatchFormat() MatchFormat {
+	if gm == GameModeWingman {
+		return MatchFormat{RegulationRounds: 16, OvertimeStartMoney: 10000}
+	}
+	return DefaultMatchFormat()
+}
+
+//updateGameMode reads the mode from the game rules and sets the team size when the match starts.
+//The team size then stays the same for the whole match, so that the slots and the periodic columns of all rounds
+//match: players beyond it are left without a slot and recorded as overflows.
+func (bh *BasicHandler) updateGameMode(gs dem.GameState, sides [2][]*common.Player) {
+	if mode := GameModeFromConVars(gs.ConVars()); mode != GameModeUnknown {
+		bh.gameMode = mode
+	}
+	if bh.teamSize == 0 {
+		bh.teamSize = matchTeamSize(bh.gameMode, sides)
+	}
+}
+
+//matchTeamSize returns the team size of a match: the largest side at the start of the match, capped by the size
+//of the teams of the mode. mp_maxplayers is the capacity of the server, scrims play fewer players than it allows.
+func matchTeamSize(mode GameMode, sides [2][]*common.Player) int {
+	teamSize := 0
+	for _, players := range sides {
+		if len(players) > teamSize {
+			teamSize = len(players)
+		}
+	}
+	if teamSize > mode.MaxTeamSize() {
+		teamSize = mode.MaxTeamSize()
+	}
+	return teamSize
+}
+
+//GameMode returns the mode of the match and the number of players of each side
+func (bh *BasicHandler) GameMode() (GameMode, int) {
+	return bh.gameMode, bh.teamSize
+}
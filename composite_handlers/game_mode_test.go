@@ -0,0 +1,64 @@
+package composite_handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func TestGameModeFromConVars(t *testing.T) {
+	cases := []struct {
+		conVars map[string]string
+		mode    GameMode
+	}{
+		{map[string]string{"game_type": "0", "game_mode": "1"}, GameModeCompetitive},
+		{map[string]string{"game_type": "0", "game_mode": "2"}, GameModeWingman},
+		{map[string]string{"game_type": "0", "game_mode": "0"}, GameModeCasual},
+		{map[string]string{"game_type": "1", "game_mode": "2"}, GameModeOther},
+		{map[string]string{"game_mode": "2"}, GameModeUnknown},
+	}
+	for _, c := range cases {
+		if mode := GameModeFromConVars(c.conVars); mode != c.mode {
+			t.Errorf("%v: got %q, want %q", c.conVars, mode, c.mode)
+		}
+	}
+	if format := GameModeWingman.DefaultMatchFormat(); format.RegulationRounds != 16 || format.Validate() != nil {
+		t.Errorf("unexpected wingman format %+v", format)
+	}
+}
+
+func TestPeriodicHeadersFollowTeamSize(t *testing.T) {
+	var hg hpGatherer
+	hg.Init(2)
+	header, data := hg.GetPeriodicTabularInfo()
+	if !reflect.DeepEqual(header, []string{"t_1", "t_2", "ct_1", "ct_2"}) || len(data) != 4 {
+		t.Errorf("unexpected hp columns %v", header)
+	}
+
+	var wg weaponsGatherer
+	wg.Init(3)
+	header, data = wg.GetPeriodicTabularInfo()
+	if len(header) != 6*9 || len(data) != len(header) || header[8] != "t_1_hasc4" || header[27] != "ct_1_mainweapon" ||
+		header[len(header)-1] != "ct_3_hasdefusekit" {
+		t.Errorf("unexpected weapon columns %v", header)
+	}
+}
+
+func TestMatchTeamSize(t *testing.T) {
+	cases := []struct {
+		mode     GameMode
+		sides    [2][]*common.Player
+		teamSize int
+	}{
+		{GameModeCompetitive, [2][]*common.Player{rosterPlayers(1, 2, 3, 4), rosterPlayers(5, 6, 7)}, 4},
+		{GameModeCompetitive, [2][]*common.Player{rosterPlayers(1, 2, 3), rosterPlayers(4, 5, 6)}, 3},
+		{GameModeWingman, [2][]*common.Player{rosterPlayers(1, 2, 3), rosterPlayers(4, 5)}, 2},
+		{GameModeUnknown, [2][]*common.Player{rosterPlayers(1, 2, 3, 4, 5, 6), rosterPlayers(7)}, maxTeamSize},
+	}
+	for _, c := range cases {
+		if teamSize := matchTeamSize(c.mode, c.sides); teamSize != c.teamSize {
+			t.Errorf("%s %dv%d: got team size %d, want %d", c.mode, len(c.sides[0]), len(c.sides[1]), teamSize, c.teamSize)
+		}
+	}
+}
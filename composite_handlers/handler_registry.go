@@ -0,0 +1,92 @@
+package composite_handlers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//name under which the BasicHandler itself can be listed in a pipeline
+const BasicHandlerName = "basic"
+
+//HandlerParams carries the parameters a handler factory may use to set up its handler
+type HandlerParams struct {
+	TradeInterval float64
+}
+
+//HandlerFactory creates a new, unregistered composite handler
+type HandlerFactory func(params HandlerParams) CompositeEventHandler
+
+var (
+	handlerRegistryMutex sync.RWMutex
+	handlerRegistry      = make(map[string]HandlerFactory)
+)
+
+//RegisterHandlerFactory makes a composite handler available to pipeline configs under name
+func RegisterHandlerFactory(name string, factory HandlerFactory) {
+	handlerRegistryMutex.Lock()
+	defer handlerRegistryMutex.Unlock()
+	if name == BasicHandlerName {
+		panic("handler name " + name + " is reserved")
+	}
+	if _, ok := handlerRegistry[name]; ok {
+		panic("handler " + name + " registered twice")
+	}
+	handlerRegistry[name] = factory
+}
+
+func getHandlerFactory(name string) (HandlerFactory, error) {
+	handlerRegistryMutex.RLock()
+	defer handlerRegistryMutex.RUnlock()
+	factory, ok := handlerRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown handler %q", name)
+	}
+	return factory, nil
+}
+
+//RegisteredHandlerNames returns the sorted names of all registered handler factories
+func RegisteredHandlerNames() []string {
+	handlerRegistryMutex.RLock()
+	defer handlerRegistryMutex.RUnlock()
+	names := []string{BasicHandlerName}
+	for name := range handlerRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterHandlerFactory("kdat", func(params HandlerParams) CompositeEventHandler {
+		kdatHandler := new(KDATCalculator)
+		kdatHandler.Setup(params.TradeInterval)
+		return kdatHandler
+	})
+	RegisterHandlerFactory("adr", func(params HandlerParams) CompositeEventHandler {
+		return new(ADRCalculator)
+	})
+	RegisterHandlerFactory("flash_usage", func(params HandlerParams) CompositeEventHandler {
+		return new(FlashUsageCalculator)
+	})
+	RegisterHandlerFactory("rating", func(params HandlerParams) CompositeEventHandler {
+		return new(RatingCalculator)
+	})
+	RegisterHandlerFactory("utility", func(params HandlerParams) CompositeEventHandler {
+		return new(UtilityDamageCalculator)
+	})
+	RegisterHandlerFactory("economy", func(params HandlerParams) CompositeEventHandler {
+		return new(EconomyCalculator)
+	})
+	RegisterHandlerFactory("bomb", func(params HandlerParams) CompositeEventHandler {
+		return new(BombHandler)
+	})
+	RegisterHandlerFactory("player_periodic_info", func(params HandlerParams) CompositeEventHandler {
+		return new(PlayerPeriodicInfoHandler)
+	})
+	RegisterHandlerFactory("popping_grenade", func(params HandlerParams) CompositeEventHandler {
+		popHandler := new(PoppingGrenadeHandler)
+		popHandler.SetBaseIcons()
+		return popHandler
+	})
+}
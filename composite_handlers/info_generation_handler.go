@@ -1,15 +1,10 @@
 package composite_handlers
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strconv"
+	"sort"
 
 	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
-	dp "github.com/markus-wa/godispatch"
-	database "github.com/mrdbarros/csgo_analyze/database"
 	map_builder "github.com/mrdbarros/csgo_analyze/map_builder"
 	utils "github.com/mrdbarros/csgo_analyze/utils"
 )
@@ -43,81 +38,51 @@ func (md *matchData) AddNewFrameGroup(roundNumber int) {
 
 }
 
+//InfoGenerationHandler runs the generators of the pipeline and gathers their outputs in a MatchResult,
+//handing every finished round to the sinks
 type InfoGenerationHandler struct {
 	basicHandler            *BasicHandler
-	frameDoneHandlerID      dp.HandlerIdentifier
+	subscriptions           []SubscriptionID
 	generationIndex         int
 	lastUpdate              float64
 	isNewRound              bool
 	updateInterval          float64
 	roundEndRegistered      bool //set to true after generating roundendofficial info
-	matchEndRegisted        bool
+	roundStarted            bool //set to true on the first valid round start
 	allIconGenerators       *[]PeriodicIconGenerator
 	allTabularGenerators    *[]PeriodicTabularGenerator
 	allStatGenerators       *[]StatGenerator
 	allPlayerStatCalculator *[]PlayerStatisticCalculator
-	mapGenerator            map_builder.MapGenerator
+	derivedStatistics       []string //ratios added to the statistics of the calculators
 	matchData               *matchData
-	imgSize                 int
-	demFileHash             string
-
-	rootMatchPath    string
-	roundDirPath     string
-	roundTabularPath string
-	roundStatPath    string
-	playerStatPath   string
+	result                  *MatchResult
+	sinks                   []MatchSink
 }
 
 func (ih *InfoGenerationHandler) Register(bh *BasicHandler) error {
 	ih.basicHandler = bh
+	var err error
+	ih.subscriptions, err = bh.SubscribeAll(
+		Subscription{ih.RoundStartHandler, GateAlways},
+		Subscription{ih.FrameDoneHandler, GateRound},
+		Subscription{ih.RoundFinalizedHandler, GateAlways},
+		Subscription{ih.RoundRollbackHandler, GateAlways})
+	return err
+}
 
-	bh.RegisterRoundStartSubscriber(interface{}(ih).(RoundStartSubscriber))
-	bh.RegisterFrameDoneSubscriber(interface{}(ih).(FrameDoneSubscriber))
-	bh.RegisterRoundEndOfficialSubscriber(interface{}(ih).(RoundEndOfficialSubscriber))
-
+func (ih *InfoGenerationHandler) Unregister() error {
+	ih.basicHandler.Unsubscribe(ih.subscriptions...)
+	ih.subscriptions = nil
 	return nil
 }
 
 func (ih *InfoGenerationHandler) RoundStartHandler(e events.RoundStart) {
 	if !ih.basicHandler.isMatchEnded {
-		ih.roundDirPath = ih.rootMatchPath + "/" + ih.basicHandler.currentScore
-		dirExists, _ := utils.Exists(ih.roundDirPath)
 		ih.generationIndex = 0
 		ih.roundEndRegistered = false
+		ih.roundStarted = true
 
-		if !dirExists {
-			matches, err := filepath.Glob(ih.rootMatchPath + "/" +
-				utils.PadLeft(strconv.Itoa(ih.basicHandler.roundNumber), "0", 2) + "*")
-			utils.CheckError(err)
-			if len(matches) > 0 {
-				for _, oldDir := range matches {
-					utils.RemoveContents(oldDir)
-					os.Remove(oldDir)
-				}
-			}
-			err = os.MkdirAll(ih.roundDirPath, 0700)
-			utils.CheckError(err)
-
-		} else {
-			utils.RemoveContents(ih.roundDirPath)
-		}
-
-		ih.roundTabularPath = ih.roundDirPath + "/periodic_data.csv"
-		ih.roundStatPath = ih.roundDirPath + "/statistics.csv"
-		ih.playerStatPath = ih.roundDirPath + "/player_statistics.csv"
 		ih.isNewRound = true
-		roundPeriodicDataCSV, err := os.Create(ih.roundTabularPath)
-		utils.CheckError(err)
-		defer roundPeriodicDataCSV.Close()
-
-		roundStatCSV, err := os.Create(ih.roundStatPath)
-		utils.CheckError(err)
-		defer roundStatCSV.Close()
-
-		playerStatCSV, err := os.Create(ih.playerStatPath)
-		utils.CheckError(err)
-		defer playerStatCSV.Close()
-
 		ih.lastUpdate = 0.0
 
 		if len(ih.matchData.matchIcons) > ih.basicHandler.roundNumber-1 { // match restart or round rollback
@@ -128,99 +93,114 @@ func (ih *InfoGenerationHandler) RoundStartHandler(e events.RoundStart) {
 		} else {
 			ih.matchData.AddNewRound()
 		}
+		if len(ih.result.Rounds) > ih.basicHandler.roundNumber-1 {
+			ih.result.Rounds = ih.result.Rounds[:ih.basicHandler.roundNumber-1]
+		}
 	}
 
 }
 
-func (ih *InfoGenerationHandler) GetFullRoundStatistics() (data [][]string) {
-	var tempHeader []string
-	var tempData []float64
-	var err error
-	var stringData []string
-	var framedData [10][]string
+//RoundRollbackHandler moves the outputs of the rounds discarded by a rollback to the audit of the match
+func (ih *InfoGenerationHandler) RoundRollbackHandler(e RoundRollback) {
+	rollbackIndex := len(ih.basicHandler.rollbacks) - 1
+	var kept []RoundResult
+	for _, round := range ih.result.Rounds {
+		if round.Number >= e.ToRound {
+			ih.result.DiscardedRounds = append(ih.result.DiscardedRounds, DiscardedRound{Rollback: rollbackIndex, Round: round})
+		} else {
+			kept = append(kept, round)
+		}
+	}
+	ih.result.Rounds = kept
+}
+
+//GetFullRoundStatistics returns the statistics of every player of the current round
+func (ih *InfoGenerationHandler) GetFullRoundStatistics() (stats PlayerStatistics, err error) {
 	firstPlayer := true
-	data = append(data, []string{"Name"})
 	for _, playerMapping := range ih.basicHandler.playerMappings[ih.basicHandler.roundNumber-1] {
 		player := playerMapping.playerObject
+		row := PlayerStatisticsRow{SteamID: player.SteamID64, Name: player.Name, Slot: playerMapping.currentSlot}
 
-		for j, playerStatCalculator := range *ih.allPlayerStatCalculator {
-			tempHeader, tempData, err = playerStatCalculator.GetRoundStatistic(ih.basicHandler.roundNumber, player.SteamID64)
-
-			utils.CheckError(err)
-
-			if j == 0 {
-
-				stringData = append([]string{playerMapping.playerObject.Name}, utils.FloatSliceToString(tempData)...)
-			} else {
-				stringData = append(stringData, utils.FloatSliceToString(tempData)...)
+		for _, playerStatCalculator := range *ih.allPlayerStatCalculator {
+			tempHeader, tempData, err := playerStatCalculator.GetRoundStatistic(ih.basicHandler.roundNumber, player.SteamID64)
+			if err != nil {
+				return stats, err
 			}
-
+			row.Values = append(row.Values, tempData...)
 			if firstPlayer {
-				data[0] = append(data[0], tempHeader...)
+				stats.Headers = append(stats.Headers, tempHeader...)
+				stats.Columns = append(stats.Columns, playerStatCalculator.StatisticColumns()...)
 			}
-
 		}
-		framedData[playerMapping.currentSlot] = append(framedData[playerMapping.currentSlot], stringData...)
+		stats.Players = append(stats.Players, row)
 		firstPlayer = false
 
 	}
-	data = append(data, framedData[:]...)
-	return data
+	sort.Slice(stats.Players, func(a, b int) bool { return stats.Players[a].Slot < stats.Players[b].Slot })
+	return stats, stats.derive(ih.derivedStatistics)
 
 }
 
-func (ih *InfoGenerationHandler) processRoundEnd() {
-	if ih.basicHandler.roundWinner != "" && !ih.matchEndRegisted {
-		fmt.Println("Generating round ", ih.basicHandler.roundNumber)
-
-		var tempHeader []string
-		var tempData []float64
-		var newHeaderStat []string
-		var newStat []float64
-		var err error
-
-		if ih.roundDirPath != ih.rootMatchPath {
-			fileWrite, err := os.Create(ih.roundDirPath + "/winner.txt")
-			utils.CheckError(err)
-			defer fileWrite.Close()
-			_, err = fileWrite.WriteString(ih.basicHandler.roundWinner)
-			utils.CheckError(err)
-
-		}
+func (ih *InfoGenerationHandler) processRoundEnd() error {
+	if ih.basicHandler.roundWinner != "" && !ih.result.Finished && ih.roundStarted {
+		roundIndex := ih.basicHandler.roundNumber - 1
+		round := RoundResult{Number: ih.basicHandler.roundNumber, Score: ih.basicHandler.currentScore,
+			Winner: ih.basicHandler.roundWinner}
+		round.TTeam, round.CTTeam = ih.basicHandler.teams.sides()
+		round.Roster = append([]RosterSlot(nil), ih.basicHandler.roster.roundRoster...)
+		round.TeamSize = ih.basicHandler.teamSize
 
 		for _, statGenerator := range *ih.allStatGenerators {
-			newHeaderStat, newStat, err = statGenerator.GetStatistics()
-			utils.CheckError(err)
-			newHeaderStat = append(newHeaderStat, tempHeader...)
-			newStat = append(newStat, tempData...)
-
+			newHeaderStat, newStat, err := statGenerator.GetStatistics()
+			if err != nil {
+				return err
+			}
+			round.StatisticHeaders = append(round.StatisticHeaders, newHeaderStat...)
+			round.Statistics = append(round.Statistics, newStat...)
 		}
-		generalStatistics := append([][]string{newHeaderStat}, utils.FloatSliceToString(newStat))
 
-		playerStatistics := ih.GetFullRoundStatistics()
+		playerStatistics, err := ih.GetFullRoundStatistics()
+		if err != nil {
+			return err
+		}
+		round.PlayerStatistics = playerStatistics
 
 		if ih.basicHandler.roundNumber == 1 && len(*ih.allStatGenerators) > 0 {
-			ih.matchData.matchStatisticsHeaders = nil
-			ih.matchData.matchStatisticsHeaders = append(ih.matchData.matchStatisticsHeaders,
-				newHeaderStat...)
-
+			ih.matchData.matchStatisticsHeaders = round.StatisticHeaders
 		}
 		if len(*ih.allStatGenerators) > 0 {
-			ih.matchData.matchStatistics[ih.basicHandler.roundNumber-1] = append(ih.matchData.matchStatistics[ih.basicHandler.roundNumber-1],
-				newStat...)
+			ih.matchData.matchStatistics[roundIndex] = append(ih.matchData.matchStatistics[roundIndex], round.Statistics...)
 		}
 
-		allTabularData := append([][]string{ih.matchData.matchPeriodicTabularDataHeaders}, utils.FloatMatrixToString(ih.matchData.matchPeriodicTabularData[ih.basicHandler.roundNumber-1])...)
+		round.PeriodicHeaders = ih.matchData.matchPeriodicTabularDataHeaders
+		for _, frame := range ih.matchData.matchPeriodicTabularData[roundIndex] {
+			if len(frame) > 0 {
+				round.PeriodicFrames = append(round.PeriodicFrames, frame)
+			}
+		}
+		if len(*ih.allIconGenerators) > 0 {
+			round.Icons = ih.matchData.matchIcons[roundIndex]
+		}
 
-		map_builder.GenerateRoundMaps(ih.mapGenerator, ih.matchData.matchIcons[ih.basicHandler.roundNumber-1],
-			ih.roundDirPath)
-		utils.WriteToCSV(allTabularData, ih.roundTabularPath)
-		utils.WriteToCSV(generalStatistics, ih.roundStatPath)
-		utils.WriteToCSV(playerStatistics, ih.playerStatPath)
+		resultIndex := roundIndex
+		if resultIndex > len(ih.result.Rounds) { //earlier rounds are missing from the demo
+			resultIndex = len(ih.result.Rounds)
+		}
+		ih.result.Rounds = append(ih.result.Rounds[:resultIndex], round)
+		ih.updateMetadata()
+		for _, sink := range ih.sinks {
+			if err = sink.WriteRound(ih.result, &ih.result.Rounds[resultIndex]); err != nil {
+				return utils.WithStage(utils.StageOutput, err)
+			}
+		}
 
-		ih.checkAndGenerateMatchEndStatistics()
+		err = ih.checkAndGenerateMatchEndStatistics()
+		if err != nil {
+			return err
+		}
 		ih.roundEndRegistered = true
 	}
+	return nil
 }
 
 // func (ih *InfoGenerationHandler) RoundEndOfficialHandler(e events.RoundEndOfficial) {
@@ -230,47 +210,61 @@ func (ih *InfoGenerationHandler) processRoundEnd() {
 
 // }
 
-func (ih *InfoGenerationHandler) RoundEndOfficialHandler(e events.RoundEndOfficial) {
-	ih.processRoundEnd()
+//RoundFinalizedHandler generates the outputs of the round once the calculators completed its statistics
+func (ih *InfoGenerationHandler) RoundFinalizedHandler(e RoundFinalized) {
+	err := ih.processRoundEnd()
+	if err != nil {
+		ih.basicHandler.SetError(utils.StageGeneration, err)
+	}
+}
+
+//RoundsGenerated returns the number of rounds of the match result
+func (ih *InfoGenerationHandler) RoundsGenerated() int {
+	return len(ih.result.Rounds)
 }
 
-func (ih *InfoGenerationHandler) checkAndGenerateMatchEndStatistics() {
+//Result returns the match gathered so far
+func (ih *InfoGenerationHandler) Result() *MatchResult {
+	ih.updateMetadata()
+	return ih.result
+}
+
+func (ih *InfoGenerationHandler) updateMetadata() {
+	bh := ih.basicHandler
+	metadata := &ih.result.Metadata
+	metadata.FileName = bh.fileName
+	metadata.Map = bh.mapMetadata.Name
+	metadata.MatchDatetime = bh.matchDatetime
+	metadata.TickRate, metadata.TickRateSource = bh.TickRate()
+	metadata.DetectedTickRate, metadata.DetectedTickRateSource = bh.DetectedTickRate()
+	metadata.MatchFormat, metadata.MatchFormatSource = bh.MatchFormat()
+	metadata.GameMode, metadata.TeamSize = bh.GameMode()
+	metadata.TerroristFirstTeamScore = bh.terroristFirstTeamscore
+	metadata.CTFirstTeamScore = bh.ctFirstTeamScore
+	metadata.Teams = bh.teams.results(ih.result.Rounds)
+	metadata.Substitutions = append([]Substitution(nil), bh.roster.substitutions...)
+	metadata.Overflows = append([]Overflow(nil), bh.roster.overflows...)
+	metadata.Rollbacks = append([]Rollback(nil), bh.rollbacks...)
+	metadata.HasRestores = HasRestores(bh.rollbacks)
+	ih.result.Progress = float64((*bh.parser).Progress())
+}
 
+func (ih *InfoGenerationHandler) checkAndGenerateMatchEndStatistics() error {
 	if ih.basicHandler.isMatchEnded {
-		fmt.Println("Generating match statistics")
-		if ih.roundDirPath != ih.rootMatchPath {
-			data := ih.GetFullMatchStatistics()
-			fileWrite, err := os.Create(ih.rootMatchPath + "/match_statistics.csv")
-			utils.CheckError(err)
-			writer := csv.NewWriter(fileWrite)
-
-			err = writer.WriteAll(data)
-			utils.CheckError(err)
-			defer fileWrite.Close()
-			ih.matchEndRegisted = true
+		stats, err := ih.GetFullMatchStatistics()
+		if err != nil {
+			return err
 		}
+		ih.result.PlayerStatistics = stats
+		ih.result.Finished = true
 	}
-
+	return nil
 }
 
-func (ih *InfoGenerationHandler) GetFullMatchStatistics() (data [][]string) {
-	var tempHeader []string
-	var tempData []float64
-	var err error
-	var stringData []string
-	var framedData [][]string
-	var statsIDs [][]int
-
-	firstPlayer := true
-	data = append(data, []string{"Name", "SteamID"})
-	dbConn := database.OpenDBConn()
-
-	matchID := dbConn.InsertMatch(ih.basicHandler.fileName, ih.demFileHash, ih.basicHandler.mapMetadata.Name,
-		ih.basicHandler.terroristFirstTeamscore, ih.basicHandler.ctFirstTeamScore, ih.basicHandler.matchDatetime, true)
-
-	var allPlayers map[uint64]playerMapping
-	allPlayers = make(map[uint64]playerMapping)
-	for roundID, _ := range ih.basicHandler.playerMappings {
+//GetFullMatchStatistics returns the statistics of every player of the match
+func (ih *InfoGenerationHandler) GetFullMatchStatistics() (stats PlayerStatistics, err error) {
+	allPlayers := make(map[uint64]playerMapping)
+	for roundID := range ih.basicHandler.playerMappings {
 		for _, playerMapping := range ih.basicHandler.playerMappings[roundID] {
 			if _, ok := allPlayers[playerMapping.playerObject.SteamID64]; !ok {
 				allPlayers[playerMapping.playerObject.SteamID64] = playerMapping
@@ -278,50 +272,44 @@ func (ih *InfoGenerationHandler) GetFullMatchStatistics() (data [][]string) {
 		}
 	}
 
+	firstPlayer := true
 	for _, playerMapping := range allPlayers {
 		player := playerMapping.playerObject
+		row := PlayerStatisticsRow{SteamID: player.SteamID64, Name: player.Name, Slot: -1}
 
-		for j, playerStatCalculator := range *ih.allPlayerStatCalculator {
-			tempHeader, tempData, err = playerStatCalculator.GetMatchStatistic(player.SteamID64)
-			utils.CheckError(err)
-
-			if j == 0 {
-				dbConn.InsertPlayer(playerMapping.playerObject.SteamID64, playerMapping.playerObject.Name)
-				stringData = append([]string{playerMapping.playerObject.Name,
-					strconv.FormatUint(playerMapping.playerObject.SteamID64, 10)}, utils.FloatSliceToString(tempData)...)
-			} else {
-				stringData = append(stringData, utils.FloatSliceToString(tempData)...)
+		for _, playerStatCalculator := range *ih.allPlayerStatCalculator {
+			tempHeader, tempData, err := playerStatCalculator.GetMatchStatistic(player.SteamID64)
+			if err != nil {
+				return stats, err
 			}
-
+			row.Values = append(row.Values, tempData...)
 			if firstPlayer {
-				data[0] = append(data[0], tempHeader...)
-				statsIDs = append(statsIDs, dbConn.InsertBaseStatistics(tempHeader))
+				stats.Headers = append(stats.Headers, tempHeader...)
+				stats.Columns = append(stats.Columns, playerStatCalculator.StatisticColumns()...)
 			}
-			dbConn.InsertStatisticsFacts(statsIDs[j], tempData, player.SteamID64, matchID)
-
 		}
-
-		framedData = append(framedData, stringData)
+		stats.Players = append(stats.Players, row)
 		firstPlayer = false
-
 	}
-	data = append(data, framedData...)
-	dbConn.Close()
-	return data
+	sort.Slice(stats.Players, func(a, b int) bool { return stats.Players[a].SteamID < stats.Players[b].SteamID })
+	return stats, stats.derive(ih.derivedStatistics)
 
 }
 
 func (ih *InfoGenerationHandler) FrameDoneHandler(e events.FrameDone) {
 
 	if ih.isReadyForProcessing() {
-		ih.processFrameEnd()
+		err := ih.processFrameEnd()
+		if err != nil {
+			ih.basicHandler.SetError(utils.StageGeneration, err)
+		}
 	}
 }
 
 func (ih *InfoGenerationHandler) isReadyForProcessing() bool {
 	parser := *(ih.basicHandler.parser)
 	gs := parser.GameState()
-	currentRoundTime := utils.GetRoundTime(parser, ih.basicHandler.roundStartTime, ih.basicHandler.tickRate)
+	currentRoundTime := utils.GetRoundTime(parser, ih.basicHandler.roundStartTime, ih.basicHandler.timingTickRate())
 	if !(gs == nil) &&
 		ih.basicHandler.isMatchStarted &&
 		!ih.basicHandler.roundFreezeTime && !ih.roundEndRegistered &&
@@ -332,18 +320,15 @@ func (ih *InfoGenerationHandler) isReadyForProcessing() bool {
 	return false
 }
 
-func (ih *InfoGenerationHandler) Setup(imgSize int, updateInterval float64, rootMatchPath string, demFileHash string,
+//Setup prepares the handler to write the outputs of the match to sinks
+func (ih *InfoGenerationHandler) Setup(updateInterval float64, hash string, sinks []MatchSink,
 	allIconGenerators *[]PeriodicIconGenerator, allTabularGenerators *[]PeriodicTabularGenerator,
 	allStatGenerators *[]StatGenerator, allPlayerStatCalculators *[]PlayerStatisticCalculator) error {
 
-	var mapGenerator map_builder.MapGenerator
-	mapGenerator.Setup(ih.basicHandler.mapMetadata, imgSize)
-	ih.mapGenerator = mapGenerator
 	ih.updateInterval = updateInterval
 	ih.matchData = new(matchData)
-	ih.rootMatchPath = rootMatchPath
-	ih.roundDirPath = rootMatchPath
-	ih.demFileHash = demFileHash
+	ih.result = &MatchResult{Metadata: MatchMetadata{Hash: hash}}
+	ih.sinks = sinks
 
 	ih.allIconGenerators = allIconGenerators
 	ih.allTabularGenerators = allTabularGenerators
@@ -353,13 +338,25 @@ func (ih *InfoGenerationHandler) Setup(imgSize int, updateInterval float64, root
 	return nil
 }
 
-func (ih *InfoGenerationHandler) processFrameEnd() {
+//SetDerivedStatistics sets the ratios added to the player statistics of rounds and of the match
+func (ih *InfoGenerationHandler) SetDerivedStatistics(keys []string) {
+	ih.derivedStatistics = keys
+}
+
+//AddSinks adds sinks the outputs are written to from the next round on
+func (ih *InfoGenerationHandler) AddSinks(sinks ...MatchSink) {
+	ih.sinks = append(ih.sinks, sinks...)
+}
+
+func (ih *InfoGenerationHandler) processFrameEnd() error {
 	var newIcons []map_builder.Icon
 
 	for _, iconGenerator := range *ih.allIconGenerators {
 		iconGenerator.Update()
 		tempIcons, err := iconGenerator.GetPeriodicIcons()
-		utils.CheckError(err)
+		if err != nil {
+			return err
+		}
 		newIcons = append(newIcons, tempIcons...)
 	}
 	ih.matchData.AddNewFrameGroup(ih.basicHandler.roundNumber - 1)
@@ -375,7 +372,9 @@ func (ih *InfoGenerationHandler) processFrameEnd() {
 	for _, tabularGenerator := range *ih.allTabularGenerators {
 		tabularGenerator.Update()
 		tempHeader, tempData, err = tabularGenerator.GetPeriodicTabularData()
-		utils.CheckError(err)
+		if err != nil {
+			return err
+		}
 		newHeaderTabular = append(newHeaderTabular, tempHeader...)
 		newTabular = append(newTabular, tempData...)
 	}
@@ -392,5 +391,6 @@ func (ih *InfoGenerationHandler) processFrameEnd() {
 
 	ih.basicHandler.frameGroup = ih.basicHandler.frameGroup + 1
 	parser := *(ih.basicHandler.parser)
-	ih.lastUpdate = utils.GetRoundTime(parser, ih.basicHandler.roundStartTime, ih.basicHandler.tickRate)
+	ih.lastUpdate = utils.GetRoundTime(parser, ih.basicHandler.roundStartTime, ih.basicHandler.timingTickRate())
+	return nil
 }
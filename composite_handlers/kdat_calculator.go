@@ -5,7 +5,6 @@ import (
 
 	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
-	utils "github.com/mrdbarros/csgo_analyze/utils"
 )
 
 type KDATCalculator struct {
@@ -32,8 +31,8 @@ func (kc *KDATCalculator) processKillTradeInformation(e events.Kill) {
 			for _, victimKill := range victimKills {
 				timeFromKill = currentTime - victimKill.timeOfDeath
 				if timeFromKill < kc.tradeIntervalLimit {
-					kc.addToPlayerStat(victimKill.victim, 1, "Was Traded")
-					kc.addToPlayerStat(e.Killer, 1, "Trades")
+					kc.addToPlayerStat(victimKill.victim, 1, statWasTraded)
+					kc.addToPlayerStat(e.Killer, 1, statTrades)
 				}
 			}
 
@@ -52,43 +51,76 @@ func (kc *KDATCalculator) Setup(tradeIntervalLimit float64) {
 	kc.tradeIntervalLimit = tradeIntervalLimit
 }
 
-func (kc *KDATCalculator) Register(bh *BasicHandler) error {
-	kc.basicHandler = bh
-	bh.RegisterRoundStartSubscriber(interface{}(kc).(RoundStartSubscriber))
-	bh.RegisterKillSubscriber(interface{}(kc).(KillSubscriber))
-	bh.RegisterRoundEndOfficialSubscriber(interface{}(kc).(RoundEndOfficialSubscriber))
-	bh.RegisterRoundFreezetimeEndSubscriber(interface{}(kc).(RoundFreezetimeEndSubscriber))
-	kc.baseStatsHeaders = []string{"Kills", "Kills_CT", "Kills_T",
-		"Assists", "Assists_T", "Assists_CT",
-		"Deaths", "Deaths_T", "Deaths_CT",
-		"Trades", "Trades_T", "Trades_CT",
-		"Was Traded", "Was Traded_T", "Was Traded_CT",
-		"KAST Sum", "KAST Sum_T", "KAST Sum_CT",
-		"1K", "1K_T", "1K_CT",
-		"2K", "2K_T", "2K_CT",
-		"3K", "3K_T", "3K_CT",
-		"4K", "4K_T", "4K_CT",
-		"5K", "5K_T", "5K_CT",
-		"Multikills", "Multikills_T", "Multikills_CT",
-		"First Kills", "First Kills_T", "First Kills_CT",
-		"First Kill Attempts", "First Kill Attempts_T", "First Kill Attempts_CT",
-		"Clutches", "Clutches_T", "Clutches_CT",
-		"Clutch Attempts", "Clutch Attempts_T", "Clutch Attempts_CT",
-		"1v1 Wins", "1v1 Wins_T", "1v1 Wins_CT",
-		"1v1 Attempts", "1v1 Attempts_T", "1v1 Attempts_CT",
-		"1v2 Wins", "1v2 Wins_T", "1v2 Wins_CT",
-		"1v2 Attempts", "1v2 Attempts_T", "1v2 Attempts_CT",
-		"1v3 Wins", "1v3 Wins_T", "1v3 Wins_CT",
-		"1v3 Attempts", "1v3 Attempts_T", "1v3 Attempts_CT",
-		"1v4 Wins", "1v4 Wins_T", "1v4 Wins_CT",
-		"1v4 Attempts", "1v4 Attempts_T", "1v4 Attempts_CT",
-		"1v5 Wins", "1v5 Wins_T", "1v5 Wins_CT",
-		"1v5 Attempts", "1v5 Attempts_T", "1v5 Attempts_CT",
-		"HS Kills", "HS Kills_T", "HS Kills_CT",
+const (
+	statKills             = "kills"
+	statAssists           = "assists"
+	statDeaths            = "deaths"
+	statTrades            = "trades"
+	statWasTraded         = "was_traded"
+	statKASTSum           = "kast_sum"
+	statMultikills        = "multikills"
+	statFirstKills        = "first_kills"
+	statFirstKillAttempts = "first_kill_attempts"
+	statClutches          = "clutches"
+	statClutchAttempts    = "clutch_attempts"
+	statHSKills           = "hs_kills"
+)
+
+//statKillsInRound is the key of the rounds with exactly kills kills, 1 to 5
+func statKillsInRound(kills int) string {
+	return "kills_" + strconv.Itoa(kills) + "k"
+}
+
+//statClutchWins and statClutchVsAttempts are the keys of the clutches against opponents players, 1 to 5
+func statClutchWins(opponents int) string {
+	return "clutch_1v" + strconv.Itoa(opponents) + "_wins"
+}
+
+func statClutchVsAttempts(opponents int) string {
+	return "clutch_1v" + strconv.Itoa(opponents) + "_attempts"
+}
+
+//kdatStatistics lists the statistics of the calculator, in the order of the outputs
+var kdatStatistics = RegisterStatistics(kdatDefinitions()...)
+
+func kdatDefinitions() []StatisticDefinition {
+	definitions := []StatisticDefinition{
+		sideSum(statKills, "Kills", UnitCount, "enemies killed, minus teammates killed and suicides"),
+		sideSum(statAssists, "Assists", UnitCount, "assists on enemy kills"),
+		sideSum(statDeaths, "Deaths", UnitCount, "deaths"),
+		sideSum(statTrades, "Trades", UnitCount, "kills of an enemy shortly after they killed a teammate"),
+		sideSum(statWasTraded, "Was Traded", UnitCount, "deaths traded by a teammate"),
+		sideSum(statKASTSum, "KAST Sum", UnitRounds, "rounds with a kill, an assist, a survival or a traded death")}
+	for kills := 1; kills <= maxTeamSize; kills++ {
+		definitions = append(definitions, sideSum(statKillsInRound(kills), strconv.Itoa(kills)+"K", UnitRounds,
+			"rounds with exactly "+strconv.Itoa(kills)+" kills"))
+	}
+	definitions = append(definitions,
+		sideSum(statMultikills, "Multikills", UnitRounds, "rounds with more than one kill"),
+		sideSum(statFirstKills, "First Kills", UnitRounds, "rounds where the player made the first kill"),
+		sideSum(statFirstKillAttempts, "First Kill Attempts", UnitRounds, "rounds where the player was in the first duel"),
+		sideSum(statClutches, "Clutches", UnitRounds, "clutches won"),
+		sideSum(statClutchAttempts, "Clutch Attempts", UnitRounds, "rounds where the player was the last one alive of the side"))
+	for opponents := 1; opponents <= maxTeamSize; opponents++ {
+		situation := "1v" + strconv.Itoa(opponents)
+		definitions = append(definitions,
+			sideSum(statClutchWins(opponents), situation+" Wins", UnitRounds, situation+" clutches won"),
+			sideSum(statClutchVsAttempts(opponents), situation+" Attempts", UnitRounds, situation+" clutches played"))
 	}
+	return append(definitions, sideSum(statHSKills, "HS Kills", UnitCount, "enemies killed with a headshot"))
+}
 
-	kc.defaultValues = make(map[string]float64)
-	return nil
+func (kc *KDATCalculator) Register(bh *BasicHandler) error {
+	err := kc.setupStatistics(bh, kdatStatistics...)
+	if err != nil {
+		return err
+	}
+	kc.subscriptions, err = bh.SubscribeAll(
+		Subscription{kc.RoundStartHandler, GateAlways},
+		Subscription{kc.KillHandler, GateRound},
+		Subscription{kc.RoundFinalizedHandler, GateAlways},
+		Subscription{kc.RoundFreezetimeEndHandler, GateAlways})
+	return err
 }
 
 func (kc *KDATCalculator) RoundStartHandler(e events.RoundStart) {
@@ -114,21 +146,26 @@ func (kc *KDATCalculator) processClutchSituation(winnerTeamName string) {
 		winnerTeam = common.TeamCounterTerrorists
 	}
 	//check for clutch
-	var numberOfOpponents string
+	var numberOfOpponents int
 	for _, clutchSituation := range kc.clutchSituations {
-		numberOfOpponents = strconv.Itoa(len(clutchSituation.opponents))
-		kc.setPlayerStat(clutchSituation.clutcher, 1, "Clutch Attempts")
-		kc.setPlayerStat(clutchSituation.clutcher, 1, "1v"+numberOfOpponents+" Attempts")
+		numberOfOpponents = len(clutchSituation.opponents)
+		isCounted := numberOfOpponents <= maxTeamSize //larger clutches only count in Clutches
+		kc.setPlayerStat(clutchSituation.clutcher, 1, statClutchAttempts)
+		if isCounted {
+			kc.setPlayerStat(clutchSituation.clutcher, 1, statClutchVsAttempts(numberOfOpponents))
+		}
 		if clutchSituation.clutcher.Team == winnerTeam {
-			kc.setPlayerStat(clutchSituation.clutcher, 1, "Clutches")
-
-			kc.setPlayerStat(clutchSituation.clutcher, 1, "1v"+numberOfOpponents+" Wins")
+			kc.setPlayerStat(clutchSituation.clutcher, 1, statClutches)
+			if isCounted {
+				kc.setPlayerStat(clutchSituation.clutcher, 1, statClutchWins(numberOfOpponents))
+			}
 		}
 	}
 
 }
 
-func (kc *KDATCalculator) RoundEndOfficialHandler(e events.RoundEndOfficial) {
+//RoundFinalizedHandler completes the statistics of the round, before the info generation reads them
+func (kc *KDATCalculator) RoundFinalizedHandler(e RoundFinalized) {
 
 	kc.processRoundEnd()
 }
@@ -138,27 +175,25 @@ func (kc *KDATCalculator) processRoundEnd() {
 	var playerAssists float64
 	var playerDeath float64
 	var playerWasTraded float64
-	var stringKills string
 	kc.processClutchSituation(kc.basicHandler.roundWinner)
 	roundID := len(kc.playerStats) - 1
 
 	for _, playerMapping := range kc.basicHandler.playerMappings[roundID] {
-		playerKills = kc.playerStats[roundID][playerMapping.playerObject.SteamID64][utils.IndexOf("Kills", kc.baseStatsHeaders)]
-		playerAssists = kc.playerStats[roundID][playerMapping.playerObject.SteamID64][utils.IndexOf("Assists", kc.baseStatsHeaders)]
-		playerDeath = kc.playerStats[roundID][playerMapping.playerObject.SteamID64][utils.IndexOf("Deaths", kc.baseStatsHeaders)]
-		playerWasTraded = kc.playerStats[roundID][playerMapping.playerObject.SteamID64][utils.IndexOf("Was Traded", kc.baseStatsHeaders)]
+		playerKills = kc.getPlayerStat(playerMapping.playerObject, statKills)
+		playerAssists = kc.getPlayerStat(playerMapping.playerObject, statAssists)
+		playerDeath = kc.getPlayerStat(playerMapping.playerObject, statDeaths)
+		playerWasTraded = kc.getPlayerStat(playerMapping.playerObject, statWasTraded)
 
 		if playerKills > 0 || playerAssists > 0 || playerDeath == 0 || playerWasTraded > 0 {
-			kc.setPlayerStat(playerMapping.playerObject, 1, "KAST Sum")
+			kc.setPlayerStat(playerMapping.playerObject, 1, statKASTSum)
 		}
 
-		if playerKills > 0 {
-			stringKills = strconv.FormatFloat(playerKills, 'f', -1, 64)
-			kc.setPlayerStat(playerMapping.playerObject, 1, stringKills+"K")
+		if playerKills > 0 && playerKills <= maxTeamSize {
+			kc.setPlayerStat(playerMapping.playerObject, 1, statKillsInRound(int(playerKills)))
 		}
 
 		if playerKills > 1 {
-			kc.setPlayerStat(playerMapping.playerObject, 1, "Multikills")
+			kc.setPlayerStat(playerMapping.playerObject, 1, statMultikills)
 		}
 
 	}
@@ -177,27 +212,27 @@ func (kc *KDATCalculator) addKDAInfo(e events.Kill) {
 		if e.Killer.Team != e.Victim.Team {
 			addAmmount = 1
 			if e.IsHeadshot {
-				kc.addToPlayerStat(e.Killer, 1, "HS Kills")
+				kc.addToPlayerStat(e.Killer, 1, statHSKills)
 			}
 		} else {
 			addAmmount = -1
 		}
-		kc.addToPlayerStat(e.Killer, addAmmount, "Kills")
+		kc.addToPlayerStat(e.Killer, addAmmount, statKills)
 
 	}
 
 	if e.Assister != nil {
 		if e.Assister.Team != e.Victim.Team {
-			kc.addToPlayerStat(e.Assister, 1, "Assists")
+			kc.addToPlayerStat(e.Assister, 1, statAssists)
 		}
 
 	}
 
 	if e.Victim != nil {
-		kc.addToPlayerStat(e.Victim, 1, "Deaths")
+		kc.addToPlayerStat(e.Victim, 1, statDeaths)
 		kc.addDeath(e.Victim)
 		if e.Killer == nil && e.Weapon.Type != common.EqBomb {
-			kc.addToPlayerStat(e.Victim, -1, "Kills")
+			kc.addToPlayerStat(e.Victim, -1, statKills)
 		}
 	}
 
@@ -224,9 +259,9 @@ func (kc *KDATCalculator) addDeath(victim *common.Player) {
 func (kc *KDATCalculator) addFirstDuelInfo(e events.Kill) {
 	if kc.isFirstDuel && e.Killer != nil && e.Victim != nil {
 		if e.Killer.Team != e.Victim.Team {
-			kc.setPlayerStat(e.Killer, 1, "First Kills")
-			kc.setPlayerStat(e.Killer, 1, "First Kill Attempts")
-			kc.setPlayerStat(e.Victim, 1, "First Kill Attempts")
+			kc.setPlayerStat(e.Killer, 1, statFirstKills)
+			kc.setPlayerStat(e.Killer, 1, statFirstKillAttempts)
+			kc.setPlayerStat(e.Victim, 1, statFirstKillAttempts)
 			kc.isFirstDuel = false
 		}
 
@@ -0,0 +1,155 @@
+package composite_handlers
+
+import (
+	"errors"
+	"strconv"
+)
+
+//MatchFormat describes the rounds of a match: a regulation of RegulationRounds played in two halves and,
+//while the score is tied at its end, overtimes of OvertimeRounds, also played in two halves.
+//Teams swap sides at each halftime and keep their side from the end of a period into the next overtime.
+type MatchFormat struct {
+	RegulationRounds   int `json:"regulationRounds"`   //mp_maxrounds: 30 for MR15, 24 for MR12, 16 for wingman
+	OvertimeRounds     int `json:"overtimeRounds"`     //mp_overtime_maxrounds, 0 when overtime is disabled and ties are draws
+	OvertimeStartMoney int `json:"overtimeStartMoney"` //mp_overtime_startmoney
+	MaxRounds          int `json:"maxRounds"`          //rounds after which a tied match ends as a draw, 0 for no limit
+}
+
+const (
+	MatchFormatConfig  = "config"  //set in the pipeline config
+	MatchFormatConVars = "convars" //read from the game rules of the demo
+	MatchFormatDefault = "default" //DefaultMatchFormat, the demo did not announce its format
+)
+
+//DefaultMatchFormat is MR15 with MR3 overtimes, the format of most competitive demos
+func DefaultMatchFormat() MatchFormat {
+	return MatchFormat{RegulationRounds: 30, OvertimeRounds: 6, OvertimeStartMoney: 10000}
+}
+
+//Validate checks that the rounds of the format can be split in halves
+func (mf MatchFormat) Validate() error {
+	if mf.RegulationRounds <= 0 || mf.RegulationRounds%2 != 0 {
+		return errors.New("regulationRounds must be positive and even")
+	}
+	if mf.OvertimeRounds < 0 || mf.OvertimeRounds%2 != 0 {
+		return errors.New("overtimeRounds must be even, 0 disables overtime")
+	}
+	if mf.OvertimeStartMoney < 0 {
+		return errors.New("overtimeStartMoney can not be negative")
+	}
+	if mf.MaxRounds != 0 && mf.MaxRounds < mf.RegulationRounds {
+		return errors.New("maxRounds must be 0 or at least regulationRounds")
+	}
+	return nil
+}
+
+//MatchFormatFromConVars reads the format from the game rules convars of a demo.
+//Convars missing or invalid keep their value in fallback. ok is false when no convar was used.
+func MatchFormatFromConVars(conVars map[string]string, fallback MatchFormat) (format MatchFormat, ok bool) {
+	format = fallback
+	readInt := func(name string, value *int) {
+		if i, err := strconv.Atoi(conVars[name]); err == nil {
+			*value = i
+			ok = true
+		}
+	}
+	readInt("mp_maxrounds", &format.RegulationRounds)
+	readInt("mp_overtime_maxrounds", &format.OvertimeRounds)
+	readInt("mp_overtime_startmoney", &format.OvertimeStartMoney)
+	if enabled, found := conVars["mp_overtime_enable"]; found {
+		ok = true
+		if enabled == "0" {
+			format.OvertimeRounds = 0
+		} else if format.OvertimeRounds == 0 {
+			format.OvertimeRounds = DefaultMatchFormat().OvertimeRounds
+		}
+	}
+	if format.Validate() != nil {
+		return fallback, false
+	}
+	return format, ok
+}
+
+//IsOvertime reports whether round, starting at 1, is played in overtime
+func (mf MatchFormat) IsOvertime(round int) bool {
+	return round > mf.RegulationRounds
+}
+
+//Half returns the period of round: "1" or "2" for the halves of the regulation, "ot" for the overtimes
+func (mf MatchFormat) Half(round int) string {
+	switch {
+	case mf.IsOvertime(round):
+		return "ot"
+	case round > mf.RegulationRounds/2:
+		return "2"
+	}
+	return "1"
+}
+
+//IsHalfStart reports whether round opens a half of the regulation or of an overtime,
+//where the money and the loss bonus of both teams are reset
+func (mf MatchFormat) IsHalfStart(round int) bool {
+	if !mf.IsOvertime(round) {
+		return round == 1 || round == mf.RegulationRounds/2+1
+	}
+	return mf.OvertimeRounds > 0 && (round-mf.RegulationRounds-1)%(mf.OvertimeRounds/2) == 0
+}
+
+//SidesSwapped reports whether the team that started the match as terrorists plays round as counter-terrorists
+func (mf MatchFormat) SidesSwapped(round int) bool {
+	if round <= mf.RegulationRounds/2 {
+		return false
+	}
+	if !mf.IsOvertime(round) || mf.OvertimeRounds == 0 {
+		return true
+	}
+	//one swap at the regulation halftime, then one at the halftime of each overtime
+	overtimeRound := (round - mf.RegulationRounds - 1) % mf.OvertimeRounds
+	swaps := 1 + (round-mf.RegulationRounds-1)/mf.OvertimeRounds
+	if overtimeRound >= mf.OvertimeRounds/2 {
+		swaps++
+	}
+	return swaps%2 == 1
+}
+
+//RoundsToWin returns the rounds a team must win to take a match decided in the period of round
+func (mf MatchFormat) RoundsToWin(round int) int {
+	if !mf.IsOvertime(round) || mf.OvertimeRounds == 0 {
+		return mf.RegulationRounds/2 + 1
+	}
+	overtime := (round - mf.RegulationRounds - 1) / mf.OvertimeRounds
+	return mf.RegulationRounds/2 + overtime*mf.OvertimeRounds/2 + mf.OvertimeRounds/2 + 1
+}
+
+//PeriodEnd returns the last round of the period of round, the rounds played by a match that is not decided before
+func (mf MatchFormat) PeriodEnd(round int) int {
+	end := 2*mf.RoundsToWin(round) - 2
+	if mf.MaxRounds > 0 && end > mf.MaxRounds {
+		end = mf.MaxRounds
+	}
+	if end < round { //rounds played past the format, as in demos of a misdetected format
+		end = round
+	}
+	return end
+}
+
+//IsMatchOver reports whether the match ends with the given scores of both teams
+func (mf MatchFormat) IsMatchOver(score int, otherScore int) bool {
+	played := score + otherScore
+	if played == 0 {
+		return false
+	}
+	if score >= mf.RoundsToWin(played) || otherScore >= mf.RoundsToWin(played) {
+		return true
+	}
+	if mf.MaxRounds > 0 && played >= mf.MaxRounds {
+		return true
+	}
+	//a tie at the end of regulation without overtime is a draw
+	return mf.OvertimeRounds == 0 && played >= mf.RegulationRounds
+}
+
+//IsMatchPoint reports whether a team with score wins the match by winning the next round against otherScore
+func (mf MatchFormat) IsMatchPoint(score int, otherScore int) bool {
+	return score+1 > otherScore && mf.IsMatchOver(score+1, otherScore)
+}
@@ -0,0 +1,128 @@
+package composite_handlers
+
+import "testing"
+
+func TestMatchFormatRounds(t *testing.T) {
+	mr15 := DefaultMatchFormat()
+	mr12 := MatchFormat{RegulationRounds: 24, OvertimeRounds: 6, OvertimeStartMoney: 12500}
+	noOvertime := MatchFormat{RegulationRounds: 30}
+	wingman := MatchFormat{RegulationRounds: 16, OvertimeRounds: 0}
+
+	overCases := []struct {
+		name     string
+		format   MatchFormat
+		score    int
+		other    int
+		over     bool
+		matchPts bool //whether score is on match point
+	}{
+		{"mr15 regulation win", mr15, 16, 10, true, false},
+		{"mr15 match point", mr15, 15, 10, false, true},
+		{"mr15 tie goes to overtime", mr15, 15, 15, false, false},
+		{"mr15 overtime match point", mr15, 18, 17, false, true},
+		{"mr15 overtime win", mr15, 19, 17, true, false},
+		{"mr15 second overtime", mr15, 18, 18, false, false},
+		{"mr15 second overtime win", mr15, 22, 20, true, false},
+		{"mr12 regulation win", mr12, 13, 11, true, false},
+		{"mr12 match point", mr12, 12, 11, false, true},
+		{"mr12 overtime win", mr12, 16, 14, true, false},
+		{"draw without overtime", noOvertime, 15, 15, true, false},
+		{"match point for a draw", noOvertime, 14, 15, false, false},
+		{"wingman win", wingman, 9, 3, true, false},
+	}
+	for _, c := range overCases {
+		if over := c.format.IsMatchOver(c.score, c.other); over != c.over {
+			t.Errorf("%s: IsMatchOver(%d, %d) = %v, want %v", c.name, c.score, c.other, over, c.over)
+		}
+		if !c.over {
+			if matchPoint := c.format.IsMatchPoint(c.score, c.other); matchPoint != c.matchPts {
+				t.Errorf("%s: IsMatchPoint(%d, %d) = %v, want %v", c.name, c.score, c.other, matchPoint, c.matchPts)
+			}
+		}
+	}
+
+	swapCases := []struct {
+		format  MatchFormat
+		round   int
+		swapped bool
+	}{
+		{mr15, 15, false},
+		{mr15, 16, true},
+		{mr15, 30, true},
+		{mr15, 31, true}, //overtime starts on the sides of the second half
+		{mr15, 34, false},
+		{mr15, 37, false},
+		{mr15, 40, true},
+		{mr12, 12, false},
+		{mr12, 13, true},
+		{mr12, 28, false},
+		{wingman, 9, true},
+	}
+	for _, c := range swapCases {
+		if swapped := c.format.SidesSwapped(c.round); swapped != c.swapped {
+			t.Errorf("%+v: SidesSwapped(%d) = %v, want %v", c.format, c.round, swapped, c.swapped)
+		}
+	}
+
+	for _, c := range []struct {
+		format    MatchFormat
+		round     int
+		halfStart bool
+	}{
+		{mr15, 1, true},
+		{mr15, 2, false},
+		{mr15, 16, true},
+		{mr15, 31, true},
+		{mr15, 33, false},
+		{mr15, 34, true},
+		{mr15, 37, true},
+		{mr12, 13, true},
+		{wingman, 9, true},
+		{wingman, 17, false},
+	} {
+		if halfStart := c.format.IsHalfStart(c.round); halfStart != c.halfStart {
+			t.Errorf("%+v: IsHalfStart(%d) = %v, want %v", c.format, c.round, halfStart, c.halfStart)
+		}
+	}
+
+	for _, c := range []struct {
+		format MatchFormat
+		round  int
+		end    int
+	}{
+		{mr15, 1, 30},
+		{mr15, 30, 30},
+		{mr15, 31, 36},
+		{mr15, 37, 42},
+		{mr12, 20, 24},
+		{wingman, 3, 16},
+		{noOvertime, 30, 30},
+		{MatchFormat{RegulationRounds: 30, OvertimeRounds: 6, MaxRounds: 33}, 31, 33},
+	} {
+		if end := c.format.PeriodEnd(c.round); end != c.end {
+			t.Errorf("%+v: PeriodEnd(%d) = %d, want %d", c.format, c.round, end, c.end)
+		}
+	}
+}
+
+func TestMatchFormatFromConVars(t *testing.T) {
+	format, ok := MatchFormatFromConVars(map[string]string{"mp_maxrounds": "24", "mp_overtime_enable": "1",
+		"mp_overtime_startmoney": "12500"}, DefaultMatchFormat())
+	if !ok || format != (MatchFormat{RegulationRounds: 24, OvertimeRounds: 6, OvertimeStartMoney: 12500}) {
+		t.Errorf("MR12 convars: got %+v, %v", format, ok)
+	}
+
+	format, ok = MatchFormatFromConVars(map[string]string{"mp_maxrounds": "16", "mp_overtime_enable": "0"}, DefaultMatchFormat())
+	if !ok || format.RegulationRounds != 16 || format.OvertimeRounds != 0 {
+		t.Errorf("wingman convars: got %+v, %v", format, ok)
+	}
+
+	format, ok = MatchFormatFromConVars(map[string]string{"mp_maxrounds": "15"}, DefaultMatchFormat())
+	if ok || format != DefaultMatchFormat() {
+		t.Errorf("odd regulation rounds should keep the fallback: got %+v, %v", format, ok)
+	}
+
+	if _, ok = MatchFormatFromConVars(nil, DefaultMatchFormat()); ok {
+		t.Error("no convars should not be reported as detected")
+	}
+}
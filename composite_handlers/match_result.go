@@ -0,0 +1,80 @@
+package composite_handlers
+
+import (
+	"time"
+
+	map_builder "github.com/mrdbarros/csgo_analyze/map_builder"
+)
+
+//MatchMetadata describes a match and the demo it was parsed from
+type MatchMetadata struct {
+	FileName                string         `json:"fileName"`
+	Hash                    string         `json:"hash"`
+	Map                     string         `json:"map"`
+	MatchDatetime           time.Time      `json:"matchDatetime"`
+	TickRate                float64        `json:"tickRate"`
+	TickRateSource          string         `json:"tickRateSource"`
+	DetectedTickRate        float64        `json:"detectedTickRate"`
+	DetectedTickRateSource  string         `json:"detectedTickRateSource"`
+	MatchFormat             MatchFormat    `json:"matchFormat"`
+	MatchFormatSource       string         `json:"matchFormatSource"`
+	GameMode                GameMode       `json:"gameMode"`
+	DemoType                string         `json:"demoType"` //"gotv" or "pov"
+	TeamSize                int            `json:"teamSize"` //players of each side
+	TerroristFirstTeamScore int            `json:"terroristFirstTeamScore"`
+	CTFirstTeamScore        int            `json:"ctFirstTeamScore"`
+	Teams                   []Team         `json:"teams"` //TeamA then TeamB, empty before the first valid round
+	Substitutions           []Substitution `json:"substitutions"`
+	Overflows               []Overflow     `json:"overflows"`   //players left out of the rounds they had no slot in
+	HasRestores             bool           `json:"hasRestores"` //rounds were played again after a technical pause or a backup restore
+	Rollbacks               []Rollback     `json:"rollbacks"`
+}
+
+//PlayerStatistics holds one row of statistics per player, in the order of Headers
+type PlayerStatistics struct {
+	Headers []string
+	Columns []StatisticColumn //definition of the statistic of each header
+	Players []PlayerStatisticsRow
+}
+
+type PlayerStatisticsRow struct {
+	SteamID uint64
+	Name    string
+	Slot    int //slot of the player in the round, -1 for match statistics
+	Values  []float64
+}
+
+//RoundResult holds everything generated for a round
+type RoundResult struct {
+	Number           int    //round number, starting at 1
+	Score            string //score at the start of the round, also the name of the round directory
+	Winner           string //"t" or "ct"
+	TTeam            string //id of the team on the terrorist side, TeamA or TeamB
+	CTTeam           string
+	Roster           []RosterSlot //slots held by the players of both teams, including the disconnected ones
+	TeamSize         int          //slots of each side in the round, player slots go from 0 to twice the team size - 1
+	PeriodicHeaders  []string
+	PeriodicFrames   [][]float64          //one row of periodic data every update interval
+	Icons            [][]map_builder.Icon //icons of each periodic frame
+	StatisticHeaders []string
+	Statistics       []float64 //statistics of the stat generators
+	PlayerStatistics PlayerStatistics
+}
+
+//MatchResult holds everything generated for a match
+type MatchResult struct {
+	Metadata         MatchMetadata
+	Rounds           []RoundResult
+	Finished         bool             //whether the demo reached the end of the match
+	Progress         float64          //fraction of the demo parsed, estimated from the demo header
+	PlayerStatistics PlayerStatistics //match statistics, only set for finished matches
+	DiscardedRounds  []DiscardedRound //finished rounds discarded by the rollbacks, for audit
+}
+
+//MatchSink persists the outputs of a match as they are generated
+type MatchSink interface {
+	//WriteRound is called when a round ends. A round may be written again after a rollback.
+	WriteRound(match *MatchResult, round *RoundResult) error
+	//WriteMatch is called once the whole demo has been parsed
+	WriteMatch(match *MatchResult) error
+}
@@ -0,0 +1,221 @@
+package composite_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+//PipelineConfig declares which composite handlers run for each demo and how they are set up.
+//Handlers are referenced by their registry name; a name listed under several roles is
+//instantiated and registered only once.
+type PipelineConfig struct {
+	PlayerStatCalculators []string `json:"playerStatCalculators"`
+	TabularGenerators     []string `json:"tabularGenerators"`
+	IconGenerators        []string `json:"iconGenerators"`
+	StatGenerators        []string `json:"statGenerators"`
+
+	TradeInterval  float64 `json:"tradeInterval"`  //max seconds between two kills for them to count as a trade
+	UpdateInterval float64 `json:"updateInterval"` //# of seconds between framegroups
+	ImgSize        int     `json:"imgSize"`
+
+	MatchFormat *MatchFormat `json:"matchFormat,omitempty"` //detected from each demo when not set
+
+	//DerivedStatistics lists ratios added to the player statistics. Those whose terms no calculator
+	//of the pipeline computes are left out.
+	DerivedStatistics []string `json:"derivedStatistics"`
+}
+
+//DefaultIconGenerators lists the icon generators used when icon generation is requested
+//without a pipeline config
+var DefaultIconGenerators = []string{"popping_grenade", "bomb", "player_periodic_info", "flash_usage"}
+
+//DefaultPipelineConfig returns the full statistics and tabular pipeline, without icons
+func DefaultPipelineConfig() PipelineConfig {
+	return PipelineConfig{
+		PlayerStatCalculators: []string{BasicHandlerName, "kdat", "adr", "flash_usage", "utility", "economy", "bomb", "rating"},
+		TabularGenerators:     []string{BasicHandlerName, "bomb", "player_periodic_info", "economy"},
+		StatGenerators:        []string{"economy"},
+		TradeInterval:         3.0,
+		UpdateInterval:        2.0,
+		ImgSize:               800,
+		DerivedStatistics:     DefaultDerivedStatistics,
+	}
+}
+
+//LoadPipelineConfig reads a json pipeline config. Parameters missing from the file keep their default values.
+func LoadPipelineConfig(path string) (PipelineConfig, error) {
+	config := DefaultPipelineConfig()
+	f, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&config)
+	if err != nil {
+		return config, fmt.Errorf("pipeline config %s: %v", path, err)
+	}
+	err = config.Validate()
+	if err != nil {
+		return config, fmt.Errorf("pipeline config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+//Validate checks that every listed handler exists, implements the role it is listed under
+//and finds the handlers it reads its inputs from. The basic handler is always registered.
+func (pc PipelineConfig) Validate() error {
+	if pc.UpdateInterval <= 0 {
+		return errors.New("updateInterval must be positive")
+	}
+	if pc.ImgSize <= 0 {
+		return errors.New("imgSize must be positive")
+	}
+	if pc.MatchFormat != nil {
+		if err := pc.MatchFormat.Validate(); err != nil {
+			return fmt.Errorf("matchFormat: %v", err)
+		}
+	}
+	for _, key := range pc.DerivedStatistics {
+		if err := checkDerivedStatistic(key); err != nil {
+			return fmt.Errorf("derivedStatistics: %v", err)
+		}
+	}
+	handlers := make(map[string]CompositeEventHandler)
+	err := pc.forEachRole(func(name string, role string) error {
+		handler, err := pc.instantiate(name, handlers, new(BasicHandler))
+		if err != nil {
+			return err
+		}
+		return checkRole(name, role, handler)
+	})
+	if err != nil {
+		return err
+	}
+	for name, handler := range handlers {
+		dependent, ok := handler.(interface{ requiredHandlers() []string })
+		if !ok {
+			continue
+		}
+		for _, required := range dependent.requiredHandlers() {
+			if _, ok := handlers[required]; !ok && required != BasicHandlerName {
+				return fmt.Errorf("handler %q needs handler %q in the pipeline", name, required)
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	rolePlayerStatCalculator = "playerStatCalculators"
+	roleTabularGenerator     = "tabularGenerators"
+	roleIconGenerator        = "iconGenerators"
+	roleStatGenerator        = "statGenerators"
+)
+
+func (pc PipelineConfig) forEachRole(fn func(name string, role string) error) error {
+	roles := []struct {
+		role  string
+		names []string
+	}{
+		{rolePlayerStatCalculator, pc.PlayerStatCalculators},
+		{roleTabularGenerator, pc.TabularGenerators},
+		{roleIconGenerator, pc.IconGenerators},
+		{roleStatGenerator, pc.StatGenerators},
+	}
+	for _, r := range roles {
+		for _, name := range r.names {
+			if err := fn(name, r.role); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//instantiate returns the handler for name, creating it only on first use
+func (pc PipelineConfig) instantiate(name string, handlers map[string]CompositeEventHandler,
+	basicHandler *BasicHandler) (CompositeEventHandler, error) {
+	if name == BasicHandlerName {
+		return basicHandler, nil
+	}
+	if handler, ok := handlers[name]; ok {
+		return handler, nil
+	}
+	factory, err := getHandlerFactory(name)
+	if err != nil {
+		return nil, err
+	}
+	handler := factory(HandlerParams{TradeInterval: pc.TradeInterval})
+	handlers[name] = handler
+	return handler, nil
+}
+
+func checkRole(name string, role string, handler CompositeEventHandler) error {
+	var ok bool
+	switch role {
+	case rolePlayerStatCalculator:
+		_, ok = handler.(PlayerStatisticCalculator)
+	case roleTabularGenerator:
+		_, ok = handler.(PeriodicTabularGenerator)
+	case roleIconGenerator:
+		_, ok = handler.(PeriodicIconGenerator)
+	case roleStatGenerator:
+		_, ok = handler.(StatGenerator)
+	}
+	if !ok {
+		return fmt.Errorf("handler %q can not be used in %s", name, role)
+	}
+	return nil
+}
+
+//Pipeline holds the registered handlers of a demo, grouped by the role they play in info generation
+type Pipeline struct {
+	PlayerStatCalculators []PlayerStatisticCalculator
+	TabularGenerators     []PeriodicTabularGenerator
+	IconGenerators        []PeriodicIconGenerator
+	StatGenerators        []StatGenerator
+	DerivedStatistics     []string
+}
+
+//BuildPipeline instantiates the handlers listed in the config and attaches them to basicHandler.
+//basicHandler must already be set up, BasicHandler.Close detaches them.
+func BuildPipeline(basicHandler *BasicHandler, config PipelineConfig) (*Pipeline, error) {
+	pipeline := &Pipeline{DerivedStatistics: config.DerivedStatistics}
+	handlers := make(map[string]CompositeEventHandler)
+	err := config.forEachRole(func(name string, role string) error {
+		_, alreadyRegistered := handlers[name]
+		handler, err := config.instantiate(name, handlers, basicHandler)
+		if err != nil {
+			return err
+		}
+		if err = checkRole(name, role, handler); err != nil {
+			return err
+		}
+		if !alreadyRegistered && name != BasicHandlerName {
+			if err = basicHandler.Attach(handler); err != nil {
+				return err
+			}
+		}
+
+		switch role {
+		case rolePlayerStatCalculator:
+			pipeline.PlayerStatCalculators = append(pipeline.PlayerStatCalculators, handler.(PlayerStatisticCalculator))
+		case roleTabularGenerator:
+			pipeline.TabularGenerators = append(pipeline.TabularGenerators, handler.(PeriodicTabularGenerator))
+		case roleIconGenerator:
+			pipeline.IconGenerators = append(pipeline.IconGenerators, handler.(PeriodicIconGenerator))
+		case roleStatGenerator:
+			pipeline.StatGenerators = append(pipeline.StatGenerators, handler.(StatGenerator))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,35 @@
+package composite_handlers
+
+import "testing"
+
+func TestPipelineConfigValidate(t *testing.T) {
+	config := DefaultPipelineConfig()
+	config.IconGenerators = DefaultIconGenerators
+	if err := config.Validate(); err != nil {
+		t.Fatalf("default config should be valid: %v", err)
+	}
+
+	config = DefaultPipelineConfig()
+	config.PlayerStatCalculators = append(config.PlayerStatCalculators, "not_a_handler")
+	if err := config.Validate(); err == nil {
+		t.Error("unknown handler name should be rejected")
+	}
+
+	config = DefaultPipelineConfig()
+	config.IconGenerators = []string{"adr"}
+	if err := config.Validate(); err == nil {
+		t.Error("handler listed under a role it does not implement should be rejected")
+	}
+
+	config = DefaultPipelineConfig()
+	config.MatchFormat = &MatchFormat{RegulationRounds: 25}
+	if err := config.Validate(); err == nil {
+		t.Error("match format with odd regulation rounds should be rejected")
+	}
+
+	config = DefaultPipelineConfig()
+	config.PlayerStatCalculators = []string{BasicHandlerName, "kdat", "rating"}
+	if err := config.Validate(); err == nil {
+		t.Error("rating without the adr calculator should be rejected")
+	}
+}
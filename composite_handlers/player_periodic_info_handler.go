@@ -27,14 +27,19 @@ func (ph *PlayerPeriodicInfoHandler) Register(bh *BasicHandler) error {
 	return nil
 }
 
+//Unregister does nothing, the handler reads the game state without subscribing to events
+func (ph *PlayerPeriodicInfoHandler) Unregister() error {
+	return nil
+}
+
 func (ph *PlayerPeriodicInfoHandler) Update() {
 	var periodicGatherers []IPeriodicPlayerInfoGatherer
 	for _, iconGatherer := range ph.periodicPlayerIconGatherer {
-		iconGatherer.Init()
+		iconGatherer.Init(ph.basicHandler.teamSize)
 		periodicGatherers = append(periodicGatherers, iconGatherer)
 	}
 	for _, tabularGatherer := range ph.periodicTabularInfoGatherer {
-		tabularGatherer.Init()
+		tabularGatherer.Init(ph.basicHandler.teamSize)
 		periodicGatherers = append(periodicGatherers, tabularGatherer)
 	}
 
@@ -79,7 +84,7 @@ func (ph *PlayerPeriodicInfoHandler) GetPeriodicIcons() ([]map_builder.Icon, err
 }
 
 type IPlayersInfoGatherer interface {
-	Init()
+	Init(teamSize int)
 }
 
 type IPeriodicPlayerInfoGatherer interface {
@@ -103,19 +108,35 @@ type playersTabularInfoGatherer struct {
 	playersTabInfo []float64
 }
 
-type hpGatherer struct {
-	playersInfoGatherer playersTabularInfoGatherer
+//setup lays out one column per player slot and field, "t_1_field" to "ct_<teamSize>_field".
+//A field is named after the side with the fieldName func, an empty name is the bare slot.
+func (pg *playersTabularInfoGatherer) setup(teamSize int, fields []string, fieldName func(side string, field string) string) {
+	pg.header = nil
+	for _, side := range []string{"t", "ct"} {
+		for slot := 1; slot <= teamSize; slot++ {
+			for _, field := range fields {
+				column := side + "_" + strconv.Itoa(slot)
+				if name := fieldName(side, field); name != "" {
+					column += "_" + name
+				}
+				pg.header = append(pg.header, column)
+			}
+		}
+	}
+	pg.sizePerPlayer = len(fields)
+	pg.playersTabInfo = make([]float64, len(pg.header))
 }
 
-func (hg *hpGatherer) Init() {
-	hg.playersInfoGatherer.header = []string{"t_1", "t_2", "t_3", "t_4", "t_5", "ct_1", "ct_2", "ct_3", "ct_4", "ct_5"}
+func sameFieldName(side string, field string) string {
+	return field
+}
 
-	hg.playersInfoGatherer.sizePerPlayer = len(hg.playersInfoGatherer.header) / 10
-	hg.playersInfoGatherer.playersTabInfo = nil
-	for range hg.playersInfoGatherer.header {
-		hg.playersInfoGatherer.playersTabInfo = append(hg.playersInfoGatherer.playersTabInfo, 0.0)
-	}
+type hpGatherer struct {
+	playersInfoGatherer playersTabularInfoGatherer
+}
 
+func (hg *hpGatherer) Init(teamSize int) {
+	hg.playersInfoGatherer.setup(teamSize, []string{""}, sameFieldName)
 }
 
 func (hg *hpGatherer) updatePlayer(player *common.Player, basePos int) {
@@ -132,16 +153,8 @@ type currentFlashTimeGatherer struct {
 	playersInfoGatherer playersTabularInfoGatherer
 }
 
-func (hg *currentFlashTimeGatherer) Init() {
-	hg.playersInfoGatherer.header = []string{"t_1_blindtime", "t_2_blindtime", "t_3_blindtime", "t_4_blindtime", "t_5_blindtime",
-		"ct_1_blindtime", "ct_2_blindtime", "ct_3_blindtime", "ct_4_blindtime", "ct_5_blindtime"}
-
-	hg.playersInfoGatherer.sizePerPlayer = len(hg.playersInfoGatherer.header) / 10
-	hg.playersInfoGatherer.playersTabInfo = nil
-	for range hg.playersInfoGatherer.header {
-		hg.playersInfoGatherer.playersTabInfo = append(hg.playersInfoGatherer.playersTabInfo, 0.0)
-	}
-
+func (hg *currentFlashTimeGatherer) Init(teamSize int) {
+	hg.playersInfoGatherer.setup(teamSize, []string{"blindtime"}, sameFieldName)
 }
 
 func (hg *currentFlashTimeGatherer) updatePlayer(player *common.Player, basePos int) {
@@ -159,25 +172,17 @@ type weaponsGatherer struct {
 	playersInfoGatherer playersTabularInfoGatherer
 }
 
-func (wg *weaponsGatherer) Init() {
-	wg.playersInfoGatherer.header = []string{
-		"t_1_mainweapon", "t_1_secweapon", "t_1_flashbangs", "t_1_hassmoke", "t_1_hasmolotov", "t_1_hashe", "t_1_armor", "t_1_hashelmet", "t_1_hasc4",
-		"t_2_mainweapon", "t_2_secweapon", "t_2_flashbangs", "t_2_hassmoke", "t_2_hasmolotov", "t_2_hashe", "t_2_armor", "t_2_hashelmet", "t_2_hasc4",
-		"t_3_mainweapon", "t_3_secweapon", "t_3_flashbangs", "t_3_hassmoke", "t_3_hasmolotov", "t_3_hashe", "t_3_armor", "t_3_hashelmet", "t_3_hasc4",
-		"t_4_mainweapon", "t_4_secweapon", "t_4_flashbangs", "t_4_hassmoke", "t_4_hasmolotov", "t_4_hashe", "t_4_armor", "t_4_hashelmet", "t_4_hasc4",
-		"t_5_mainweapon", "t_5_secweapon", "t_5_flashbangs", "t_5_hassmoke", "t_5_hasmolotov", "t_5_hashe", "t_5_armor", "t_5_hashelmet", "t_5_hasc4",
-		"ct_1_mainweapon", "ct_1_secweapon", "ct_1_flashbangs", "ct_1_hassmoke", "ct_1_hasmolotov", "ct_1_hashe", "ct_1_armor", "ct_1_hashelmet", "ct_1_hasdefusekit",
-		"ct_2_mainweapon", "ct_2_secweapon", "ct_2_flashbangs", "ct_2_hassmoke", "ct_2_hasmolotov", "ct_2_hashe", "ct_2_armor", "ct_2_hashelmet", "ct_2_hasdefusekit",
-		"ct_3_mainweapon", "ct_3_secweapon", "ct_3_flashbangs", "ct_3_hassmoke", "ct_3_hasmolotov", "ct_3_hashe", "ct_3_armor", "ct_3_hashelmet", "ct_3_hasdefusekit",
-		"ct_4_mainweapon", "ct_4_secweapon", "ct_4_flashbangs", "ct_4_hassmoke", "ct_4_hasmolotov", "ct_4_hashe", "ct_4_armor", "ct_4_hashelmet", "ct_4_hasdefusekit",
-		"ct_5_mainweapon", "ct_5_secweapon", "ct_5_flashbangs", "ct_5_hassmoke", "ct_5_hasmolotov", "ct_5_hashe", "ct_5_armor", "ct_5_hashelmet", "ct_5_hasdefusekit"}
-
-	wg.playersInfoGatherer.sizePerPlayer = len(wg.playersInfoGatherer.header) / 10
-	wg.playersInfoGatherer.playersTabInfo = nil
-	for range wg.playersInfoGatherer.header {
-		wg.playersInfoGatherer.playersTabInfo = append(wg.playersInfoGatherer.playersTabInfo, 0)
-	}
-
+func (wg *weaponsGatherer) Init(teamSize int) {
+	fields := []string{"mainweapon", "secweapon", "flashbangs", "hassmoke", "hasmolotov", "hashe", "armor", "hashelmet", "hasbombitem"}
+	wg.playersInfoGatherer.setup(teamSize, fields, func(side string, field string) string {
+		if field != "hasbombitem" {
+			return field
+		}
+		if side == "t" {
+			return "hasc4"
+		}
+		return "hasdefusekit"
+	})
 }
 
 func (wg *weaponsGatherer) updatePlayer(player *common.Player, basePos int) {
@@ -241,10 +246,12 @@ type playersIconGatherer struct {
 
 type basicPlayerPositionGatherer struct {
 	playersIconGatherer playersIconGatherer
+	teamSize            int
 }
 
-func (bg *basicPlayerPositionGatherer) Init() {
+func (bg *basicPlayerPositionGatherer) Init(teamSize int) {
 	bg.playersIconGatherer.playersIcons = nil
+	bg.teamSize = teamSize
 }
 
 func (bg *basicPlayerPositionGatherer) Setup(basicHandler *BasicHandler) {
@@ -257,7 +264,7 @@ func (bg *basicPlayerPositionGatherer) updatePlayer(player *common.Player, baseP
 		x, y := player.Position().X, player.Position().Y
 		var icon string
 
-		if basePos/5 == 1 {
+		if basePos/bg.teamSize == 1 {
 
 			icon = "ct_"
 			if player.HasDefuseKit() {
@@ -269,7 +276,7 @@ func (bg *basicPlayerPositionGatherer) updatePlayer(player *common.Player, baseP
 			icon = "terrorist_"
 
 		}
-		playerNumber := basePos%5 + 1 //count 1-5 tr, 6-10 ct
+		playerNumber := basePos%bg.teamSize + 1 //count 1 to team size on each side
 
 		newIcon := map_builder.Icon{X: x, Y: y, IconName: icon + strconv.Itoa(playerNumber), Rotate: float64(player.ViewDirectionX())} //t or ct icon
 		bg.playersIconGatherer.playersIcons = append(bg.playersIconGatherer.playersIcons, newIcon)
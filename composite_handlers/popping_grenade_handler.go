@@ -10,6 +10,7 @@ type PoppingGrenadeHandler struct {
 	basicHandler   *BasicHandler
 	activeGrenades []*grenadeTracker
 	baseIcons      map[common.EquipmentType]map_builder.Icon
+	subscriptions  []SubscriptionID
 }
 
 func (ph *PoppingGrenadeHandler) Update() {
@@ -18,8 +19,16 @@ func (ph *PoppingGrenadeHandler) Update() {
 
 func (ph *PoppingGrenadeHandler) Register(bh *BasicHandler) error {
 	ph.basicHandler = bh
-	bh.RegisterGrenadeEventIfSubscriber(interface{}(ph).(GrenadeEventIfSubscriber))
-	bh.RegisterRoundStartSubscriber(interface{}(ph).(RoundStartSubscriber))
+	var err error
+	ph.subscriptions, err = bh.SubscribeAll(
+		Subscription{ph.GrenadeEventIfHandler, GateRound},
+		Subscription{ph.RoundStartHandler, GateAlways})
+	return err
+}
+
+func (ph *PoppingGrenadeHandler) Unregister() error {
+	ph.basicHandler.Unsubscribe(ph.subscriptions...)
+	ph.subscriptions = nil
 	return nil
 }
 
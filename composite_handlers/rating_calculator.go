@@ -0,0 +1,183 @@
+package composite_handlers
+
+import "fmt"
+
+//RatingCalculator rates players from the statistics of the other calculators of the pipeline:
+//it needs the basic handler for the rounds, kdat for kills, deaths, assists, KAST and multikills and adr for damage.
+//
+//Rating 1.0 is the formula published by HLTV:
+//
+//	(kills/rounds/0.679 + 0.7*survived rounds/rounds/0.317 + multikill rounds rating/1.277)/2.7
+//
+//where the multikill rounds rating is (1K + 4*2K + 9*3K + 16*4K + 25*5K)/rounds.
+//
+//HLTV has not published Rating 2.0, it is approximated by the community regression on KAST %, kills, deaths,
+//assists and damage per round:
+//
+//	0.0073*KAST % + 0.3591*KPR - 0.5329*DPR + 0.2372*Impact + 0.0032*ADR + 0.1587
+//
+//with Impact = 2.13*KPR + 0.42*assists per round - 0.41.
+//
+//Ratings of a round are rated over that round alone, ratings of the match over the totals of the match.
+type RatingCalculator struct {
+	statisticHolder
+	sources map[string]*statisticHolder //holder of each input, found on first use
+}
+
+const (
+	statRating1 = "rating_1"
+	statRating2 = "rating_2"
+	statImpact  = "impact"
+)
+
+var ratingStatistics = RegisterStatistics(
+	StatisticDefinition{Key: statRating1, Name: "Rating 1.0", Description: "HLTV rating 1.0", Unit: UnitRatio,
+		Aggregation: AggregationFormula, Dimensions: []Dimension{DimensionSide}},
+	StatisticDefinition{Key: statRating2, Name: "Rating 2.0", Description: "approximation of the HLTV rating 2.0",
+		Unit: UnitRatio, Aggregation: AggregationFormula, Dimensions: []Dimension{DimensionSide}},
+	StatisticDefinition{Key: statImpact, Name: "Impact", Description: "impact term of the rating 2.0", Unit: UnitRatio,
+		Aggregation: AggregationFormula, Dimensions: []Dimension{DimensionSide}})
+
+//ratingInputs lists the statistics ratings are computed from
+var ratingInputs = []string{statRounds, statKills, statDeaths, statAssists, statKASTSum, statTotalDamage,
+	statKillsInRound(1), statKillsInRound(2), statKillsInRound(3), statKillsInRound(4), statKillsInRound(5)}
+
+//requiredHandlers lists the handlers computing ratingInputs
+func (rc *RatingCalculator) requiredHandlers() []string {
+	return []string{BasicHandlerName, "kdat", "adr"}
+}
+
+func (rc *RatingCalculator) Register(bh *BasicHandler) error {
+	rc.sources = nil
+	return rc.setupStatistics(bh, ratingStatistics...)
+}
+
+//findSources finds the holder of each input among the basic handler and the handlers attached to it
+func (rc *RatingCalculator) findSources() error {
+	if rc.sources != nil {
+		return nil
+	}
+	sources := make(map[string]*statisticHolder)
+	for _, key := range ratingInputs {
+		source := rc.basicHandler.statisticSource(key)
+		if source == nil {
+			return fmt.Errorf("rating: statistic %q is computed by no calculator of the pipeline", key)
+		}
+		sources[key] = source
+	}
+	rc.sources = sources
+	return nil
+}
+
+//input returns the sum of the variant of the input key matching column over the rounds from first to last, starting at 0
+func (rc *RatingCalculator) input(key string, column StatisticColumn, userID uint64, first int, last int) float64 {
+	source := rc.sources[key]
+	index := source.matchingIndex(source.columnIndex[key], column)
+	var sum float64
+	for round := first; round <= last && round < len(source.playerStats); round++ {
+		if values, ok := source.playerStats[round][userID]; ok {
+			sum += values[index]
+		}
+	}
+	return sum
+}
+
+//ratings returns the values of the columns of the calculator over the rounds from first to last
+func (rc *RatingCalculator) ratings(userID uint64, first int, last int) []float64 {
+	values := make([]float64, len(rc.columns))
+	for index, column := range rc.columns {
+		values[index] = rate(column.Definition.Key, func(key string) float64 {
+			return rc.input(key, column, userID, first, last)
+		})
+	}
+	return values
+}
+
+//rate computes the rating key from input, the total of each input over the rounds rated
+func rate(key string, input func(key string) float64) float64 {
+	rounds := input(statRounds)
+	if rounds == 0 {
+		return 0
+	}
+	kpr := input(statKills) / rounds
+	dpr := input(statDeaths) / rounds
+	apr := input(statAssists) / rounds
+	adr := input(statTotalDamage) / rounds
+	kast := 100 * input(statKASTSum) / rounds
+	var multikills float64
+	for kills := 1; kills <= maxTeamSize; kills++ {
+		multikills += float64(kills*kills) * input(statKillsInRound(kills))
+	}
+
+	impact := 2.13*kpr + 0.42*apr - 0.41
+	switch key {
+	case statRating1:
+		return (kpr/0.679 + 0.7*(1-dpr)/0.317 + multikills/rounds/1.277) / 2.7
+	case statRating2:
+		return 0.0073*kast + 0.3591*kpr - 0.5329*dpr + 0.2372*impact + 0.0032*adr + 0.1587
+	case statImpact:
+		return impact
+	}
+	return 0
+}
+
+//RateStatistics computes the ratings from values, the statistics of a player by header, as DeriveStatistics
+//does for ratios. Ratings are not summed over matches, they are rated again from the sums of their inputs.
+//Columns whose inputs are missing from values are left out.
+func RateStatistics(values map[string]float64) (columns []StatisticColumn, rated []float64, err error) {
+	inputs := make([]StatisticDefinition, len(ratingInputs))
+	for i, key := range ratingInputs {
+		if inputs[i], err = LookupStatistic(key); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, key := range ratingStatistics {
+		definition, err := LookupStatistic(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, column := range definition.Columns() {
+			totals, ok := ratingTotals(inputs, column, values)
+			if !ok {
+				continue
+			}
+			columns = append(columns, column)
+			rated = append(rated, rate(key, func(key string) float64 { return totals[key] }))
+		}
+	}
+	return columns, rated, nil
+}
+
+//ratingTotals returns the variant of each input matching column found in values, by input key
+func ratingTotals(inputs []StatisticDefinition, column StatisticColumn, values map[string]float64) (map[string]float64, bool) {
+	totals := make(map[string]float64, len(inputs))
+	for _, input := range inputs {
+		total, ok := values[matchingColumn(input.Columns(), column).Header]
+		if !ok {
+			return nil, false
+		}
+		totals[input.Key] = total
+	}
+	return totals, true
+}
+
+func (rc *RatingCalculator) GetRoundStatistic(roundNumber int, userID uint64) ([]string, []float64, error) {
+	if err := rc.findSources(); err != nil {
+		return nil, nil, err
+	}
+	roundStats := rc.sources[statRounds].playerStats
+	if roundNumber > len(roundStats) {
+		return nil, nil, nil
+	}
+	if _, ok := roundStats[roundNumber-1][userID]; !ok {
+		return rc.baseStatsHeaders, nil, nil
+	}
+	return rc.baseStatsHeaders, rc.ratings(userID, roundNumber-1, roundNumber-1), nil
+}
+
+func (rc *RatingCalculator) GetMatchStatistic(userID uint64) ([]string, []float64, error) {
+	if err := rc.findSources(); err != nil {
+		return nil, nil, err
+	}
+	return rc.baseStatsHeaders, rc.ratings(userID, 0, len(rc.sources[statRounds].playerStats)-1), nil
+}
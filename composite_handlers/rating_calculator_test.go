@@ -0,0 +1,89 @@
+package composite_handlers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRatingOfAnAveragePlayer(t *testing.T) {
+	bh := &BasicHandler{matchFormat: DefaultMatchFormat()}
+	bh.basicHandler = bh
+	var kdat KDATCalculator
+	var adr ADRCalculator
+	var rc RatingCalculator
+	for _, err := range []error{bh.setupStatistics(bh, basicStatistics...), kdat.setupStatistics(bh, kdatStatistics...),
+		rc.setupStatistics(bh, ratingStatistics...)} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	bh.attachedHandlers = []CompositeEventHandler{&kdat, &rc}
+	if _, _, err := rc.GetMatchStatistic(1); err == nil {
+		t.Fatal("rating without damage should fail")
+	}
+	if err := adr.setupStatistics(bh, adrStatistics...); err != nil {
+		t.Fatal(err)
+	}
+	bh.attachedHandlers = append(bh.attachedHandlers, &adr)
+
+	//the totals of a terrorist matching the averages of rating 1.0, put in a single round
+	set := func(sh *statisticHolder, key string, value float64) {
+		if sh.playerStats == nil {
+			sh.playerStats = []map[uint64][]float64{{1: make([]float64, len(sh.columns))}}
+		}
+		for _, index := range sh.statColumns(key)[:2] { //the whole statistic and its terrorist variant
+			sh.playerStats[0][1][index] = value
+		}
+	}
+	set(&bh.statisticHolder, statRounds, 1000)
+	set(&kdat.statisticHolder, statKills, 679)
+	set(&kdat.statisticHolder, statDeaths, 683)
+	set(&kdat.statisticHolder, statKillsInRound(1), 473)
+	set(&kdat.statisticHolder, statKillsInRound(2), 201)
+	set(&adr.statisticHolder, statTotalDamage, 80000)
+
+	headers, values, err := rc.GetMatchStatistic(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers[0] != "Rating 1.0" || math.Abs(values[0]-1) > 1e-9 || values[1] != values[0] || values[2] != 0 {
+		t.Errorf("an average terrorist should be rated 1.0 on the whole match and as T, got %v %v", headers, values)
+	}
+	_, roundValues, _ := rc.GetRoundStatistic(1, 1)
+	if roundValues[0] != values[0] {
+		t.Errorf("a single round match should rate the round as the match, got %v", roundValues)
+	}
+}
+
+func TestRateStatisticsFromSums(t *testing.T) {
+	//the sums over matches of a terrorist matching the averages of rating 1.0
+	totals := map[string]float64{statRounds: 1000, statKills: 679, statDeaths: 683, statKillsInRound(1): 473,
+		statKillsInRound(2): 201, statTotalDamage: 80000}
+	values := make(map[string]float64)
+	for _, key := range ratingInputs {
+		definition, err := LookupStatistic(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, column := range definition.Columns() {
+			if column.Side != "ct" {
+				values[column.Header] = totals[key]
+			} else {
+				values[column.Header] = 0
+			}
+		}
+	}
+
+	columns, rated, err := RateStatistics(values)
+	if err != nil || len(columns) != 3*len(ratingStatistics) {
+		t.Fatalf("every rating should be rated from complete inputs, got %v %v", columns, err)
+	}
+	if columns[0].Header != "Rating 1.0" || math.Abs(rated[0]-1) > 1e-9 || rated[1] != rated[0] || rated[2] != 0 {
+		t.Errorf("an average terrorist should be rated 1.0 on the whole match and as T, got %v %v", columns, rated)
+	}
+
+	delete(values, "Rounds_CT")
+	if columns, _, _ = RateStatistics(values); len(columns) != 2*len(ratingStatistics) {
+		t.Errorf("ratings missing an input should be left out, got %v", columns)
+	}
+}
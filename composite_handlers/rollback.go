@@ -0,0 +1,98 @@
+package composite_handlers
+
+import events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+
+//kinds of rollback
+const (
+	RollbackMatchRestart  = "match_restart"  //the match starts again from the first round, such as live on three restarts
+	RollbackRoundRestart  = "round_restart"  //the current round is played again, after a technical pause
+	RollbackBackupRestore = "backup_restore" //earlier rounds are played again, after mp_backup_restore
+)
+
+//Rollback is a round start with a round number already finalized: the data of the rounds from that number on is discarded
+type Rollback struct {
+	Kind              string `json:"kind"`
+	Tick              int    `json:"tick"`              //tick of the round start that rolled the match back
+	FromRound         int    `json:"fromRound"`         //last round started before the rollback
+	ToRound           int    `json:"toRound"`           //round played again
+	DiscardedFromTick int    `json:"discardedFromTick"` //start tick of the first discarded round
+	DiscardedRounds   []int  `json:"discardedRounds"`   //rounds whose outputs were discarded, finished or not
+}
+
+//RoundRollback is published when a rollback is detected, before the data of the discarded rounds is removed
+//and before the RoundStart of the round played again
+type RoundRollback struct {
+	Rollback
+}
+
+//DiscardedRound is the output of a finished round discarded by a rollback, kept for audit
+type DiscardedRound struct {
+	Rollback int //index of the rollback in the match metadata
+	Round    RoundResult
+}
+
+//isStaleScore reports whether the round starting is the round just finalized, won but not counted yet by the score.
+//Some demos update the score during the freezetime of the next round, the start of that round is put off until then.
+func (bh *BasicHandler) isStaleScore() bool {
+	return bh.roundNumber == bh.finalizedRound && bh.scoreAwaited
+}
+
+//isRollback reports whether the round starting goes back to a round already finalized
+func (bh *BasicHandler) isRollback() bool {
+	return bh.roundNumber <= bh.finalizedRound && !bh.isStaleScore()
+}
+
+//startRound records the start of the current round with the player mappings of its start and publishes it.
+//A round number already started is cropped, and recorded as a rollback when the round was finalized.
+func (bh *BasicHandler) startRound(mappings map[uint64]playerMapping, tick int) {
+	bh.staleStart = bh.isStaleScore()
+	if bh.staleStart {
+		return
+	}
+	if bh.roundNumber-1 < len(bh.playerMappings) {
+		if bh.isRollback() {
+			bh.recordRollback()
+		}
+		bh.CropData(bh.roundNumber - 1)
+	}
+	bh.playerMappings = append(bh.playerMappings, mappings)
+	bh.roundStartTicks = append(bh.roundStartTicks, tick)
+	bh.publish(events.RoundStart{})
+}
+
+//recordRollback records and publishes the rollback to the current round number
+func (bh *BasicHandler) recordRollback() {
+	fromRound := len(bh.playerMappings)
+	rollback := Rollback{Kind: RollbackBackupRestore, Tick: (*bh.parser).GameState().IngameTick(), FromRound: fromRound,
+		ToRound: bh.roundNumber}
+	switch {
+	case bh.roundNumber == 1:
+		rollback.Kind = RollbackMatchRestart
+	case bh.roundNumber == fromRound:
+		rollback.Kind = RollbackRoundRestart
+	}
+	if bh.roundNumber-1 < len(bh.roundStartTicks) {
+		rollback.DiscardedFromTick = bh.roundStartTicks[bh.roundNumber-1]
+	}
+	for round := bh.roundNumber; round <= fromRound; round++ {
+		rollback.DiscardedRounds = append(rollback.DiscardedRounds, round)
+	}
+	bh.rollbacks = append(bh.rollbacks, rollback)
+	bh.finalizedRound = bh.roundNumber - 1
+	bh.publish(RoundRollback{rollback})
+}
+
+//Rollbacks returns the rollbacks of the match so far
+func (bh *BasicHandler) Rollbacks() []Rollback {
+	return bh.rollbacks
+}
+
+//HasRestores reports whether rounds of the match were played again after it started, other than by a match restart
+func HasRestores(rollbacks []Rollback) bool {
+	for _, rollback := range rollbacks {
+		if rollback.Kind != RollbackMatchRestart {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package composite_handlers
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+func TestRollbackMovesRoundsToAudit(t *testing.T) {
+	parser := dem.NewParser(bytes.NewReader(make([]byte, 1024)))
+	defer parser.Close()
+	bh := &BasicHandler{parser: &parser}
+	bh.basicHandler = bh
+	bh.RegisterBasicEvents()
+	ih := &InfoGenerationHandler{basicHandler: bh, result: new(MatchResult)}
+	if _, err := bh.SubscribeAll(Subscription{ih.RoundRollbackHandler, GateAlways}); err != nil {
+		t.Fatal(err)
+	}
+
+	//rounds 1 to 4 started, 1 to 3 finished, then a backup of round 2 is restored
+	bh.playerMappings = make([]map[uint64]playerMapping, 4)
+	bh.roundStartTicks = []int{100, 200, 300, 400}
+	ih.result.Rounds = []RoundResult{{Number: 1}, {Number: 2}, {Number: 3}}
+	bh.roundNumber = 2
+	bh.recordRollback()
+
+	want := Rollback{Kind: RollbackBackupRestore, FromRound: 4, ToRound: 2, DiscardedFromTick: 200, DiscardedRounds: []int{2, 3, 4}}
+	if rollbacks := bh.Rollbacks(); len(rollbacks) != 1 || !reflect.DeepEqual(rollbacks[0], want) {
+		t.Fatalf("unexpected rollbacks %+v", rollbacks)
+	}
+	if len(ih.result.Rounds) != 1 || len(ih.result.DiscardedRounds) != 2 || ih.result.DiscardedRounds[1].Round.Number != 3 {
+		t.Errorf("rounds 2 and 3 should be discarded, kept %+v, discarded %+v", ih.result.Rounds, ih.result.DiscardedRounds)
+	}
+	if !HasRestores(bh.Rollbacks()) {
+		t.Error("a backup restore should flag the match")
+	}
+
+	bh.CropData(1)
+	bh.roundNumber = 1
+	bh.recordRollback()
+	if kind := bh.Rollbacks()[1].Kind; kind != RollbackMatchRestart {
+		t.Errorf("a rollback to the first round should be a match restart, got %s", kind)
+	}
+	if HasRestores(bh.Rollbacks()[1:]) {
+		t.Error("a match restart alone should not flag the match")
+	}
+}
+
+func TestStaleScoreRoundStartIsNoRollback(t *testing.T) {
+	demoParser := dem.NewParser(bytes.NewReader(make([]byte, 1024)))
+	defer demoParser.Close()
+	recorder := &recordingParser{Parser: demoParser}
+	var parser dem.Parser = recorder
+	bh := &BasicHandler{parser: &parser}
+	bh.basicHandler = bh
+	bh.RegisterBasicEvents()
+	ih := &InfoGenerationHandler{basicHandler: bh, result: new(MatchResult), matchData: new(matchData)}
+	_, err := bh.SubscribeAll(Subscription{ih.RoundStartHandler, GateAlways}, Subscription{ih.RoundRollbackHandler, GateAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//rounds 1 to 3 are finalized, round 3 is won but the next round starts before the score counts it
+	for round := 0; round < 3; round++ {
+		ih.matchData.AddNewRound()
+	}
+	ih.result.Rounds = []RoundResult{{Number: 1}, {Number: 2}, {Number: 3}}
+	bh.state, bh.isMatchStarted, bh.roundStructureCreated = StateLive, true, true
+	bh.roundNumber = 3
+	bh.playerMappings = make([]map[uint64]playerMapping, 3)
+	recorder.send(events.RoundEnd{Winner: common.TeamTerrorists, Reason: events.RoundEndReasonTerroristsWin})
+	recorder.send(events.RoundEndOfficial{})
+	if bh.isRollback() {
+		t.Error("a round start with the stale score of the round just won should not be a rollback")
+	}
+	bh.startRound(nil, 400)
+	if len(bh.Rollbacks()) != 0 || len(ih.result.Rounds) != 3 || len(bh.playerMappings) != 3 {
+		t.Fatalf("the stale round start should be put off, rollbacks %+v, rounds %+v", bh.Rollbacks(), ih.result.Rounds)
+	}
+
+	//the score is updated during the freezetime and the round start info is rebuilt
+	bh.roundNumber = 4
+	bh.startRound(nil, 410)
+	if len(bh.Rollbacks()) != 0 || len(ih.result.Rounds) != 3 || len(bh.playerMappings) != 4 {
+		t.Errorf("round 4 should start after the finalized rounds, rollbacks %+v, rounds %+v", bh.Rollbacks(),
+			ih.result.Rounds)
+	}
+	bh.roundNumber = 2
+	if !bh.isRollback() {
+		t.Error("a score below the round just won should be a rollback")
+	}
+
+	//round 4 is played again after a technical pause, without a winner
+	bh.roundNumber, bh.roundProcessed, bh.roundEndWon = 4, false, false
+	recorder.send(events.RoundEndOfficial{})
+	if !bh.isRollback() {
+		t.Error("a round start with the number of a round finalized without a winner should be a rollback")
+	}
+}
@@ -0,0 +1,157 @@
+package composite_handlers
+
+import (
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+//RosterSlot is a slot of a round and the player holding it. The slots of the terrorist side come first,
+//0 to team size - 1, then the counter-terrorist ones.
+type RosterSlot struct {
+	Slot    int    `json:"slot"`
+	Team    string `json:"team"`
+	SteamID uint64 `json:"steamID"`
+	Name    string `json:"name"`
+	Present bool   `json:"present"` //false while the player holding the slot is disconnected
+}
+
+//Substitution is a player taking the slot of a team that another player held in earlier rounds
+type Substitution struct {
+	Round int    `json:"round"`
+	Team  string `json:"team"`
+	Slot  int    `json:"slot"` //slot in the team, from 0 to team size - 1
+	Out   uint64 `json:"out"`
+	In    uint64 `json:"in"`
+}
+
+//Overflow is a player of a team left without a slot in a round, all the slots of the team being held by present players.
+//The player is left out of the outputs of the round.
+type Overflow struct {
+	Round   int    `json:"round"` //first round the player had no slot in
+	Team    string `json:"team"`
+	SteamID uint64 `json:"steamID"`
+	Name    string `json:"name"`
+}
+
+//rosterTracker keeps every player in the same team slot for the whole match. A disconnected player keeps
+//the slot until a new player of the team needs it, which is then recorded as a substitution.
+type rosterTracker struct {
+	owners        [2][]uint64 //steam id of the player holding each slot of TeamA and TeamB
+	held          [2][]bool
+	names         map[uint64]string
+	substitutions []Substitution
+	overflows     []Overflow   //once per player
+	roundRoster   []RosterSlot //slots of the last assigned round
+}
+
+//sidePlayers returns the players of each side, terrorists first. Spectators and unassigned players are left out.
+func sidePlayers(gs dem.GameState) (sides [2][]*common.Player) {
+	for _, player := range gs.Participants().Playing() {
+		switch player.Team {
+		case common.TeamTerrorists:
+			sides[0] = append(sides[0], player)
+		case common.TeamCounterTerrorists:
+			sides[1] = append(sides[1], player)
+		}
+	}
+	return sides
+}
+
+//assign gives a slot of their team to the players of each side of round, keeping the slots of earlier rounds.
+//tTeam is the index of the team on the terrorist side, players beyond teamSize on a side get no slot.
+func (rt *rosterTracker) assign(round int, sides [2][]*common.Player, tTeam int, teamSize int) map[uint64]playerMapping {
+	if rt.names == nil {
+		rt.names = make(map[uint64]string)
+	}
+	for team := range rt.owners {
+		for len(rt.owners[team]) < teamSize {
+			rt.owners[team] = append(rt.owners[team], 0)
+			rt.held[team] = append(rt.held[team], false)
+		}
+	}
+	mappings := make(map[uint64]playerMapping)
+	rt.roundRoster = nil
+	for side, players := range sides {
+		team := tTeam
+		if side == 1 {
+			team = 1 - tTeam
+		}
+		present := make(map[uint64]bool, len(players))
+		for _, player := range players {
+			present[player.SteamID64] = true
+			rt.names[player.SteamID64] = player.Name
+		}
+
+		var unslotted []*common.Player
+		for _, player := range players {
+			slot := rt.slotOf(team, teamSize, player.SteamID64)
+			if slot < 0 {
+				unslotted = append(unslotted, player)
+				continue
+			}
+			mappings[player.SteamID64] = playerMapping{playerObject: player, currentSlot: side*teamSize + slot}
+		}
+		for _, player := range unslotted {
+			slot := rt.freeSlot(team, teamSize, present)
+			if slot < 0 {
+				rt.recordOverflow(round, team, player)
+				continue
+			}
+			if rt.held[team][slot] {
+				rt.substitutions = append(rt.substitutions, Substitution{Round: round, Team: teamID(team), Slot: slot,
+					Out: rt.owners[team][slot], In: player.SteamID64})
+			}
+			rt.owners[team][slot], rt.held[team][slot] = player.SteamID64, true
+			mappings[player.SteamID64] = playerMapping{playerObject: player, currentSlot: side*teamSize + slot}
+		}
+
+		for slot := 0; slot < teamSize; slot++ {
+			if rt.held[team][slot] {
+				owner := rt.owners[team][slot]
+				rt.roundRoster = append(rt.roundRoster, RosterSlot{Slot: side*teamSize + slot, Team: teamID(team),
+					SteamID: owner, Name: rt.names[owner], Present: present[owner]})
+			}
+		}
+	}
+	return mappings
+}
+
+func (rt *rosterTracker) recordOverflow(round int, team int, player *common.Player) {
+	for _, overflow := range rt.overflows {
+		if overflow.SteamID == player.SteamID64 {
+			return
+		}
+	}
+	rt.overflows = append(rt.overflows, Overflow{Round: round, Team: teamID(team), SteamID: player.SteamID64, Name: player.Name})
+}
+
+func (rt *rosterTracker) slotOf(team int, teamSize int, steamID uint64) int {
+	for slot := 0; slot < teamSize; slot++ {
+		if rt.held[team][slot] && rt.owners[team][slot] == steamID {
+			return slot
+		}
+	}
+	return -1
+}
+
+//freeSlot returns the first slot never held, or else the first slot whose player is not present
+func (rt *rosterTracker) freeSlot(team int, teamSize int, present map[uint64]bool) int {
+	for slot := 0; slot < teamSize; slot++ {
+		if !rt.held[team][slot] {
+			return slot
+		}
+	}
+	for slot := 0; slot < teamSize; slot++ {
+		if !present[rt.owners[team][slot]] {
+			return slot
+		}
+	}
+	return -1
+}
+
+func teamID(index int) string {
+	if index == 0 {
+		return TeamA
+	}
+	return TeamB
+}
@@ -0,0 +1,64 @@
+package composite_handlers
+
+import (
+	"testing"
+
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func rosterPlayers(steamIDs ...uint64) []*common.Player {
+	var players []*common.Player
+	for _, steamID := range steamIDs {
+		players = append(players, &common.Player{SteamID64: steamID})
+	}
+	return players
+}
+
+func TestRosterTrackerKeepsSlots(t *testing.T) {
+	var rt rosterTracker
+	teamA := rosterPlayers(1, 2, 3, 4, 5)
+	teamB := rosterPlayers(6, 7, 8, 9, 10)
+
+	mappings := rt.assign(1, [2][]*common.Player{teamA, teamB}, 0, 5)
+	if mappings[3].currentSlot != 2 || mappings[8].currentSlot != 7 {
+		t.Fatalf("first round: unexpected slots %+v", mappings)
+	}
+
+	//second half, the players come in another order: team slots are kept and the sides move
+	mappings = rt.assign(16, [2][]*common.Player{rosterPlayers(10, 9, 8, 7, 6), rosterPlayers(5, 4, 3, 2, 1)}, 1, 5)
+	if mappings[3].currentSlot != 7 || mappings[8].currentSlot != 2 {
+		t.Errorf("second half: unexpected slots %+v", mappings)
+	}
+
+	//player 3 disconnects: the slot stays empty and is reported as such
+	mappings = rt.assign(17, [2][]*common.Player{teamB, rosterPlayers(1, 2, 4, 5)}, 1, 5)
+	if _, ok := mappings[3]; ok || mappings[4].currentSlot != 8 {
+		t.Errorf("disconnect: unexpected slots %+v", mappings)
+	}
+	if slot := rt.roundRoster[7]; slot.SteamID != 3 || slot.Present {
+		t.Errorf("disconnect: slot 7 should be held by the missing player 3, got %+v", slot)
+	}
+
+	//player 11 replaces player 3
+	mappings = rt.assign(18, [2][]*common.Player{teamB, rosterPlayers(1, 2, 11, 4, 5)}, 1, 5)
+	if mappings[11].currentSlot != 7 || len(rt.substitutions) != 1 ||
+		rt.substitutions[0] != (Substitution{Round: 18, Team: TeamA, Slot: 2, Out: 3, In: 11}) {
+		t.Errorf("substitution: unexpected slots %+v and substitutions %+v", mappings, rt.substitutions)
+	}
+
+	//player 3 is back while the substitute is still there: no slot is left for a sixth player
+	mappings = rt.assign(19, [2][]*common.Player{teamB, rosterPlayers(1, 2, 11, 4, 5, 3)}, 1, 5)
+	if _, ok := mappings[3]; ok || len(mappings) != 10 {
+		t.Errorf("sixth player: unexpected slots %+v", mappings)
+	}
+	rt.assign(19, [2][]*common.Player{teamB, rosterPlayers(1, 2, 11, 4, 5, 3)}, 1, 5)
+	if len(rt.overflows) != 1 || rt.overflows[0] != (Overflow{Round: 19, Team: TeamA, SteamID: 3}) {
+		t.Errorf("sixth player: the overflow should be recorded once, got %+v", rt.overflows)
+	}
+
+	//the substitute leaves, player 3 takes the slot back
+	mappings = rt.assign(20, [2][]*common.Player{teamB, teamA}, 1, 5)
+	if mappings[3].currentSlot != 7 || len(rt.substitutions) != 2 || rt.substitutions[1].In != 3 {
+		t.Errorf("reconnect: unexpected slots %+v and substitutions %+v", mappings, rt.substitutions)
+	}
+}
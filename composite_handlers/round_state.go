@@ -0,0 +1,74 @@
+package composite_handlers
+
+import (
+	"reflect"
+
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+//RoundState is the phase of the match tracked by the basic handler. Its transitions are:
+//
+//	Warmup     -> Freezetime  a valid round starts: both teams have players and warmup is over
+//	Freezetime -> Freezetime  the score changes before the round is live, the round start info is rebuilt
+//	Freezetime -> Live        the freezetime ends, or the first footstep of the round for demos missing the event
+//	Live       -> PostRound   the score of a team goes up, the winner of the round is known
+//	PostRound  -> Freezetime  the next valid round starts, a rolled back round starts again with the same number
+//	PostRound  -> MatchEnded  the round won was the match point, once it is finalized
+//
+//Subscribers follow the rounds through RoundStart, RoundLive, RoundFinalized and MatchFinalized
+//instead of the raw demo events, whose order varies between demos.
+type RoundState int
+
+const (
+	StateWarmup RoundState = iota
+	StateFreezetime
+	StateLive
+	StatePostRound
+	StateMatchEnded
+)
+
+func (rs RoundState) String() string {
+	switch rs {
+	case StateWarmup:
+		return "warmup"
+	case StateFreezetime:
+		return "freezetime"
+	case StateLive:
+		return "live"
+	case StatePostRound:
+		return "post_round"
+	case StateMatchEnded:
+		return "match_ended"
+	}
+	return "unknown"
+}
+
+//RoundLive is published when a round goes live, after the round structure is created
+type RoundLive struct {
+	Round int
+}
+
+//RoundFinalized is published once per round, after RoundEndOfficial, when its statistics are complete
+type RoundFinalized struct {
+	Round  int
+	Winner string                //"t", "ct", "invalid", or empty when the round was cut before a winner was known
+	Reason events.RoundEndReason //zero when the demo had no round end event for the round
+}
+
+//MatchFinalized is published once the final round of the match is finalized
+type MatchFinalized struct {
+	Rounds                  int
+	TerroristFirstTeamScore int
+	CTFirstTeamScore        int
+}
+
+//State returns the current phase of the match
+func (bh *BasicHandler) State() RoundState {
+	return bh.state
+}
+
+//isSyntheticEvent reports whether events of eventType are published by the basic handler only
+func isSyntheticEvent(eventType reflect.Type) bool {
+	return eventType == reflect.TypeOf(RoundLive{}) || eventType == reflect.TypeOf(RoundFinalized{}) ||
+		eventType == reflect.TypeOf(MatchFinalized{}) || eventType == reflect.TypeOf(RoundRollback{})
+}
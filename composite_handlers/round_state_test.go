@@ -0,0 +1,80 @@
+package composite_handlers
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+	dp "github.com/markus-wa/godispatch"
+)
+
+//recordingParser keeps the event handlers registered on it, to send them events as the parser would
+type recordingParser struct {
+	dem.Parser
+	handlers []interface{}
+}
+
+func (rp *recordingParser) RegisterEventHandler(handler interface{}) dp.HandlerIdentifier {
+	rp.handlers = append(rp.handlers, handler)
+	return dp.HandlerIdentifier(new(int))
+}
+
+//send calls the handlers registered for the type of e
+func (rp *recordingParser) send(e interface{}) {
+	for _, handler := range rp.handlers {
+		if reflect.TypeOf(handler).In(0) == reflect.TypeOf(e) {
+			reflect.ValueOf(handler).Call([]reflect.Value{reflect.ValueOf(e)})
+		}
+	}
+}
+
+func TestRoundLifecycle(t *testing.T) {
+	demoParser := dem.NewParser(bytes.NewReader(make([]byte, 1024)))
+	defer demoParser.Close()
+	recorder := &recordingParser{Parser: demoParser}
+	var parser dem.Parser = recorder
+	bh := &BasicHandler{parser: &parser}
+	bh.basicHandler = bh
+	bh.RegisterBasicEvents()
+
+	var published []interface{}
+	_, err := bh.SubscribeAll(
+		Subscription{func(e RoundLive) { published = append(published, e) }, GateAlways},
+		Subscription{func(e RoundFinalized) { published = append(published, e) }, GateAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//a valid round start, as left by createPreRoundStartInfo
+	player := &common.Player{SteamID64: 1, Team: common.TeamTerrorists}
+	bh.state, bh.isMatchStarted, bh.isValidRoundStart, bh.roundFreezeTime = StateFreezetime, true, true, true
+	bh.roundNumber = 1
+	bh.playerMappings = []map[uint64]playerMapping{{1: {playerObject: player}}}
+
+	recorder.send(events.RoundFreezetimeEnd{})
+	if bh.State() != StateLive || len(published) != 1 || published[0] != (RoundLive{Round: 1}) {
+		t.Fatalf("freezetime end should make the round live, state %v, published %v", bh.State(), published)
+	}
+	recorder.send(events.Footstep{})
+	if len(published) != 1 {
+		t.Errorf("a live round should not go live again, published %v", published)
+	}
+
+	recorder.send(events.RoundEnd{Reason: events.RoundEndReasonTerroristsWin})
+	teamState := common.NewTeamState(common.TeamTerrorists, nil)
+	recorder.send(events.ScoreUpdated{TeamState: &teamState})
+	if bh.State() != StatePostRound {
+		t.Fatalf("the score update should end the round, state %v", bh.State())
+	}
+
+	//the parser sends the official round end to the basic handler, the round is finalized before the next round starts
+	recorder.send(events.RoundEndOfficial{})
+	recorder.send(events.RoundEndOfficial{})
+	finalized := RoundFinalized{Round: 1, Winner: "t", Reason: events.RoundEndReasonTerroristsWin}
+	if len(published) != 2 || published[1] != finalized {
+		t.Errorf("expected the round to be finalized once as %v, published %v", finalized, published)
+	}
+}
@@ -0,0 +1,246 @@
+package composite_handlers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Aggregation tells how the values of a statistic in each round make its match value
+type Aggregation string
+
+const (
+	AggregationSum   Aggregation = "sum"
+	AggregationMax   Aggregation = "max"
+	AggregationMean  Aggregation = "mean"  //mean over the rounds the player played
+	AggregationRatio Aggregation = "ratio" //Numerator over Denominator, both summed over the rounds
+
+	//AggregationFormula statistics are computed by their calculator from the totals of other statistics
+	AggregationFormula Aggregation = "formula"
+)
+
+//Dimension is a split of a statistic into variants, each counting only part of the rounds
+type Dimension string
+
+const (
+	DimensionSide Dimension = "side" //variants _T and _CT, by the side of the player when the statistic is counted
+	DimensionHalf Dimension = "half" //variants _H1, _H2 and _OT, by the period of the round
+)
+
+//units of statistics
+const (
+	UnitCount   = "count"
+	UnitRounds  = "rounds"
+	UnitHP      = "hp"
+	UnitSeconds = "seconds"
+	UnitRatio   = "ratio"
+	UnitPercent = "percent"
+	UnitMoney   = "money"
+)
+
+//what a ratio is worth when its denominator is 0
+const (
+	ZeroDenominatorZero      = "zero"      //0, the default
+	ZeroDenominatorNumerator = "numerator" //the numerator, as for a K/D without deaths
+)
+
+//StatisticDefinition declares a statistic once, with everything outputs need to know about it
+type StatisticDefinition struct {
+	Key         string      `json:"key"`
+	Name        string      `json:"name"` //csv header and BASE_STATISTIC name of the statistic
+	Description string      `json:"description"`
+	Unit        string      `json:"unit"`
+	Aggregation Aggregation `json:"aggregation"`
+	Numerator   string      `json:"numerator,omitempty"` //keys of the statistics of a ratio
+	Denominator string      `json:"denominator,omitempty"`
+	Dimensions  []Dimension `json:"dimensions,omitempty"`
+
+	Scale           float64 `json:"scale,omitempty"`           //multiplies a ratio, 100 for percentages. 0 is read as 1.
+	ZeroDenominator string  `json:"zeroDenominator,omitempty"` //policy of a ratio for a 0 denominator, zero when empty
+}
+
+//StatisticColumn is a statistic or one of its variants, as laid out in the outputs
+type StatisticColumn struct {
+	Header     string
+	Side       string //"t" or "ct" for side variants
+	Half       string //"1", "2" or "ot" for half variants
+	Definition StatisticDefinition
+}
+
+var (
+	statisticRegistryMutex sync.RWMutex
+	statisticRegistry      = make(map[string]StatisticDefinition)
+	statisticNames         = make(map[string]string)
+)
+
+//RegisterStatistics makes statistics available to calculators under their key and returns their keys.
+//It panics on an invalid definition, as RegisterHandlerFactory does on a name registered twice.
+//Base statistics are registered while initializing package variables, so that ratios registered
+//by init functions find their terms whatever the order of the files.
+func RegisterStatistics(definitions ...StatisticDefinition) []string {
+	statisticRegistryMutex.Lock()
+	defer statisticRegistryMutex.Unlock()
+	keys := make([]string, len(definitions))
+	for i, definition := range definitions {
+		if err := validateStatistic(definition); err != nil {
+			panic(err.Error())
+		}
+		statisticRegistry[definition.Key] = definition
+		statisticNames[definition.Name] = definition.Key
+		keys[i] = definition.Key
+	}
+	return keys
+}
+
+//validateStatistic checks a definition against the registry, ratios must be registered after their statistics
+func validateStatistic(definition StatisticDefinition) error {
+	if definition.Key == "" || definition.Name == "" {
+		return fmt.Errorf("statistic %q: key and name are required", definition.Key)
+	}
+	if _, ok := statisticRegistry[definition.Key]; ok {
+		return fmt.Errorf("statistic %q registered twice", definition.Key)
+	}
+	if key, ok := statisticNames[definition.Name]; ok {
+		return fmt.Errorf("statistic %q: name %q already used by %q", definition.Key, definition.Name, key)
+	}
+	for _, dimension := range definition.Dimensions {
+		if dimension != DimensionSide && dimension != DimensionHalf {
+			return fmt.Errorf("statistic %q: unknown dimension %q", definition.Key, dimension)
+		}
+	}
+	switch definition.Aggregation {
+	case AggregationSum, AggregationMax, AggregationMean, AggregationFormula:
+		if definition.Numerator != "" || definition.Denominator != "" {
+			return fmt.Errorf("statistic %q: only ratios have a numerator and a denominator", definition.Key)
+		}
+	case AggregationRatio:
+		if definition.Scale < 0 {
+			return fmt.Errorf("statistic %q: negative scale", definition.Key)
+		}
+		if definition.ZeroDenominator != "" && definition.ZeroDenominator != ZeroDenominatorZero &&
+			definition.ZeroDenominator != ZeroDenominatorNumerator {
+			return fmt.Errorf("statistic %q: unknown zero denominator policy %q", definition.Key, definition.ZeroDenominator)
+		}
+		for _, key := range []string{definition.Numerator, definition.Denominator} {
+			term, ok := statisticRegistry[key]
+			if !ok {
+				return fmt.Errorf("statistic %q: term %q is not registered", definition.Key, key)
+			}
+			if term.Aggregation != AggregationSum || !hasDimensions(term, definition.Dimensions) {
+				return fmt.Errorf("statistic %q: term %q must be a summed statistic split on the dimensions of the ratio",
+					definition.Key, key)
+			}
+		}
+	default:
+		return fmt.Errorf("statistic %q: unknown aggregation %q", definition.Key, definition.Aggregation)
+	}
+	return nil
+}
+
+func hasDimensions(definition StatisticDefinition, dimensions []Dimension) bool {
+	for _, dimension := range dimensions {
+		if !definition.HasDimension(dimension) {
+			return false
+		}
+	}
+	return true
+}
+
+//HasDimension reports whether the statistic is split on dimension
+func (sd StatisticDefinition) HasDimension(dimension Dimension) bool {
+	for _, d := range sd.Dimensions {
+		if d == dimension {
+			return true
+		}
+	}
+	return false
+}
+
+//Columns lays out the statistic and its variants: the whole statistic, then the variants of each dimension
+func (sd StatisticDefinition) Columns() []StatisticColumn {
+	columns := []StatisticColumn{{Header: sd.Name, Definition: sd}}
+	if sd.HasDimension(DimensionSide) {
+		columns = append(columns, StatisticColumn{Header: sd.Name + "_T", Side: "t", Definition: sd},
+			StatisticColumn{Header: sd.Name + "_CT", Side: "ct", Definition: sd})
+	}
+	if sd.HasDimension(DimensionHalf) {
+		columns = append(columns, StatisticColumn{Header: sd.Name + "_H1", Half: "1", Definition: sd},
+			StatisticColumn{Header: sd.Name + "_H2", Half: "2", Definition: sd},
+			StatisticColumn{Header: sd.Name + "_OT", Half: "ot", Definition: sd})
+	}
+	return columns
+}
+
+//Ratio returns the value of a ratio statistic from the values of its terms
+func (sd StatisticDefinition) Ratio(numerator float64, denominator float64) float64 {
+	scale := sd.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	if denominator != 0 {
+		return scale * numerator / denominator
+	}
+	if sd.ZeroDenominator == ZeroDenominatorNumerator {
+		return scale * numerator
+	}
+	return 0
+}
+
+//RatioTerms returns the headers of the numerator and the denominator of each column of a ratio,
+//in the order of its Columns
+func (sd StatisticDefinition) RatioTerms() ([][2]string, error) {
+	numerator, err := LookupStatistic(sd.Numerator)
+	if err != nil {
+		return nil, err
+	}
+	denominator, err := LookupStatistic(sd.Denominator)
+	if err != nil {
+		return nil, err
+	}
+	var terms [][2]string
+	for _, column := range sd.Columns() {
+		terms = append(terms, [2]string{matchingColumn(numerator.Columns(), column).Header,
+			matchingColumn(denominator.Columns(), column).Header})
+	}
+	return terms, nil
+}
+
+//matchingColumn returns the column among columns with the side and half of column.
+//Terms of a ratio are split on its dimensions, they always have one.
+func matchingColumn(columns []StatisticColumn, column StatisticColumn) StatisticColumn {
+	for _, candidate := range columns {
+		if candidate.Side == column.Side && candidate.Half == column.Half {
+			return candidate
+		}
+	}
+	return StatisticColumn{}
+}
+
+//LookupStatistic returns the definition registered under key
+func LookupStatistic(key string) (StatisticDefinition, error) {
+	statisticRegistryMutex.RLock()
+	defer statisticRegistryMutex.RUnlock()
+	definition, ok := statisticRegistry[key]
+	if !ok {
+		return definition, fmt.Errorf("unknown statistic %q", key)
+	}
+	return definition, nil
+}
+
+//RegisteredStatistics returns every registered statistic, sorted by key
+func RegisteredStatistics() []StatisticDefinition {
+	statisticRegistryMutex.RLock()
+	defer statisticRegistryMutex.RUnlock()
+	definitions := make([]StatisticDefinition, 0, len(statisticRegistry))
+	for _, definition := range statisticRegistry {
+		definitions = append(definitions, definition)
+	}
+	sort.Slice(definitions, func(a, b int) bool { return definitions[a].Key < definitions[b].Key })
+	return definitions
+}
+
+//sideSum defines a statistic summed over the rounds and split by side, as most base statistics are
+func sideSum(key string, name string, unit string, description string) StatisticDefinition {
+	return StatisticDefinition{Key: key, Name: name, Description: description, Unit: unit, Aggregation: AggregationSum,
+		Dimensions: []Dimension{DimensionSide}}
+}
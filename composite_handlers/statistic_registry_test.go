@@ -0,0 +1,117 @@
+package composite_handlers
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func init() {
+	RegisterStatistics(
+		StatisticDefinition{Key: "test_damage", Name: "Test Damage", Unit: UnitHP, Aggregation: AggregationSum,
+			Dimensions: []Dimension{DimensionSide, DimensionHalf}},
+		sideSum("test_rounds", "Test Rounds", UnitRounds, ""),
+		StatisticDefinition{Key: "test_best_round", Name: "Test Best Round", Unit: UnitHP, Aggregation: AggregationMax},
+		StatisticDefinition{Key: "test_mean", Name: "Test Mean", Unit: UnitHP, Aggregation: AggregationMean},
+		StatisticDefinition{Key: "test_adr", Name: "Test ADR", Unit: UnitRatio, Aggregation: AggregationRatio,
+			Numerator: "test_damage", Denominator: "test_rounds", Dimensions: []Dimension{DimensionSide}})
+}
+
+func TestStatisticDefinitionsAreValidated(t *testing.T) {
+	invalid := []StatisticDefinition{
+		{Key: "test_rounds", Name: "Other Name", Aggregation: AggregationSum},
+		{Key: "test_unnamed", Aggregation: AggregationSum},
+		{Key: "test_unknown_aggregation", Name: "Unknown Aggregation", Aggregation: "median"},
+		{Key: "test_bad_ratio", Name: "Bad Ratio", Aggregation: AggregationRatio, Numerator: "test_damage", Denominator: "test_kils"},
+		{Key: "test_split_ratio", Name: "Split Ratio", Aggregation: AggregationRatio, Numerator: "test_damage",
+			Denominator: "test_rounds", Dimensions: []Dimension{DimensionHalf}},
+	}
+	for _, definition := range invalid {
+		if err := validateStatistic(definition); err == nil {
+			t.Errorf("%q should not be valid", definition.Key)
+		}
+	}
+
+	var sh statisticHolder
+	if err := sh.setupStatistics(nil, "test_rounds", "test_damge"); err == nil {
+		t.Error("a misspelled statistic should fail the setup")
+	}
+	if err := sh.setupStatistics(nil, "test_adr", "test_damage", "test_rounds"); err == nil {
+		t.Error("a ratio listed before its terms should fail the setup")
+	}
+	if err := sh.setupStatistics(nil, "test_damage", "test_rounds"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.requireStatistics("test_damage", "test_damge"); err == nil {
+		t.Error("a misspelled statistic used by the handler should fail the setup")
+	}
+	if err := sh.requireStatistics("test_damage", "test_rounds"); err == nil {
+		t.Error("statistics read together with other columns should fail the setup")
+	}
+}
+
+func TestStatisticNotSetUpStopsParsing(t *testing.T) {
+	parser := dem.NewParser(bytes.NewReader(make([]byte, 1024)))
+	defer parser.Close()
+	player := &common.Player{SteamID64: 1, Team: common.TeamTerrorists}
+	bh := &BasicHandler{parser: &parser, matchFormat: DefaultMatchFormat(), roundNumber: 1,
+		playerMappings: []map[uint64]playerMapping{{1: {playerObject: player}}}}
+	var sh statisticHolder
+	if err := sh.setupStatistics(bh, "test_damage"); err != nil {
+		t.Fatal(err)
+	}
+	sh.AddNewRound()
+
+	sh.addToPlayerStat(player, 10, "test_damge")
+	if value := sh.getPlayerStat(player, "test_damge"); value != 0 {
+		t.Errorf("a statistic not set up should read 0, got %v", value)
+	}
+	if bh.Err() == nil {
+		t.Error("a statistic not set up should stop parsing with an error")
+	}
+}
+
+func TestStatisticHolderAggregates(t *testing.T) {
+	player := &common.Player{SteamID64: 1, Team: common.TeamTerrorists}
+	bh := &BasicHandler{matchFormat: DefaultMatchFormat()}
+	var sh statisticHolder
+	if err := sh.setupStatistics(bh, "test_damage", "test_rounds", "test_best_round", "test_mean", "test_adr"); err != nil {
+		t.Fatal(err)
+	}
+	wantHeaders := []string{"Test Damage", "Test Damage_T", "Test Damage_CT", "Test Damage_H1", "Test Damage_H2",
+		"Test Damage_OT", "Test Rounds", "Test Rounds_T", "Test Rounds_CT", "Test Best Round", "Test Mean",
+		"Test ADR", "Test ADR_T", "Test ADR_CT"}
+	if !reflect.DeepEqual(sh.baseStatsHeaders, wantHeaders) {
+		t.Fatalf("unexpected headers %v", sh.baseStatsHeaders)
+	}
+
+	//a terrorist round of the first half, then a counter-terrorist round of the second half
+	for _, round := range []struct {
+		number int
+		team   common.Team
+		damage float64
+	}{{1, common.TeamTerrorists, 100}, {16, common.TeamCounterTerrorists, 50}} {
+		bh.roundNumber = round.number
+		bh.playerMappings = make([]map[uint64]playerMapping, round.number)
+		bh.playerMappings[round.number-1] = map[uint64]playerMapping{1: {playerObject: player}}
+		player.Team = round.team
+		sh.AddNewRound()
+		sh.addToPlayerStat(player, round.damage, "test_damage")
+		sh.setPlayerStat(player, 1, "test_rounds")
+		sh.setPlayerStat(player, round.damage, "test_best_round")
+		sh.setPlayerStat(player, round.damage, "test_mean")
+	}
+
+	_, values, _ := sh.GetMatchStatistic(1)
+	want := []float64{150, 100, 50, 100, 50, 0, 2, 1, 1, 100, 75, 75, 100, 50}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("unexpected match statistics %v, want %v", values, want)
+	}
+	_, values, _ = sh.GetRoundStatistic(1, 1)
+	if values[11] != 100 || values[13] != 0 {
+		t.Errorf("unexpected ratios of the first round %v", values)
+	}
+}
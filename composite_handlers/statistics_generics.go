@@ -1,88 +1,229 @@
 package composite_handlers
 
 import (
+	"fmt"
+
 	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 	utils "github.com/mrdbarros/csgo_analyze/utils"
 )
 
 type statisticHolder struct {
 	basicHandler        *BasicHandler
-	baseStatsHeaders    []string
+	columns             []StatisticColumn
+	baseStatsHeaders    []string         //headers of columns
+	columnIndex         map[string][]int //columns of each statistic, in the order of its Columns
 	playerStats         []map[uint64][]float64
-	defaultValues       map[string]float64
-	ratioStats          [][3]string
 	consolidatedHeaders []string
 	consolidatedStats   map[uint64][]float64
+	subscriptions       []SubscriptionID
+}
+
+//setupStatistics lays out the columns of the statistics registered under keys.
+//Keys not registered fail here, the terms of a ratio must be listed before it.
+func (sh *statisticHolder) setupStatistics(bh *BasicHandler, keys ...string) error {
+	sh.basicHandler = bh
+	sh.columns, sh.baseStatsHeaders = nil, nil
+	sh.columnIndex = make(map[string][]int)
+	for _, key := range keys {
+		definition, err := LookupStatistic(key)
+		if err != nil {
+			return err
+		}
+		if _, ok := sh.columnIndex[key]; ok {
+			return fmt.Errorf("statistic %q listed twice", key)
+		}
+		if definition.Aggregation == AggregationRatio {
+			_, numeratorOK := sh.columnIndex[definition.Numerator]
+			_, denominatorOK := sh.columnIndex[definition.Denominator]
+			if !numeratorOK || !denominatorOK {
+				return fmt.Errorf("statistic %q: its terms must be listed before it", key)
+			}
+		}
+		for _, column := range definition.Columns() {
+			sh.columnIndex[key] = append(sh.columnIndex[key], len(sh.columns))
+			sh.columns = append(sh.columns, column)
+			sh.baseStatsHeaders = append(sh.baseStatsHeaders, column.Header)
+		}
+	}
+	return nil
+}
+
+//requireStatistics checks at setup that the statistics the handler reads by key, outside of the
+//ones it lists, are set up with the same columns, so that no key is found missing while parsing
+func (sh *statisticHolder) requireStatistics(keys ...string) error {
+	for _, key := range keys {
+		indices, ok := sh.columnIndex[key]
+		if !ok {
+			return fmt.Errorf("statistic %q is used by the handler but not set up", key)
+		}
+		if len(indices) != len(sh.columnIndex[keys[0]]) {
+			return fmt.Errorf("statistic %q does not have the columns of %q", key, keys[0])
+		}
+	}
+	return nil
+}
+
+//Unregister removes the subscriptions of the handler embedding the holder
+func (kc *statisticHolder) Unregister() error {
+	kc.basicHandler.Unsubscribe(kc.subscriptions...)
+	kc.subscriptions = nil
+	return nil
+}
+
+func (sh *statisticHolder) holder() *statisticHolder {
+	return sh
+}
+
+//statisticSource returns the holder computing the statistic key among the basic handler and the handlers
+//attached to it, nil when there is none
+func (bh *BasicHandler) statisticSource(key string) *statisticHolder {
+	for _, handler := range append([]CompositeEventHandler{bh}, bh.attachedHandlers...) {
+		if source, ok := handler.(interface{ holder() *statisticHolder }); ok {
+			if _, ok := source.holder().columnIndex[key]; ok {
+				return source.holder()
+			}
+		}
+	}
+	return nil
+}
+
+//StatisticColumns returns the columns of the statistics of the holder, in the order of their headers
+func (sh *statisticHolder) StatisticColumns() []StatisticColumn {
+	return sh.columns
 }
 
 func (kc statisticHolder) GetRoundStatistic(roundNumber int, userID uint64) ([]string, []float64, error) {
 	if roundNumber > len(kc.playerStats) {
 		// fmt.Println("Invalid round number")
 		return nil, nil, nil
-	} else {
-		return kc.baseStatsHeaders, kc.playerStats[roundNumber-1][userID], nil
 	}
+	roundStats, ok := kc.playerStats[roundNumber-1][userID]
+	if !ok {
+		return kc.baseStatsHeaders, nil, nil
+	}
+	values := append([]float64(nil), roundStats...)
+	kc.fillRatios(values, roundStats)
+	return kc.baseStatsHeaders, values, nil
+}
 
+//statColumns returns the columns of stat. A stat not set up for the handler stops parsing with an error
+//instead of failing the whole process, and has no columns
+func (sh *statisticHolder) statColumns(stat string) []int {
+	indices, ok := sh.columnIndex[stat]
+	if !ok && sh.basicHandler != nil {
+		sh.basicHandler.SetError(utils.StageParse, fmt.Errorf("statistic %q is not set up for the handler", stat))
+	}
+	return indices
 }
 
-func (kc *statisticHolder) addToPlayerStat(player *common.Player, addAmount float64, stat string) {
-	if _, ok := kc.playerStats[len(kc.playerStats)-1][player.SteamID64]; ok {
-		isCT := (player.Team == 3)
-		var suffix string
-		kc.playerStats[len(kc.playerStats)-1][player.SteamID64][utils.IndexOf(stat, kc.baseStatsHeaders)] += addAmount
-		if isCT {
-			suffix = "_CT"
-		} else {
-			suffix = "_T"
-		}
-		if utils.IndexOf(stat+suffix, kc.baseStatsHeaders) != -1 {
-			kc.playerStats[len(kc.playerStats)-1][player.SteamID64][utils.IndexOf(stat+suffix, kc.baseStatsHeaders)] += addAmount
+//playerColumns returns the columns of stat counting for player in the current round:
+//the whole statistic and the variants of the side of the player and of the period of the round
+func (sh *statisticHolder) playerColumns(player *common.Player, stat string) []int {
+	indices := sh.statColumns(stat)
+	if len(indices) == 0 {
+		return nil
+	}
+	var side string
+	switch player.Team {
+	case common.TeamTerrorists:
+		side = "t"
+	case common.TeamCounterTerrorists:
+		side = "ct"
+	}
+	half := sh.basicHandler.matchFormat.Half(sh.basicHandler.roundNumber)
+
+	matched := indices[:1:1]
+	for _, index := range indices[1:] {
+		column := sh.columns[index]
+		if (column.Side != "" && column.Side == side) || (column.Half != "" && column.Half == half) {
+			matched = append(matched, index)
 		}
 	}
+	return matched
+}
 
+func (kc *statisticHolder) addToPlayerStat(player *common.Player, addAmount float64, stat string) {
+	if values, ok := kc.playerStats[len(kc.playerStats)-1][player.SteamID64]; ok {
+		for _, index := range kc.playerColumns(player, stat) {
+			values[index] += addAmount
+		}
+	}
 }
 
 func (kc *statisticHolder) setPlayerStat(player *common.Player, value float64, stat string) {
-	if _, ok := kc.playerStats[len(kc.playerStats)-1][player.SteamID64]; ok {
-		isCT := (player.Team == common.TeamCounterTerrorists)
-		var suffix string
-		roundID := len(kc.playerStats) - 1
-		kc.playerStats[roundID][player.SteamID64][utils.IndexOf(stat, kc.baseStatsHeaders)] = value
-		if isCT {
-			suffix = "_CT"
-		} else {
-			suffix = "_T"
-		}
-		if utils.IndexOf(stat+suffix, kc.baseStatsHeaders) != -1 {
-			kc.playerStats[roundID][player.SteamID64][utils.IndexOf(stat+suffix, kc.baseStatsHeaders)] = value
+	if values, ok := kc.playerStats[len(kc.playerStats)-1][player.SteamID64]; ok {
+		for _, index := range kc.playerColumns(player, stat) {
+			values[index] = value
 		}
 	}
 }
 
 func (sh *statisticHolder) getPlayerStat(player *common.Player, stat string) float64 {
-	return sh.playerStats[len(sh.playerStats)-1][player.SteamID64][utils.IndexOf(stat, sh.baseStatsHeaders)]
+	values, ok := sh.playerStats[len(sh.playerStats)-1][player.SteamID64]
+	indices := sh.statColumns(stat)
+	if !ok || len(indices) == 0 {
+		return 0
+	}
+	return values[indices[0]]
+}
+
+//matchingIndex returns the column among indices with the side and half of column, -1 when there is none
+func (sh *statisticHolder) matchingIndex(indices []int, column StatisticColumn) int {
+	for _, index := range indices {
+		if sh.columns[index].Side == column.Side && sh.columns[index].Half == column.Half {
+			return index
+		}
+	}
+	return -1
+}
+
+//fillRatios sets the ratio columns of values from the sums of their terms
+func (sh *statisticHolder) fillRatios(values []float64, sums []float64) {
+	for index, column := range sh.columns {
+		definition := column.Definition
+		if definition.Aggregation != AggregationRatio {
+			continue
+		}
+		numerator := sh.matchingIndex(sh.columnIndex[definition.Numerator], column)
+		denominator := sh.matchingIndex(sh.columnIndex[definition.Denominator], column)
+		values[index] = definition.Ratio(sums[numerator], sums[denominator])
+	}
 }
 
 func (sh *statisticHolder) GetMatchStatistic(userID uint64) ([]string, []float64, error) {
-	consolidatedStat := []float64{}
-	// var ratioHeaders []string
-	// var ratioStats []float64
-	// var denominatorStat float64
+	var sums []float64
+	aggregated := make([]float64, len(sh.columns))
+	roundsPlayed := 0
 
 	for _, roundStatMap := range sh.playerStats { //roundStatMap is map[uint64][]float64 of all base stats of the round
-		if playerStat, ok := roundStatMap[userID]; ok { //get stats for specific player and round
-			consolidatedStat = utils.ElementWiseSum(consolidatedStat, playerStat)
-			// if userID == 76561197976402790 && sh.baseStatsHeaders[0] == "Rounds" {
-			// 	fmt.Println("round", i+1, "rounds:", consolidatedStat[0], "rounds_t:", consolidatedStat[1], "rounds_ct", consolidatedStat[2])
-			// }
+		playerStat, ok := roundStatMap[userID] //get stats for specific player and round
+		if !ok {
+			continue
 		}
+		sums = utils.ElementWiseSum(sums, playerStat)
+		for index, column := range sh.columns {
+			if column.Definition.Aggregation == AggregationMax && (roundsPlayed == 0 || playerStat[index] > aggregated[index]) {
+				aggregated[index] = playerStat[index]
+			}
+		}
+		roundsPlayed++
+	}
 
+	var consolidatedStat []float64
+	if roundsPlayed > 0 {
+		for index, column := range sh.columns {
+			switch column.Definition.Aggregation {
+			case AggregationSum:
+				aggregated[index] = sums[index]
+			case AggregationMean:
+				aggregated[index] = sums[index] / float64(roundsPlayed)
+			}
+		}
+		sh.fillRatios(aggregated, sums)
+		consolidatedStat = aggregated
 	}
 
 	sh.consolidatedStats = make(map[uint64][]float64)
-	// sh.consolidatedHeaders = append(sh.baseStatsHeaders, ratioHeaders...)
-	// sh.consolidatedStats[userID] = append(consolidatedStat, ratioStats...)
-
 	sh.consolidatedHeaders = sh.baseStatsHeaders
 	sh.consolidatedStats[userID] = consolidatedStat
 
@@ -90,29 +231,16 @@ func (sh *statisticHolder) GetMatchStatistic(userID uint64) ([]string, []float64
 }
 
 func (kc *statisticHolder) AddNewRound() {
-	var newStats []float64
 	kc.playerStats = append(kc.playerStats, make(map[uint64][]float64))
-
-	for _, header := range kc.baseStatsHeaders {
-		if val, ok := kc.defaultValues[header]; ok {
-			newStats = append(newStats, val)
-		} else {
-			newStats = append(newStats, 0)
-		}
-	}
 	for _, playerMapping := range kc.basicHandler.playerMappings[kc.basicHandler.roundNumber-1] {
-		kc.playerStats[len(kc.playerStats)-1][playerMapping.playerObject.SteamID64] = make([]float64, len(kc.baseStatsHeaders))
-		copy(kc.playerStats[len(kc.playerStats)-1][playerMapping.playerObject.SteamID64], newStats)
+		kc.playerStats[len(kc.playerStats)-1][playerMapping.playerObject.SteamID64] = make([]float64, len(kc.columns))
 	}
 
 }
 
-func (kc *statisticHolder) GetRatioStatistics() [][3]string {
-	return kc.basicHandler.ratioStats
-}
-
 type PlayerStatisticCalculator interface {
 	CompositeEventHandler
 	GetRoundStatistic(roundNumber int, userID uint64) ([]string, []float64, error) //stats header, stats
 	GetMatchStatistic(userID uint64) ([]string, []float64, error)                  //stats header, stats
+	StatisticColumns() []StatisticColumn                                           //columns of the stats, in the order of the header
 }
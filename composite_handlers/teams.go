@@ -0,0 +1,153 @@
+package composite_handlers
+
+import (
+	"sort"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+const (
+	TeamA = "A" //the team that played the first round of the match as terrorists
+	TeamB = "B" //the team that played the first round of the match as counter-terrorists
+
+	//clanNameWeight is the number of players in common a matching clan name is worth when teams are told apart
+	clanNameWeight = 5
+)
+
+//Team is a team of the match, followed across side swaps by its clan name and its players
+type Team struct {
+	ID           string   `json:"id"`           //TeamA or TeamB
+	Name         string   `json:"name"`         //clan name, empty when the demo has none
+	StartingSide string   `json:"startingSide"` //"t" or "ct"
+	Score        int      `json:"score"`
+	RoundsT      int      `json:"roundsT"` //rounds played on the terrorist side
+	RoundsWonT   int      `json:"roundsWonT"`
+	RoundsCT     int      `json:"roundsCT"`
+	RoundsWonCT  int      `json:"roundsWonCT"`
+	Players      []uint64 `json:"players"` //steam ids of every player seen in the team, sorted
+}
+
+//sideRoster is what a side of a round tells about the team playing it
+type sideRoster struct {
+	name    string
+	players []uint64
+}
+
+func newSideRoster(team *common.TeamState, players []*common.Player) sideRoster {
+	roster := sideRoster{name: team.ClanName()}
+	for _, player := range players {
+		if player != nil && player.SteamID64 != 0 {
+			roster.players = append(roster.players, player.SteamID64)
+		}
+	}
+	return roster
+}
+
+//teamTracker tells which team plays each side of a round, by clan name and by roster overlap
+type teamTracker struct {
+	teams   [2]Team //TeamA then TeamB
+	players [2]map[uint64]bool
+	tTeam   int //index of the team on the terrorist side of the current round
+	started bool
+}
+
+//assignSides finds the team on each side of a round. The side swaps of the match format decide
+//when neither the clan names nor the players tell the teams apart.
+func (tt *teamTracker) assignSides(gs dem.GameState, sides [2][]*common.Player, round int, format MatchFormat) {
+	tt.assign(newSideRoster(gs.TeamTerrorists(), sides[0]), newSideRoster(gs.TeamCounterTerrorists(), sides[1]),
+		format.SidesSwapped(round))
+}
+
+func (tt *teamTracker) assign(tSide sideRoster, ctSide sideRoster, swappedByFormat bool) {
+	if !tt.started {
+		tt.started = true
+		tt.teams = [2]Team{{ID: TeamA, StartingSide: "t"}, {ID: TeamB, StartingSide: "ct"}}
+		tt.players = [2]map[uint64]bool{make(map[uint64]bool), make(map[uint64]bool)}
+		tt.tTeam = 0
+	} else {
+		kept := tt.affinity(0, tSide) + tt.affinity(1, ctSide)
+		swapped := tt.affinity(1, tSide) + tt.affinity(0, ctSide)
+		switch {
+		case kept > swapped:
+			tt.tTeam = 0
+		case swapped > kept:
+			tt.tTeam = 1
+		case swappedByFormat:
+			tt.tTeam = 1
+		default:
+			tt.tTeam = 0
+		}
+	}
+	tt.record(tt.tTeam, tSide)
+	tt.record(1-tt.tTeam, ctSide)
+}
+
+//affinity is the evidence that the team at index plays the side of roster
+func (tt *teamTracker) affinity(index int, roster sideRoster) int {
+	affinity := 0
+	if roster.name != "" && roster.name == tt.teams[index].Name {
+		affinity += clanNameWeight
+	}
+	for _, player := range roster.players {
+		if tt.players[index][player] {
+			affinity++
+		}
+	}
+	return affinity
+}
+
+func (tt *teamTracker) record(index int, roster sideRoster) {
+	team := &tt.teams[index]
+	if roster.name != "" {
+		team.Name = roster.name
+	}
+	for _, player := range roster.players {
+		if !tt.players[index][player] {
+			tt.players[index][player] = true
+			team.Players = append(team.Players, player)
+		}
+	}
+	sort.Slice(team.Players, func(a, b int) bool { return team.Players[a] < team.Players[b] })
+}
+
+//setScores records the scores of the sides once a round is won
+func (tt *teamTracker) setScores(tScore int, ctScore int) {
+	tt.teams[tt.tTeam].Score = tScore
+	tt.teams[1-tt.tTeam].Score = ctScore
+}
+
+//sides returns the ids of the teams on the terrorist and counter-terrorist sides of the current round
+func (tt *teamTracker) sides() (tTeam string, ctTeam string) {
+	if !tt.started {
+		return "", ""
+	}
+	return tt.teams[tt.tTeam].ID, tt.teams[1-tt.tTeam].ID
+}
+
+//results returns both teams with the rounds they played and won on each side
+func (tt *teamTracker) results(rounds []RoundResult) []Team {
+	if !tt.started {
+		return nil
+	}
+	teams := []Team{tt.teams[0], tt.teams[1]}
+	for i := range teams {
+		team := &teams[i]
+		team.Players = append([]uint64(nil), team.Players...)
+		for _, round := range rounds {
+			switch team.ID {
+			case round.TTeam:
+				team.RoundsT++
+				if round.Winner == "t" {
+					team.RoundsWonT++
+				}
+			case round.CTTeam:
+				team.RoundsCT++
+				if round.Winner == "ct" {
+					team.RoundsWonCT++
+				}
+			}
+		}
+	}
+	return teams
+}
@@ -0,0 +1,47 @@
+package composite_handlers
+
+import "testing"
+
+func TestTeamTrackerFollowsTeamsAcrossSides(t *testing.T) {
+	var tt teamTracker
+	alpha := sideRoster{name: "alpha", players: []uint64{1, 2, 3, 4, 5}}
+	beta := sideRoster{name: "beta", players: []uint64{6, 7, 8, 9, 10}}
+
+	tt.assign(alpha, beta, false)
+	if tTeam, ctTeam := tt.sides(); tTeam != TeamA || ctTeam != TeamB {
+		t.Fatalf("first round: got t %q ct %q", tTeam, ctTeam)
+	}
+
+	//halftime: the rosters moved sides even though the format is not consulted
+	tt.assign(beta, alpha, false)
+	if tTeam, _ := tt.sides(); tTeam != TeamB {
+		t.Errorf("after the side swap the terrorists should be team B, got %q", tTeam)
+	}
+
+	//a stand-in replaces a player and the clan names disappear: the four known players decide
+	tt.assign(sideRoster{players: []uint64{1, 2, 3, 4, 11}}, sideRoster{players: []uint64{6, 7, 8, 9, 10}}, true)
+	if tTeam, _ := tt.sides(); tTeam != TeamA {
+		t.Errorf("roster overlap should win over the format, got terrorists %q", tTeam)
+	}
+
+	//nothing tells the teams apart: the format decides
+	tt.assign(sideRoster{}, sideRoster{}, true)
+	if tTeam, _ := tt.sides(); tTeam != TeamB {
+		t.Errorf("without names nor players the format should decide, got terrorists %q", tTeam)
+	}
+
+	tt.assign(alpha, beta, false)
+	tt.setScores(13, 11)
+	rounds := []RoundResult{{TTeam: TeamA, CTTeam: TeamB, Winner: "t"}, {TTeam: TeamB, CTTeam: TeamA, Winner: "ct"},
+		{TTeam: TeamB, CTTeam: TeamA, Winner: "t"}}
+	teams := tt.results(rounds)
+	if len(teams) != 2 || teams[0].Name != "alpha" || teams[0].Score != 13 || teams[1].Score != 11 {
+		t.Fatalf("unexpected teams %+v", teams)
+	}
+	if teams[0].RoundsT != 1 || teams[0].RoundsWonT != 1 || teams[0].RoundsCT != 2 || teams[0].RoundsWonCT != 1 {
+		t.Errorf("unexpected side results of team A %+v", teams[0])
+	}
+	if len(teams[0].Players) != 6 || teams[0].Players[5] != 11 {
+		t.Errorf("the stand-in should be part of team A, got %v", teams[0].Players)
+	}
+}
@@ -0,0 +1,88 @@
+package composite_handlers
+
+import (
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+//UtilityDamageCalculator attributes grenade damage by grenade type and counts the grenades thrown.
+//Flashbangs are covered by FlashUsageCalculator.
+type UtilityDamageCalculator struct {
+	statisticHolder
+}
+
+const (
+	statHEThrown          = "he_thrown"
+	statHEDamage          = "he_damage"
+	statHEEnemiesHit      = "he_enemies_hit"
+	statFireDamage        = "fire_damage"
+	statUtilityTeamDamage = "utility_team_damage"
+	statSmokesThrown      = "smokes_thrown"
+	statMolotovsThrown    = "molotovs_thrown"
+)
+
+var utilityStatistics = RegisterStatistics(
+	sideSum(statHEThrown, "HE Grenades Thrown", UnitCount, "HE grenades thrown"),
+	sideSum(statHEDamage, "HE Damage", UnitHP, "health damage done to enemies by HE grenades"),
+	sideSum(statHEEnemiesHit, "Enemies Hit By HE", UnitCount, "enemies damaged by HE grenades, once per grenade"),
+	sideSum(statFireDamage, "Fire Damage", UnitHP, "health damage done to enemies by the fires of molotovs and incendiaries"),
+	sideSum(statUtilityTeamDamage, "Team Damage From Utility", UnitHP,
+		"health damage done to teammates by HE grenades, molotovs and incendiaries"),
+	sideSum(statSmokesThrown, "Smokes Thrown", UnitCount, "smoke grenades thrown"),
+	sideSum(statMolotovsThrown, "Molotovs Thrown", UnitCount, "molotovs and incendiaries thrown"))
+
+func (uc *UtilityDamageCalculator) Register(bh *BasicHandler) error {
+	err := uc.setupStatistics(bh, utilityStatistics...)
+	if err != nil {
+		return err
+	}
+	uc.subscriptions, err = bh.SubscribeAll(
+		Subscription{uc.GrenadeProjectileThrowHandler, GateRound},
+		Subscription{uc.PlayerHurtHandler, GateRound},
+		Subscription{uc.RoundFreezetimeEndHandler, GateAlways})
+	return err
+}
+
+func (uc *UtilityDamageCalculator) RoundFreezetimeEndHandler(e events.RoundFreezetimeEnd) {
+	if uc.basicHandler.roundNumber-1 < len(uc.playerStats) {
+		uc.playerStats = uc.playerStats[:uc.basicHandler.roundNumber-1]
+	}
+	uc.AddNewRound()
+}
+
+func (uc *UtilityDamageCalculator) GrenadeProjectileThrowHandler(e events.GrenadeProjectileThrow) {
+	if e.Projectile == nil || e.Projectile.Thrower == nil || e.Projectile.WeaponInstance == nil {
+		return
+	}
+	switch e.Projectile.WeaponInstance.Type {
+	case common.EqHE:
+		uc.addToPlayerStat(e.Projectile.Thrower, 1, statHEThrown)
+	case common.EqSmoke:
+		uc.addToPlayerStat(e.Projectile.Thrower, 1, statSmokesThrown)
+	case common.EqMolotov, common.EqIncendiary:
+		uc.addToPlayerStat(e.Projectile.Thrower, 1, statMolotovsThrown)
+	}
+}
+
+//PlayerHurtHandler attributes grenade damage to its thrower. Fires hurt over time, each hit adds to the fire damage.
+func (uc *UtilityDamageCalculator) PlayerHurtHandler(e events.PlayerHurt) {
+	if e.Attacker == nil || e.Player == nil || e.Weapon == nil || e.Attacker == e.Player {
+		return
+	}
+	isHE := e.Weapon.Type == common.EqHE
+	isFire := e.Weapon.Type == common.EqMolotov || e.Weapon.Type == common.EqIncendiary
+	if !isHE && !isFire {
+		return
+	}
+	damage := float64(e.HealthDamageTaken)
+
+	switch {
+	case e.Attacker.Team == e.Player.Team:
+		uc.addToPlayerStat(e.Attacker, damage, statUtilityTeamDamage)
+	case isHE:
+		uc.addToPlayerStat(e.Attacker, damage, statHEDamage)
+		uc.addToPlayerStat(e.Attacker, 1, statHEEnemiesHit) //an HE grenade hurts each player once
+	default:
+		uc.addToPlayerStat(e.Attacker, damage, statFireDamage)
+	}
+}
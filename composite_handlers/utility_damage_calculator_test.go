@@ -0,0 +1,46 @@
+package composite_handlers
+
+import (
+	"testing"
+
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+func TestUtilityDamageByGrenadeType(t *testing.T) {
+	thrower := &common.Player{SteamID64: 1, Team: common.TeamTerrorists}
+	teammate := &common.Player{SteamID64: 2, Team: common.TeamTerrorists}
+	enemy := &common.Player{SteamID64: 3, Team: common.TeamCounterTerrorists}
+	bh := &BasicHandler{matchFormat: DefaultMatchFormat(), roundNumber: 1}
+	bh.playerMappings = []map[uint64]playerMapping{{1: {playerObject: thrower}, 2: {playerObject: teammate},
+		3: {playerObject: enemy}}}
+	var uc UtilityDamageCalculator
+	if err := uc.setupStatistics(bh, utilityStatistics...); err != nil {
+		t.Fatal(err)
+	}
+	uc.AddNewRound()
+
+	for _, grenade := range []common.EquipmentType{common.EqHE, common.EqSmoke, common.EqIncendiary, common.EqFlash} {
+		uc.GrenadeProjectileThrowHandler(events.GrenadeProjectileThrow{
+			Projectile: &common.GrenadeProjectile{Thrower: thrower, WeaponInstance: common.NewEquipment(grenade)}})
+	}
+	hurt := func(victim *common.Player, grenade common.EquipmentType, damage int) {
+		uc.PlayerHurtHandler(events.PlayerHurt{Player: victim, Attacker: thrower, Weapon: common.NewEquipment(grenade),
+			HealthDamageTaken: damage})
+	}
+	hurt(enemy, common.EqHE, 40)
+	hurt(teammate, common.EqHE, 10)
+	hurt(enemy, common.EqIncendiary, 8)
+	hurt(enemy, common.EqIncendiary, 8)
+	hurt(enemy, common.EqAK47, 27)
+
+	for stat, want := range map[string]float64{statHEThrown: 1, statSmokesThrown: 1, statMolotovsThrown: 1,
+		statHEDamage: 40, statHEEnemiesHit: 1, statFireDamage: 16, statUtilityTeamDamage: 10} {
+		if got := uc.getPlayerStat(thrower, stat); got != want {
+			t.Errorf("%s: got %v, want %v", stat, got, want)
+		}
+	}
+	if got := uc.playerStats[0][1][uc.statColumns(statFireDamage)[2]]; got != 0 {
+		t.Errorf("a terrorist should have no counter-terrorist fire damage, got %v", got)
+	}
+}
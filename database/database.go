@@ -3,121 +3,141 @@ package database
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
+	_ "github.com/go-sql-driver/mysql" //registers the mysql driver
 
 	statistic "github.com/mrdbarros/csgo_analyze/statistic"
-	utils "github.com/mrdbarros/csgo_analyze/utils"
 )
 
 type Database struct {
 	dbConn *sql.DB
 }
 
-func (db Database) InsertPlayer(playerID uint64, playerName string) {
-	insForm, err := db.dbConn.Prepare("INSERT INTO PLAYER(idPLAYER, NAME) VALUES(?,?) ON DUPLICATE KEY UPDATE NAME=?")
-	utils.CheckError(err)
-	insForm.Exec(playerID, playerName, playerName)
-	insForm.Close()
+func (db Database) InsertPlayer(playerID uint64, playerName string) error {
+	_, err := db.dbConn.Exec("INSERT INTO PLAYER(idPLAYER, NAME) VALUES(?,?) ON DUPLICATE KEY UPDATE NAME=?", playerID, playerName, playerName)
+	return err
 }
 
-func (db Database) CheckIfProcessed( demFileHash string) bool {
+func (db Database) CheckIfProcessed(demFileHash string) (bool, error) {
 
 	sqlResult, err := db.dbConn.Query("SELECT idCSGO_MATCH FROM CSGO_MATCH WHERE DEMO_FILE_HASH=?", demFileHash)
-	utils.CheckError(err)
-	if sqlResult.Next() {
-		sqlResult.Close()
-		return true
-	} else {
-		sqlResult.Close()
-		return false
+	if err != nil {
+		return false, err
 	}
+	defer sqlResult.Close()
+	return sqlResult.Next(), sqlResult.Err()
 
 }
 
-func (db Database) InsertMatch( fileName string, demFileHash string, mapName string, terroristFirstTeamScore int, ctFirstTeamScore int,
-	matchDateTime time.Time, overwriteMatch bool) (matchID int) {
- 	
-	var	insForm *sql.Stmt
-	var err error
-	dt := matchDateTime.Format(time.RFC3339)
-	if !db.CheckIfProcessed(demFileHash){
-		insForm, err = db.dbConn.Prepare("INSERT INTO CSGO_MATCH(SCORE_FIRST_T,SCORE_FIRST_CT,MAP,MATCH_DATETIME,DEMO_FILE_HASH,FILE_NAME) VALUES(?,?,?,?,?,?)")
-		utils.CheckError(err)
-		_, err = insForm.Exec(terroristFirstTeamScore, ctFirstTeamScore, mapName, dt,demFileHash, fileName)
-		utils.CheckError(err)
-	} else {
-		insForm, err = db.dbConn.Prepare("UPDATE CSGO_MATCH SET SCORE_FIRST_T=?, SCORE_FIRST_CT=?, MAP=?, MATCH_DATETIME=?, FILE_NAME=? WHERE DEMO_FILE_HASH = ?")
-		utils.CheckError(err)
-		_, err = insForm.Exec(terroristFirstTeamScore, ctFirstTeamScore, mapName, dt, fileName,demFileHash)
-		utils.CheckError(err)
-		
+//FindMatchHash returns the hash of the match stored for the demo file fileName of mapName modified at matchDateTime
+func (db Database) FindMatchHash(fileName string, mapName string, matchDateTime time.Time) (demFileHash string, found bool, err error) {
+	err = db.dbConn.QueryRow("SELECT DEMO_FILE_HASH FROM CSGO_MATCH WHERE FILE_NAME=? AND MAP=? AND MATCH_DATETIME=? LIMIT 1",
+		fileName, mapName, matchDateTime.Format(time.RFC3339)).Scan(&demFileHash)
+	if err == sql.ErrNoRows {
+		return "", false, nil
 	}
-	
-	
-	insForm.Close()
+	return demFileHash, err == nil, err
+}
+
+//InsertMatch inserts or updates the match of demFileHash and returns its id.
+//With overwriteMatch set, statistics previously stored for the match are deleted.
+func (db Database) InsertMatch(fileName string, demFileHash string, mapName string, terroristFirstTeamScore int, ctFirstTeamScore int,
+	matchDateTime time.Time, hasRestores bool, overwriteMatch bool) (matchID int, err error) {
+
+	dt := matchDateTime.Format(time.RFC3339)
+	isProcessed, err := db.CheckIfProcessed(demFileHash)
 	if err != nil {
-		if err.(*mysql.MySQLError).Number == 1062 {
-			fmt.Println("Demo file already in database")
-			if overwriteMatch {
-				fmt.Println("Overwrite mode on. Deleting old data.")
-				insForm, err = db.dbConn.Prepare("DELETE STATISTICS_PLAYER_MATCH_FACT FROM STATISTICS_PLAYER_MATCH_FACT INNER JOIN " +
-					"CSGO_MATCH ON STATISTICS_PLAYER_MATCH_FACT.idCSGO_MATCH = CSGO_MATCH.idCSGO_MATCH WHERE CSGO_MATCH.DEMO_FILE_HASH = ?")
-				_, err = insForm.Exec(demFileHash)
-				insForm.Close()
-				utils.CheckError(err)
-			} else {
-				utils.CheckError(err)
+		return 0, err
+	}
+	if !isProcessed {
+		_, err = db.dbConn.Exec("INSERT INTO CSGO_MATCH(SCORE_FIRST_T,SCORE_FIRST_CT,MAP,MATCH_DATETIME,DEMO_FILE_HASH,FILE_NAME,HAS_RESTORES) VALUES(?,?,?,?,?,?,?)",
+			terroristFirstTeamScore, ctFirstTeamScore, mapName, dt, demFileHash, fileName, hasRestores)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		_, err = db.dbConn.Exec("UPDATE CSGO_MATCH SET SCORE_FIRST_T=?, SCORE_FIRST_CT=?, MAP=?, MATCH_DATETIME=?, FILE_NAME=?, HAS_RESTORES=? WHERE DEMO_FILE_HASH = ?",
+			terroristFirstTeamScore, ctFirstTeamScore, mapName, dt, fileName, hasRestores, demFileHash)
+		if err != nil {
+			return 0, err
+		}
+		if overwriteMatch {
+			_, err = db.dbConn.Exec("DELETE STATISTICS_PLAYER_MATCH_FACT FROM STATISTICS_PLAYER_MATCH_FACT INNER JOIN "+
+				"CSGO_MATCH ON STATISTICS_PLAYER_MATCH_FACT.idCSGO_MATCH = CSGO_MATCH.idCSGO_MATCH WHERE CSGO_MATCH.DEMO_FILE_HASH = ?", demFileHash)
+			if err != nil {
+				return 0, err
 			}
 		}
 	}
 
-	sqlResult, err := db.dbConn.Query("SELECT idCSGO_MATCH FROM CSGO_MATCH WHERE DEMO_FILE_HASH=?", demFileHash)
-	utils.CheckError(err)
-	sqlResult.Next()
-	sqlResult.Scan(&matchID)
-	sqlResult.Close()
-	return matchID
+	err = db.dbConn.QueryRow("SELECT idCSGO_MATCH FROM CSGO_MATCH WHERE DEMO_FILE_HASH=?", demFileHash).Scan(&matchID)
+	return matchID, err
 }
 
-func OpenDBConn() Database {
+//InsertMatchTeam inserts or updates a team of a match with its results on each side.
+//teamKey tells the two teams of a match apart, names are kept as found in the demo and may be empty.
+func (db Database) InsertMatchTeam(matchID int, teamKey string, teamName string, startingSide string, score int,
+	roundsT int, roundsWonT int, roundsCT int, roundsWonCT int) error {
+	_, err := db.dbConn.Exec("INSERT INTO CSGO_MATCH_TEAM(idCSGO_MATCH,TEAM_KEY,TEAM_NAME,STARTING_SIDE,SCORE,ROUNDS_T,ROUNDS_WON_T,ROUNDS_CT,ROUNDS_WON_CT) "+
+		"VALUES(?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE TEAM_NAME=?, STARTING_SIDE=?, SCORE=?, ROUNDS_T=?, ROUNDS_WON_T=?, ROUNDS_CT=?, ROUNDS_WON_CT=?",
+		matchID, teamKey, teamName, startingSide, score, roundsT, roundsWonT, roundsCT, roundsWonCT,
+		teamName, startingSide, score, roundsT, roundsWonT, roundsCT, roundsWonCT)
+	return err
+}
+
+func OpenDBConn() (Database, error) {
 	db, err := sql.Open("mysql", "marcel:basecsteste1!@tcp(127.0.0.1:3306)/CSGO_ANALYTICS")
+	if err != nil {
+		return Database{}, err
+	}
+	return Database{dbConn: db}, nil
+}
 
-	utils.CheckError(err)
-	return Database{dbConn:db}
+//BaseStatistic is a BASE_STATISTIC row: a statistic column with the metadata of its definition
+type BaseStatistic struct {
+	Name        string
+	Key         string //key of the statistic the column is a variant of
+	Description string
+	Unit        string
+	Aggregation string
 }
 
-func (db Database) InsertBaseStatistics( tempHeader []string) (statIds []int) {
+//InsertBaseStatistics inserts or updates the rows of the statistics and returns their ids, in the order of stats
+func (db Database) InsertBaseStatistics(stats []BaseStatistic) (statIds []int, err error) {
 	var newID int
-	for _, statName := range tempHeader {
-		insForm, err := db.dbConn.Prepare("INSERT IGNORE INTO BASE_STATISTIC(NAME) VALUES(?)")
-		utils.CheckError(err)
-		insForm.Exec(statName)
-		insForm.Close()
-		sqlResult, err := db.dbConn.Query("SELECT idBASE_STATISTIC FROM BASE_STATISTIC WHERE NAME=?", statName)
-		utils.CheckError(err)
-		sqlResult.Next()
-		sqlResult.Scan(&newID)
-		sqlResult.Close()
+	for _, stat := range stats {
+		_, err = db.dbConn.Exec("INSERT INTO BASE_STATISTIC(NAME,STAT_KEY,DESCRIPTION,UNIT,AGGREGATION) VALUES(?,?,?,?,?) "+
+			"ON DUPLICATE KEY UPDATE STAT_KEY=VALUES(STAT_KEY), DESCRIPTION=VALUES(DESCRIPTION), UNIT=VALUES(UNIT), AGGREGATION=VALUES(AGGREGATION)",
+			stat.Name, stat.Key, stat.Description, stat.Unit, stat.Aggregation)
+		if err != nil {
+			return nil, err
+		}
+		err = db.dbConn.QueryRow("SELECT idBASE_STATISTIC FROM BASE_STATISTIC WHERE NAME=?", stat.Name).Scan(&newID)
+		if err != nil {
+			return nil, err
+		}
 		statIds = append(statIds, newID)
 
 	}
-	return statIds
+	return statIds, nil
 }
 
-func (db Database) InsertStatisticsFacts( statIDs []int, tempData []float64, playerID uint64, matchID int) {
+func (db Database) InsertStatisticsFacts(statIDs []int, tempData []float64, playerID uint64, matchID int) error {
+	insForm, err := db.dbConn.Prepare("INSERT INTO STATISTICS_PLAYER_MATCH_FACT(idCSGO_MATCH,idPLAYER,idBASE_STATISTIC,VALUE) VALUES(?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer insForm.Close()
 	for i, statID := range statIDs {
-		insForm, err := db.dbConn.Prepare("INSERT INTO STATISTICS_PLAYER_MATCH_FACT(idCSGO_MATCH,idPLAYER,idBASE_STATISTIC,VALUE) VALUES(?,?,?,?)")
-		utils.CheckError(err)
-		insForm.Exec(matchID, playerID, statID, tempData[i])
-		insForm.Close()
+		_, err = insForm.Exec(matchID, playerID, statID, tempData[i])
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-
-
 func (db Database) GetStatistics(
 		ctx context.Context, 
 		stats []string,
@@ -175,7 +195,9 @@ func (db Database) GetStatistics(
 			var playerId uint64
 			var playerName string
 			var statValue float64
-			utils.CheckError(err)
+			if err != nil {
+				return playersStats, err
+			}
 			sqlResult.Next()
 			sqlResult.Scan(&playerId,&playerName,&statName,&statValue)
 			sqlResult.Close()
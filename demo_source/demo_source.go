@@ -0,0 +1,192 @@
+package demo_source
+
+import (
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+//separates the archive path from the entry name in demo ids
+const archiveEntrySeparator = "!"
+
+//compression suffixes understood on top of .dem
+var compressionSuffixes = []string{".gz", ".bz2", ".zst"}
+
+//Demo is a single demo stream stored on disk, either as a plain or compressed file or as an entry of a zip archive
+type Demo struct {
+	Path      string //path of the file on disk
+	EntryName string //name of the demo inside the archive, empty for files that are not archives
+	Size      int64  //size on disk of the file, or compressed size of the archive entry
+}
+
+//ID identifies the demo among all files of a directory
+func (d Demo) ID() string {
+	if d.EntryName == "" {
+		return d.Path
+	}
+	return d.Path + archiveEntrySeparator + d.EntryName
+}
+
+//Name returns the demo file name without directories and compression suffixes
+func (d Demo) Name() string {
+	name := filepath.Base(d.Path)
+	if d.EntryName != "" {
+		name = strings.TrimSuffix(name, ".zip") + "_" + filepath.Base(d.EntryName)
+	}
+	return trimCompressionSuffix(name)
+}
+
+//Open returns the decompressed demo stream
+func (d Demo) Open() (io.ReadCloser, error) {
+	if d.EntryName == "" {
+		f, err := os.Open(d.Path)
+		if err != nil {
+			return nil, err
+		}
+		return decompress(d.Path, f)
+	}
+
+	archive, err := zip.OpenReader(d.Path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range archive.File {
+		if entry.Name == d.EntryName {
+			entryReader, err := entry.Open()
+			if err != nil {
+				archive.Close()
+				return nil, err
+			}
+			stream, err := decompress(entry.Name, entryReader)
+			if err != nil {
+				archive.Close()
+				return nil, err
+			}
+			return &multiCloser{Reader: stream, closers: []io.Closer{stream, archive}}, nil
+		}
+	}
+	archive.Close()
+	return nil, fmt.Errorf("%s: no entry %s", d.Path, d.EntryName)
+}
+
+//isPlain reports whether the demo is an uncompressed file that can be read at any offset
+func (d Demo) isPlain() bool {
+	return d.EntryName == "" && trimCompressionSuffix(d.Path) == d.Path
+}
+
+//IsDemoFile reports whether name looks like a demo, a compressed demo or a zip archive of demos
+func IsDemoFile(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(trimCompressionSuffix(name), ".dem") || strings.HasSuffix(name, ".zip")
+}
+
+//List returns the demos stored in the file at path: the demo entries of a zip archive, or the file itself
+func List(path string) ([]Demo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(strings.ToLower(path), ".zip") {
+		return []Demo{{Path: path, Size: info.Size()}}, nil
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	var demos []Demo
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || !IsDemoFile(entry.Name) || strings.HasSuffix(strings.ToLower(entry.Name), ".zip") {
+			continue
+		}
+		demos = append(demos, Demo{Path: path, EntryName: entry.Name, Size: int64(entry.CompressedSize64)})
+	}
+	sort.Slice(demos, func(a, b int) bool { return demos[a].EntryName < demos[b].EntryName })
+	return demos, nil
+}
+
+//FromID returns the demo identified by id, as produced by Demo.ID
+func FromID(id string) (Demo, error) {
+	if index := strings.Index(strings.ToLower(id), ".zip"+archiveEntrySeparator); index != -1 {
+		archivePath := id[:index+len(".zip")]
+		entryName := id[index+len(".zip"+archiveEntrySeparator):]
+		demos, err := List(archivePath)
+		if err != nil {
+			return Demo{}, err
+		}
+		for _, demo := range demos {
+			if demo.EntryName == entryName {
+				return demo, nil
+			}
+		}
+		return Demo{}, fmt.Errorf("%s: no demo entry %s", archivePath, entryName)
+	}
+	demos, err := List(id)
+	if err != nil {
+		return Demo{}, err
+	}
+	if len(demos) != 1 {
+		return Demo{}, fmt.Errorf("%s holds %d demos, pick one with %s<entry>", id, len(demos), archiveEntrySeparator)
+	}
+	return demos[0], nil
+}
+
+func trimCompressionSuffix(name string) string {
+	lowerName := strings.ToLower(name)
+	for _, suffix := range compressionSuffixes {
+		if strings.HasSuffix(lowerName, suffix) {
+			return name[:len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+//decompress wraps rc with the decompressor matching the suffix of name
+func decompress(name string, rc io.ReadCloser) (io.ReadCloser, error) {
+	lowerName := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lowerName, ".gz"):
+		gzipReader, err := gzip.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &multiCloser{Reader: gzipReader, closers: []io.Closer{gzipReader, rc}}, nil
+	case strings.HasSuffix(lowerName, ".bz2"):
+		return &multiCloser{Reader: bzip2.NewReader(rc), closers: []io.Closer{rc}}, nil
+	case strings.HasSuffix(lowerName, ".zst"):
+		zstdReader, err := zstd.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &multiCloser{Reader: zstdReader, closers: []io.Closer{zstdReader.IOReadCloser(), rc}}, nil
+	}
+	return rc, nil
+}
+
+//multiCloser reads from Reader and closes every closer in order
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (mc *multiCloser) Close() error {
+	var firstErr error
+	for _, closer := range mc.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,173 @@
+package demo_source
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestPackagedDemosReadTheSameContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "demo_source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := bytes.Repeat([]byte("HL2DEMO"), 1000)
+
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write(content)
+	gzipWriter.Close()
+
+	zstdEncoder, _ := zstd.NewWriter(nil)
+	zstdContent := zstdEncoder.EncodeAll(content, nil)
+	zstdEncoder.Close()
+
+	var zipped bytes.Buffer
+	zipWriter := zip.NewWriter(&zipped)
+	for _, name := range []string{"map2.dem", "map1.dem.gz", "readme.txt"} {
+		w, _ := zipWriter.Create(name)
+		if name == "map1.dem.gz" {
+			w.Write(gzipped.Bytes())
+		} else {
+			w.Write(content)
+		}
+	}
+	zipWriter.Close()
+
+	paths := []string{
+		writeFile("plain.dem", content),
+		writeFile("match.dem.gz", gzipped.Bytes()),
+		writeFile("match.dem.zst", zstdContent),
+	}
+	zipPath := writeFile("bundle.zip", zipped.Bytes())
+
+	var demos []Demo
+	for _, path := range append(paths, zipPath) {
+		listed, err := List(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		demos = append(demos, listed...)
+	}
+	if len(demos) != 5 {
+		t.Fatalf("expected 5 demos, got %d", len(demos))
+	}
+
+	for _, demo := range demos {
+		found, err := FromID(demo.ID())
+		if err != nil || found.ID() != demo.ID() {
+			t.Errorf("%s: FromID returned %v, %v", demo.ID(), found, err)
+		}
+		rc, err := demo.Open()
+		if err != nil {
+			t.Fatalf("%s: %v", demo.ID(), err)
+		}
+		read, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(read, content) {
+			t.Errorf("%s: decompressed content differs from the original demo (err: %v)", demo.ID(), err)
+		}
+	}
+
+	if name := demos[3].Name(); name != "bundle_map1.dem" {
+		t.Errorf("unexpected zip entry name %s", name)
+	}
+}
+
+func TestHashIgnoresPackaging(t *testing.T) {
+	dir, err := ioutil.TempDir("", "demo_source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//spans two sampling strides and ends in the middle of a block
+	content := make([]byte, 2*fingerprintStride+fingerprintBlockSize/2)
+	for i := range content {
+		content[i] = byte(i * 7 % 251)
+	}
+	plainPath := filepath.Join(dir, "match.dem")
+	if err = ioutil.WriteFile(plainPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write(content)
+	gzipWriter.Close()
+	gzipPath := filepath.Join(dir, "match.dem.gz")
+	if err = ioutil.WriteFile(gzipPath, gzipped.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []string{HashFingerprint, HashFull} {
+		plainHash, err := Hash(context.Background(), Demo{Path: plainPath}, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gzipHash, err := Hash(context.Background(), Demo{Path: gzipPath}, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plainHash != gzipHash {
+			t.Errorf("%s hash differs between plain (%s) and gzipped (%s) demo", mode, plainHash, gzipHash)
+		}
+		//demos are hashed while they are parsed, in chunks of the size the parser reads
+		hasher, err := NewHasher(mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.CopyBuffer(hasher, struct{ io.Reader }{bytes.NewReader(content)}, make([]byte, 1000))
+		if streamedHash := hasher.Sum(); streamedHash != plainHash {
+			t.Errorf("%s hash of the stream (%s) differs from the hash of the demo (%s)", mode, streamedHash, plainHash)
+		}
+		_, plainSampled, _ := SampledHash(context.Background(), Demo{Path: plainPath}, mode)
+		_, gzipSampled, _ := SampledHash(context.Background(), Demo{Path: gzipPath}, mode)
+		if plainSampled != (mode == HashFingerprint) || gzipSampled {
+			t.Errorf("%s hash should only be sampled from plain demo files", mode)
+		}
+	}
+
+	//demos processed before fingerprints were keyed on the sha256 of their content
+	defaultHash, err := Hash(context.Background(), Demo{Path: plainPath}, "")
+	if sum := sha256.Sum256(content); err != nil || defaultHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("default hash should be the sha256 of the demo, got %s %v", defaultHash, err)
+	}
+
+	content[fingerprintStride+1]++
+	if err = ioutil.WriteFile(plainPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	changedHash, _ := Hash(context.Background(), Demo{Path: plainPath}, HashFingerprint)
+	gzipHash, _ := Hash(context.Background(), Demo{Path: gzipPath}, HashFingerprint)
+	if changedHash == gzipHash {
+		t.Error("fingerprint should change when a sampled block changes")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, mode := range []string{HashFingerprint, HashFull} {
+		if _, err = Hash(ctx, Demo{Path: gzipPath}, mode); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s hash of a cancelled demo: got %v, want %v", mode, err, context.Canceled)
+		}
+	}
+}
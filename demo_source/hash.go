@@ -0,0 +1,203 @@
+package demo_source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+//hash modes of a demo
+const (
+	HashFull        = "full"        //sha256 of the whole decompressed demo, the hash matches have always been stored under
+	HashFingerprint = "fingerprint" //sampled blocks of the demo, reads a few kilobytes of plain demo files
+)
+
+const (
+	fingerprintBlockSize = 4 * 1024
+	fingerprintStride    = 32 * 1024 * 1024 //distance between the starts of two sampled blocks
+)
+
+//Hasher hashes the decompressed demo content written to it
+type Hasher interface {
+	io.Writer
+	Sum() string //hex encoded hash of the content written so far
+}
+
+//NewHasher returns a hasher of mode, HashFull when empty, to hash a demo while it is read for another purpose
+func NewHasher(mode string) (Hasher, error) {
+	switch mode {
+	case HashFull, "":
+		return fullHasher{sha256.New()}, nil
+	case HashFingerprint:
+		return newBlockSampler(), nil
+	}
+	return nil, fmt.Errorf("unknown hash mode %q", mode)
+}
+
+//Hash returns the hex encoded hash of the decompressed demo content computed with mode, HashFull when empty.
+//Both modes give the same result however the demo is packaged, and the same result as NewHasher.
+//Hashing stops with the error of ctx once it is done.
+func Hash(ctx context.Context, demo Demo, mode string) (string, error) {
+	if hash, ok, err := SampledHash(ctx, demo, mode); ok || err != nil {
+		return hash, err
+	}
+	hasher, err := NewHasher(mode)
+	if err != nil {
+		return "", err
+	}
+	rc, err := demo.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	if _, err = io.Copy(hasher, contextReader{ctx, rc}); err != nil {
+		return "", err
+	}
+	return hasher.Sum(), nil
+}
+
+//SampledHash returns the hash of the demo when mode computes it from a few blocks of the demo without reading it,
+//as the fingerprint of a plain demo file. ok is false when the demo would have to be read through.
+func SampledHash(ctx context.Context, demo Demo, mode string) (sum string, ok bool, err error) {
+	if mode != HashFingerprint || !demo.isPlain() {
+		return "", false, nil
+	}
+	f, err := os.Open(demo.Path)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", false, err
+	}
+	sum, err = sampleFile(ctx, f, info.Size())
+	return sum, err == nil, err
+}
+
+type fullHasher struct {
+	hasher hash.Hash
+}
+
+func (fh fullHasher) Write(p []byte) (int, error) {
+	return fh.hasher.Write(p)
+}
+
+func (fh fullHasher) Sum() string {
+	return hex.EncodeToString(fh.hasher.Sum(nil))
+}
+
+//sampleFile fingerprints the size of the demo, a block every fingerprintStride bytes and the last block.
+//The first block holds the demo header.
+func sampleFile(ctx context.Context, f io.ReaderAt, size int64) (string, error) {
+	hasher := sha256.New()
+	writeSize(hasher, size)
+	block := make([]byte, fingerprintBlockSize)
+	for offset := int64(0); offset < size; offset += fingerprintStride {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n, err := f.ReadAt(block, offset)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		hasher.Write(block[:n])
+	}
+	tailStart := size - fingerprintBlockSize
+	if tailStart < 0 {
+		tailStart = 0
+	}
+	n, err := f.ReadAt(block, tailStart)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	hasher.Write(block[:n])
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+//contextReader fails reads with the error of ctx once it is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+func writeSize(hasher hash.Hash, size int64) {
+	var sizeBytes [8]byte
+	binary.LittleEndian.PutUint64(sizeBytes[:], uint64(size))
+	hasher.Write(sizeBytes[:])
+}
+
+//blockSampler collects the same blocks as sampleFile from a stream of unknown size
+type blockSampler struct {
+	size   int64
+	blocks []byte //sampled blocks in order
+	tail   []byte //last fingerprintBlockSize bytes seen
+}
+
+func newBlockSampler() *blockSampler {
+	return &blockSampler{tail: make([]byte, 0, 2*fingerprintBlockSize)}
+}
+
+func (bs *blockSampler) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		blockOffset := bs.size % fingerprintStride
+		var n int
+		if blockOffset < fingerprintBlockSize {
+			n = min(len(p), int(fingerprintBlockSize-blockOffset))
+			bs.blocks = append(bs.blocks, p[:n]...)
+		} else {
+			n = int(min64(int64(len(p)), fingerprintStride-blockOffset))
+		}
+		bs.appendTail(p[:n])
+		bs.size += int64(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (bs *blockSampler) appendTail(p []byte) {
+	if len(p) >= fingerprintBlockSize {
+		bs.tail = append(bs.tail[:0], p[len(p)-fingerprintBlockSize:]...)
+		return
+	}
+	bs.tail = append(bs.tail, p...)
+	if len(bs.tail) > fingerprintBlockSize {
+		bs.tail = append(bs.tail[:0], bs.tail[len(bs.tail)-fingerprintBlockSize:]...)
+	}
+}
+
+//Sum returns the fingerprint of the bytes written so far
+func (bs *blockSampler) Sum() string {
+	hasher := sha256.New()
+	writeSize(hasher, bs.size)
+	hasher.Write(bs.blocks)
+	hasher.Write(bs.tail)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -7,6 +7,7 @@ require (
 	github.com/go-kit/kit v0.10.0
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/golang/geo v0.0.0-20210108004804-a63082ebfb66 // indirect
+	github.com/klauspost/compress v1.11.13
 	github.com/markus-wa/demoinfocs-golang/v2 v2.5.0
 	github.com/markus-wa/godispatch v1.3.0
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
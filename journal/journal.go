@@ -0,0 +1,209 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Status of a demo in the journal
+type Status string
+
+const (
+	StatusQueued   Status = "queued"
+	StatusRunning  Status = "running"
+	StatusDone     Status = "done"
+	StatusSkipped  Status = "skipped"
+	StatusFailed   Status = "failed"
+	StatusTimedOut Status = "timed_out"
+)
+
+//Entry is the last known state of a demo file
+type Entry struct {
+	Path      string    `json:"path"`
+	Hash      string    `json:"hash,omitempty"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	Status    Status    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	Stage     string    `json:"stage,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+//IsFinished reports whether the demo needs no further processing
+func (e Entry) IsFinished() bool {
+	return e.Status == StatusDone || e.Status == StatusSkipped
+}
+
+//IsFailed reports whether the last attempt to process the demo failed or timed out
+func (e Entry) IsFailed() bool {
+	return e.Status == StatusFailed || e.Status == StatusTimedOut
+}
+
+//Matches reports whether the entry still describes the file with the given size and modification time
+func (e Entry) Matches(size int64, modTime time.Time) bool {
+	return e.Size == size && e.ModTime.Equal(modTime)
+}
+
+//Journal is a file backed record of the state of every demo of a batch.
+//Every update is appended as a json line, so an interrupted batch loses at most the line being written.
+type Journal struct {
+	mutex   sync.Mutex
+	path    string
+	file    *os.File
+	encoder *json.Encoder
+	entries map[string]*Entry //keyed by demo path
+	ignored []string          //lines of the file that could not be read, as messages
+}
+
+//Open loads the journal at path, creating it if needed, and compacts it to one line per demo
+func Open(path string) (*Journal, error) {
+	j := &Journal{path: path, entries: make(map[string]*Entry)}
+	err := j.load()
+	if err != nil {
+		return nil, err
+	}
+	err = j.compact()
+	if err != nil {
+		return nil, err
+	}
+	j.file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.encoder = json.NewEncoder(j.file)
+	return j, nil
+}
+
+//Load reads the journal at path without opening it for writing
+func Load(path string) (*Journal, error) {
+	j := &Journal{path: path, entries: make(map[string]*Entry)}
+	return j, j.load()
+}
+
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			//a line cut by a crash can only be the last one
+			j.ignored = append(j.ignored, fmt.Sprintf("journal %s: ignoring line %d: %v", j.path, lineNumber, err))
+			continue
+		}
+		j.entries[entry.Path] = &entry
+	}
+	return scanner.Err()
+}
+
+//Ignored returns a message for each line of the file left out when the journal was loaded
+func (j *Journal) Ignored() []string {
+	return j.ignored
+}
+
+//compact rewrites the journal file with only the latest entry of each demo
+func (j *Journal) compact() error {
+	if len(j.entries) == 0 {
+		return nil
+	}
+	tempPath := j.path + ".tmp"
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	for _, entry := range j.sortedEntries() {
+		if err = encoder.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, j.path)
+}
+
+//Lookup returns the entry of the demo at path
+func (j *Journal) Lookup(path string) (Entry, bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	entry, ok := j.entries[path]
+	if !ok {
+		return Entry{}, false
+	}
+	return *entry, true
+}
+
+//FindHash returns a finished entry with the given hash, if any demo with that content was already processed
+func (j *Journal) FindHash(hash string) (Entry, bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for _, entry := range j.entries {
+		if entry.Hash == hash && entry.IsFinished() {
+			return *entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+//Update stores the new state of a demo
+func (j *Journal) Update(entry Entry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	entry.UpdatedAt = time.Now()
+	j.entries[entry.Path] = &entry
+	if j.encoder == nil {
+		return fmt.Errorf("journal %s is read only", j.path)
+	}
+	return j.encoder.Encode(entry)
+}
+
+//Entries returns every entry sorted by path
+func (j *Journal) Entries() []Entry {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.sortedEntries()
+}
+
+func (j *Journal) sortedEntries() []Entry {
+	var entries []Entry
+	for _, entry := range j.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Path < entries[b].Path })
+	return entries
+}
+
+//Counts returns the number of demos in each status
+func (j *Journal) Counts() map[Status]int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	counts := make(map[Status]int)
+	for _, entry := range j.entries {
+		counts[entry.Status]++
+	}
+	return counts
+}
+
+func (j *Journal) Close() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
@@ -0,0 +1,68 @@
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journalPath := filepath.Join(dir, "batch_journal.jsonl")
+
+	j, err := Open(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2021, 1, 27, 20, 53, 0, 0, time.UTC)
+	entry := Entry{Path: "a.dem", Size: 10, ModTime: modTime, Status: StatusQueued}
+	for _, status := range []Status{StatusQueued, StatusRunning, StatusDone} {
+		entry.Status = status
+		if err = j.Update(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Update(Entry{Path: "b.dem", Status: StatusRunning, Attempts: 1})
+	j.Close()
+
+	j, err = Open(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	got, ok := j.Lookup("a.dem")
+	if !ok || !got.IsFinished() || !got.Matches(10, modTime) {
+		t.Errorf("unexpected entry after reopening: %+v", got)
+	}
+	got, ok = j.Lookup("b.dem")
+	if !ok || got.Status != StatusRunning || got.Attempts != 1 {
+		t.Errorf("interrupted entry not kept: %+v", got)
+	}
+
+	data, err := ioutil.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("journal should be compacted to one line per demo, got %d lines", lines)
+	}
+
+	//a line cut by a crash is left out and reported
+	if err = ioutil.WriteFile(journalPath, append(data, `{"path":"c.d`...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ignored := loaded.Ignored(); len(ignored) != 1 || !strings.Contains(ignored[0], "line 3") {
+		t.Errorf("unexpected ignored lines %v", ignored)
+	}
+}
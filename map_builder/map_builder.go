@@ -1,12 +1,12 @@
 package map_builder
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/jpeg"
 	_ "image/png" //png thru image.decode
-	"log"
 	"os"
 	"strconv"
 
@@ -78,56 +78,64 @@ type Icon struct {
 
 type MapGenerator struct {
 	mapImage    *image.NRGBA
-	iconGetter  func(Icon) *(image.Image)
+	iconGetter  func(Icon) (*image.Image, error)
 	imgSize     int
 	mapMetadata metadata.Map
 }
 
-func checkError(err error) {
-	if err != nil {
-		panic(err)
-	}
-}
-
-func iconImageGetter(iconNameToPathMap map[string]string) func(Icon) *(image.Image) {
+func iconImageGetter(iconNameToPathMap map[string]string) func(Icon) (*image.Image, error) {
 	loadedImages := make(map[string]*(image.Image))
 	iconNameToPathMapInner := iconNameToPathMap
-	return func(icon Icon) *image.Image {
+	return func(icon Icon) (*image.Image, error) {
 		iconImg, ok := loadedImages[icon.IconName]
 		if !ok {
 			fIcon, err := os.Open(iconNameToPathMapInner[icon.IconName])
-			checkError(err)
+			if err != nil {
+				return nil, err
+			}
+			defer fIcon.Close()
 			newImg, _, err := image.Decode(fIcon)
-			checkError(err)
+			if err != nil {
+				return nil, fmt.Errorf("decoding icon %s: %v", icon.IconName, err)
+			}
 			loadedImages[icon.IconName] = &newImg
 			iconImg = loadedImages[icon.IconName]
 		}
-		return iconImg
+		return iconImg, nil
 	}
 }
 
-func (mapGenerator *MapGenerator) Setup(mapMetadata metadata.Map, imgSize int) {
+func (mapGenerator *MapGenerator) Setup(mapMetadata metadata.Map, imgSize int) error {
 
 	iconNameToPath := getIconNameToImageMap()
 	mapGenerator.iconGetter = iconImageGetter(iconNameToPath)
 	mapGenerator.imgSize = imgSize
-	mapPath := getMapsToImageMap()[mapMetadata.Name]
+	mapPath, ok := getMapsToImageMap()[mapMetadata.Name]
+	if !ok {
+		return fmt.Errorf("no overview image for map %q", mapMetadata.Name)
+	}
 	mapGenerator.mapMetadata = mapMetadata
 
 	// Load map overview image
 	fMap, err := os.Open(mapPath)
-	checkError(err)
+	if err != nil {
+		return err
+	}
+	defer fMap.Close()
 	imgMap, _, err := image.Decode(fMap)
-	checkError(err)
+	if err != nil {
+		return fmt.Errorf("decoding map image %s: %v", mapPath, err)
+	}
 
 	// Create output canvas and use map overview image as base
 	img := image.NewNRGBA(imgMap.Bounds())
 	draw.Draw(img, imgMap.Bounds(), imgMap, image.ZP, draw.Over)
 	mapGenerator.mapImage = img
+	return nil
 }
 
 //DrawMap uses iconLists and mapGenerator to generate all maps from a round
-func (mapGenerator MapGenerator) DrawMap(iconLists [][]Icon) []*(image.NRGBA) {
+func (mapGenerator MapGenerator) DrawMap(iconLists [][]Icon) ([]*(image.NRGBA), error) {
 	var imgLocation image.Rectangle
 	var baseImage *image.NRGBA
 	var roundImages []*image.NRGBA
@@ -138,7 +146,11 @@ func (mapGenerator MapGenerator) DrawMap(iconLists [][]Icon) []*(image.NRGBA) {
 			baseImage = image.NewNRGBA(mapGenerator.mapImage.Bounds())
 			draw.Draw(baseImage, mapGenerator.mapImage.Bounds(), mapGenerator.mapImage, image.ZP, draw.Over)
 			for _, icon := range iconList {
-				iconImg := *mapGenerator.iconGetter(icon)
+				iconImgPointer, err := mapGenerator.iconGetter(icon)
+				if err != nil {
+					return nil, err
+				}
+				iconImg := *iconImgPointer
 
 				if icon.Rotate != 0.0 {
 					iconImg = imaging.Rotate(iconImg, icon.Rotate, color.Transparent)
@@ -161,23 +173,27 @@ func (mapGenerator MapGenerator) DrawMap(iconLists [][]Icon) []*(image.NRGBA) {
 
 	}
 
-	return roundImages
+	return roundImages, nil
 }
 
-func GenerateRoundMaps(mapGenerator MapGenerator, iconLists [][]Icon, roundPath string) {
-	roundMaps := mapGenerator.DrawMap(iconLists)
+func GenerateRoundMaps(mapGenerator MapGenerator, iconLists [][]Icon, roundPath string) error {
+	roundMaps, err := mapGenerator.DrawMap(iconLists)
+	if err != nil {
+		return err
+	}
 	for imageIndex, imgOriginal := range roundMaps {
 		img := resize.Resize(uint(mapGenerator.imgSize), 0, imgOriginal, resize.Bilinear)
 		third, err := os.Create(roundPath + "/output_map" +
 			utils.PadLeft(strconv.Itoa(imageIndex), "0", 2) + ".jpg")
 		if err != nil {
-			log.Fatalf("failed to create: %s", err)
+			return fmt.Errorf("failed to create: %s", err)
 		}
-		err = jpeg.Encode(third, img, &jpeg.Options{jpeg.DefaultQuality})
-		checkError(err)
-		imageIndex++
+		err = jpeg.Encode(third, img, &jpeg.Options{Quality: jpeg.DefaultQuality})
 		third.Close()
+		if err != nil {
+			return err
+		}
 
 	}
-
+	return nil
 }
@@ -1,192 +1,421 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"flag"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
 	"sync"
+	"time"
 
+	"github.com/mrdbarros/csgo_analyze/analysis"
 	"github.com/mrdbarros/csgo_analyze/database"
+	"github.com/mrdbarros/csgo_analyze/demo_source"
+	"github.com/mrdbarros/csgo_analyze/journal"
 
-	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
 	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+	"github.com/mrdbarros/csgo_analyze/sinks"
 
 	utils "github.com/mrdbarros/csgo_analyze/utils"
 )
 
-func ProcessDemoFile(demPath string, fileID int, destDir string, tickRate int) {
-	fileStat, err := os.Stat(demPath)
+//ProcessOptions holds the tunable parameters of a single demo processing run
+type ProcessOptions struct {
+	DestDir       string
+	TickRate      float64 //overrides the tick rate detected from each demo when set
+	Pipeline      composite_handlers.PipelineConfig
+	SkipProcessed bool
+	SkipKnown     bool          //with SkipProcessed, also skip demos found in the database that have no outputs under DestDir
+	HashMode      string        //demo_source.HashFull or demo_source.HashFingerprint
+	Timeout       time.Duration //maximum time spent on a demo, unlimited when 0
+	Policy        classificationPolicy
+	Progress      *progressReporter //optional
+}
 
-	f, err := os.Open(demPath)
-	utils.CheckError(err)
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Erro no processamento do arquivo!", r)
-		}
-	}()
-	fileName := filepath.Base(demPath)
-	fmt.Println("Processing demo: ", fileName)
-	hasher := sha256.New()
+//ProcessResult summarizes the processing of a single demo
+type ProcessResult struct {
+	Hash            string
+	RoundsCompleted int
+	Skipped         bool
+	SkipReason      string //why the classification policy skipped the demo, empty for processed demos
+	Class           string //game mode, or pov, found at the start of the demo
+	TickRate        float64
+	TickRateSource  string
+}
 
-	_, err = io.Copy(hasher, f)
-	utils.CheckError(err)
-	defer f.Close()
+//ProcessDemoFile processes the demo identified by demPath, a demo file or an archive entry as returned by demo_source.Demo.ID
+func ProcessDemoFile(ctx context.Context, demPath string, fileID int, opts ProcessOptions) (ProcessResult, error) {
+	demo, err := demo_source.FromID(demPath)
+	if err != nil {
+		return ProcessResult{}, utils.WithStage(utils.StageOpen, err)
+	}
+	return ProcessDemo(ctx, demo, fileID, opts)
+}
 
-	hashString := hex.EncodeToString(hasher.Sum(nil))
+//ProcessDemo parses a demo and writes its outputs. Returned errors are tagged with the stage where they happened.
+//Parsing stops when ctx is done or opts.Timeout expires, and the partial outputs of the demo are then removed.
+func ProcessDemo(ctx context.Context, demo demo_source.Demo, fileID int, opts ProcessOptions) (result ProcessResult, err error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
 
-	dbConn := database.OpenDBConn()
-	skipProcessedFile := true
+	fileStat, err := os.Stat(demo.Path)
+	if err != nil {
+		return result, utils.WithStage(utils.StageOpen, err)
+	}
 
-	f, err = os.Open(demPath)
-	utils.CheckError(err)
+	fileName := demo.Name()
 
-	p := dem.NewParser(f)
+	//the demo is read once, by the parser, and hashed on the way. Fingerprints of plain demo files are sampled
+	//before parsing, other demos are looked up in the database by their file to skip them without parsing.
+	var hasher demo_source.Hasher
+	result.Hash, _, err = demo_source.SampledHash(ctx, demo, opts.HashMode)
+	if err == nil && result.Hash == "" {
+		hasher, err = demo_source.NewHasher(opts.HashMode)
+	}
+	if err != nil {
+		return result, utils.WithStage(utils.StageHash, err)
+	}
 
-	header, err := p.ParseHeader()
-	utils.CheckError(err)
+	f, err := demo.Open()
+	if err != nil {
+		return result, utils.WithStage(utils.StageOpen, err)
+	}
+	defer f.Close()
 
-	fmt.Println("Map:", header.MapName)
-	rootMatchPath := destDir + "/" + header.MapName + "/" + hashString
-	dirExists, _ := utils.Exists(rootMatchPath)
+	analysisOpts := analysis.Options{TickRate: opts.TickRate, Pipeline: opts.Pipeline, Hash: result.Hash, Hasher: hasher,
+		FileName: fileName, MatchDatetime: fileStat.ModTime()}
+	var fileSink *sinks.FileSink
+	var demoHeader common.DemoHeader
+	analysisOpts.Prepare = func(header common.DemoHeader) ([]composite_handlers.MatchSink, error) {
+		opts.Progress.DemoHeader(demo.ID(), header.MapName)
+		demoHeader = header
+		hash := result.Hash
+		if hash == "" && opts.SkipProcessed {
+			storedHash, found, dbErr := findProcessedHash(fileName, header.MapName, fileStat.ModTime())
+			if dbErr != nil || !found {
+				return nil, utils.WithStage(utils.StageDatabase, dbErr)
+			}
+			hash = storedHash
+		}
+		skipErr := checkIfSkipped(header, hash, opts)
+		if errors.Is(skipErr, analysis.ErrSkip) {
+			result.Hash = hash
+		}
+		return nil, skipErr
+	}
+	analysisOpts.Classified = func(class analysis.Classification) ([]composite_handlers.MatchSink, error) {
+		result.Class = class.Class()
+		destDir := opts.DestDir
+		switch action, reason := opts.Policy.onStart(class); action {
+		case classActionSkip:
+			result.SkipReason = reason
+			return nil, analysis.ErrSkip
+		case classActionRoute:
+			destDir = routedDestDir(opts.DestDir, class)
+		}
+		var sinkErr error
+		stagingName := fmt.Sprintf(".parsing_%d_%s", fileID, fileName)
+		fileSink, sinkErr = newMatchFileSink(demoHeader, result.Hash, destDir, stagingName, opts)
+		if sinkErr != nil {
+			return nil, sinkErr
+		}
+		return []composite_handlers.MatchSink{fileSink, sinks.DatabaseSink{}, progressSink{opts.Progress, demo.ID()}}, nil
+	}
 
-	if dbConn.CheckIfProcessed(hashString) && skipProcessedFile && dirExists {
-		fmt.Println("Demo already processed, skipping...")
-		dbConn.Close()
-		return
-	} else {
-		dbConn.Close()
+	match, err := analysis.Analyze(ctx, f, analysisOpts)
+	if errors.Is(err, analysis.ErrSkip) {
+		result.Skipped = true
+		return result, nil
+	}
+	if err == nil && match != nil && fileSink != nil {
+		if action, reason := opts.Policy.onEnd(match); action == classActionSkip {
+			result.Skipped, result.SkipReason = true, reason
+			if discardErr := fileSink.Discard(); discardErr != nil {
+				opts.Progress.Warning(demo.ID(), "discarding skipped outputs: "+discardErr.Error())
+			}
+		}
 	}
+	if match != nil {
+		result.Hash = match.Metadata.Hash
+	}
+	if fileSink != nil && (ctx.Err() != nil || fileSink.Staged()) {
+		//rounds written before the demo was stopped would look like a complete match,
+		//and outputs still staged when the parse fails are not named after the demo
+		if discardErr := fileSink.Discard(); discardErr != nil {
+			opts.Progress.Warning(demo.ID(), "discarding partial outputs: "+discardErr.Error())
+		}
+	}
+	if match != nil {
+		for _, overflow := range match.Metadata.Overflows {
+			opts.Progress.Warning(demo.ID(), fmt.Sprintf("round %d: no slot left for player %d of team %s, left out of the outputs",
+				overflow.Round, overflow.SteamID, overflow.Team))
+		}
+		result.RoundsCompleted = len(match.Rounds)
+		result.TickRate, result.TickRateSource = match.Metadata.TickRate, match.Metadata.TickRateSource
+		detected, detectedSource := match.Metadata.DetectedTickRate, match.Metadata.DetectedTickRateSource
+		if opts.TickRate > 0 && detectedSource != utils.TickRateDefault && detected != opts.TickRate {
+			opts.Progress.Warning(demo.ID(), fmt.Sprintf("tick rate of %v (from %s) differs from the forced %v",
+				detected, detectedSource, opts.TickRate))
+		}
+	}
+	return result, err
+}
 
+//checkIfSkipped returns analysis.ErrSkip when the demo was already processed
+func checkIfSkipped(header common.DemoHeader, hash string, opts ProcessOptions) error {
+	if !opts.SkipProcessed {
+		return nil
+	}
+	dirExists, _ := utils.Exists(opts.DestDir + "/" + header.MapName + "/" + hash)
 	if !dirExists {
-		err = os.MkdirAll(rootMatchPath, 0700)
-		utils.CheckError(err)
+		//outputs of demos routed by their class are one directory deeper
+		routed, _ := filepath.Glob(filepath.Join(opts.DestDir, "*", header.MapName, hash))
+		dirExists = len(routed) > 0
 	}
+	if dirExists || opts.SkipKnown {
+		isProcessed, err := checkIfProcessed(hash)
+		if err != nil {
+			return utils.WithStage(utils.StageDatabase, err)
+		}
+		if isProcessed {
+			return analysis.ErrSkip
+		}
+	}
+	return nil
+}
 
-	imgSize := 800
-
-	mapMetadata := metadata.MapNameToMap[header.MapName]
-	var allIconGenerators []composite_handlers.PeriodicIconGenerator
-	var allStatGenerators []composite_handlers.StatGenerator
-	var allTabularGenerators []composite_handlers.PeriodicTabularGenerator
-	var allPlayerStatCalculators []composite_handlers.PlayerStatisticCalculator
-	var basicHandler composite_handlers.BasicHandler
-
-	basicHandler.Setup(&p, tickRate, mapMetadata, fileStat.ModTime(), fileName)
-	basicHandler.RegisterBasicEvents()
-	allTabularGenerators = append(allTabularGenerators, &basicHandler)
-	allPlayerStatCalculators = append(allPlayerStatCalculators, &basicHandler)
-
-	tradeIntervalLimit := 3.0
-	var kdatHandler composite_handlers.KDATCalculator
-	kdatHandler.Register(&basicHandler)
-	kdatHandler.Setup(tradeIntervalLimit)
-	allPlayerStatCalculators = append(allPlayerStatCalculators, &kdatHandler)
+//newMatchFileSink creates the output directory of the match under destDir and returns the sink writing to it.
+//Demos not hashed yet are written under the directory stagingName until their hash is known.
+func newMatchFileSink(header common.DemoHeader, hash string, destDir string, stagingName string,
+	opts ProcessOptions) (fileSink *sinks.FileSink, err error) {
+	mapPath := destDir + "/" + header.MapName
+	drawIcons := len(opts.Pipeline.IconGenerators) > 0
+	if hash == "" {
+		fileSink, err = sinks.NewStagedFileSink(mapPath, stagingName, metadata.MapNameToMap[header.MapName],
+			opts.Pipeline.ImgSize, drawIcons)
+	} else {
+		fileSink, err = sinks.NewFileSink(mapPath+"/"+hash, metadata.MapNameToMap[header.MapName], opts.Pipeline.ImgSize,
+			drawIcons)
+	}
+	if err != nil {
+		return nil, utils.WithStage(utils.StageSetup, err)
+	}
+	return fileSink, nil
+}
 
-	var adrHandler composite_handlers.ADRCalculator
-	adrHandler.Register(&basicHandler)
-	allPlayerStatCalculators = append(allPlayerStatCalculators, &adrHandler)
+//findProcessedHash returns the hash of the match stored for the demo file, to skip it before it is hashed
+func findProcessedHash(fileName string, mapName string, modTime time.Time) (string, bool, error) {
+	dbConn, err := database.OpenDBConn()
+	if err != nil {
+		return "", false, err
+	}
+	defer dbConn.Close()
+	return dbConn.FindMatchHash(fileName, mapName, modTime)
+}
 
-	var flashCalc composite_handlers.FlashUsageCalculator
-	flashCalc.Register(&basicHandler)
-	allPlayerStatCalculators = append(allPlayerStatCalculators, &flashCalc)
+func checkIfProcessed(demFileHash string) (bool, error) {
+	dbConn, err := database.OpenDBConn()
+	if err != nil {
+		return false, err
+	}
+	defer dbConn.Close()
+	return dbConn.CheckIfProcessed(demFileHash)
+}
 
-	var popHandler composite_handlers.PoppingGrenadeHandler
-	popHandler.SetBaseIcons()
-	popHandler.Register(&basicHandler)
+type demoFile struct {
+	demo   demo_source.Demo
+	fileID int
+	entry  journal.Entry
+}
 
-	var bmbHandler composite_handlers.BombHandler
-	bmbHandler.Register(&basicHandler)
-	allTabularGenerators = append(allTabularGenerators, &bmbHandler)
-	allPlayerStatCalculators = append(allPlayerStatCalculators, &bmbHandler)
+//batchRun processes many demos with the same options, recording their state in the journal
+type batchRun struct {
+	ctx         context.Context //stops the batch when done, demos being processed are left for the next batch
+	opts        ProcessOptions
+	report      *reportWriter
+	journal     *journal.Journal //optional
+	maxAttempts int
+}
 
-	var playerHandler composite_handlers.PlayerPeriodicInfoHandler
-	playerHandler.Register(&basicHandler)
-	allTabularGenerators = append(allTabularGenerators, &playerHandler)
+//startWorkers starts workerCount workers processing the demos sent on jobChan until it is closed
+func (br *batchRun) startWorkers(workerCount int, jobChan <-chan demoFile) *sync.WaitGroup {
+	wg := new(sync.WaitGroup)
+	wg.Add(workerCount)
+	for i := 0; i < workerCount; i++ {
+		go br.worker(wg, jobChan)
+	}
+	return wg
+}
 
-	generateIcons := false
-	if generateIcons {
-		allIconGenerators = append(allIconGenerators, &popHandler)
-		allIconGenerators = append(allIconGenerators, &bmbHandler)
-		allIconGenerators = append(allIconGenerators, &playerHandler)
-		allIconGenerators = append(allIconGenerators, &flashCalc)
+func (br *batchRun) worker(wg *sync.WaitGroup, jobChan <-chan demoFile) {
+	defer wg.Done()
+	for demFile := range jobChan {
+		if br.ctx.Err() != nil {
+			continue //drain the queue, the journal keeps the demo queued
+		}
+		br.opts.Progress.DemoStarted(demFile.demo.ID(), demFile.demo.Name(), demFile.demo.Size)
+		result, err := br.processWithRetries(demFile)
+		report := newDemoReport(demFile.demo.ID(), result, err)
+		br.opts.Progress.DemoFinished(demFile.demo.ID(), report)
+		if reportErr := br.report.Write(report); reportErr != nil {
+			br.opts.Progress.Warning(demFile.demo.ID(), "writing batch report: "+reportErr.Error())
+		}
 	}
+}
 
-	var infoHandler composite_handlers.InfoGenerationHandler
-	updateInterval := 2.0 //# of seconds between framegroups
-	infoHandler.Register(&basicHandler)
-	infoHandler.Setup(imgSize, updateInterval, rootMatchPath, hashString,
-		&allIconGenerators, &allTabularGenerators, &allStatGenerators, &allPlayerStatCalculators)
+//processWithRetries processes a demo until it succeeds, times out or runs out of attempts
+func (br *batchRun) processWithRetries(demFile demoFile) (result ProcessResult, err error) {
+	entry := demFile.entry
+	for entry.Attempts < br.maxAttempts {
+		entry.Attempts++
+		entry.Status = journal.StatusRunning
+		br.updateJournal(entry)
+
+		result, err = ProcessDemo(br.ctx, demFile.demo, demFile.fileID, br.opts)
+		if br.ctx.Err() != nil {
+			//the attempt does not count, the demo is processed again by the next batch
+			entry.Attempts--
+			entry.Status = journal.StatusQueued
+			br.updateJournal(entry)
+			return result, err
+		}
+		entry.Hash = result.Hash
+		entry.Stage, entry.Error = "", ""
+		if err == nil {
+			entry.Status = journal.StatusDone
+			if result.Skipped {
+				entry.Status = journal.StatusSkipped
+			}
+			br.updateJournal(entry)
+			return result, nil
+		}
 
-	err = p.ParseToEnd()
-	p.Close()
+		entry.Status = journal.StatusFailed
+		timedOut := errors.Is(err, context.DeadlineExceeded)
+		if timedOut {
+			entry.Status = journal.StatusTimedOut
+		}
+		report := newDemoReport(demFile.demo.ID(), result, err)
+		entry.Stage, entry.Error = report.Stage, report.Error
+		br.updateJournal(entry)
+		if timedOut {
+			//another attempt with the same timeout would time out again, a later batch may give it a longer one
+			break
+		}
+	}
+	return result, err
+}
 
-	utils.CheckError(err)
+//close flushes the report and the journal of the batch
+func (br *batchRun) close() {
+	br.report.Close()
+	if br.journal != nil {
+		br.journal.Close()
+	}
+}
 
-	// Parse to end
+func (br *batchRun) updateJournal(entry journal.Entry) {
+	if br.journal == nil {
+		return
+	}
+	if err := br.journal.Update(entry); err != nil {
+		br.opts.Progress.Warning(entry.Path, "writing batch journal: "+err.Error())
+	}
 }
 
-type demoFile struct {
-	demPath  string
-	fileID   int
-	destDir  string
-	tickRate int
+//needsProcessing returns the journal entry to process the demo with, or false when the journal
+//shows the demo is finished or has exhausted its attempts. info describes the file holding the demo.
+func (br *batchRun) needsProcessing(demo demo_source.Demo, info os.FileInfo) (journal.Entry, bool) {
+	path := demo.ID()
+	newEntry := journal.Entry{Path: path, Size: info.Size(), ModTime: info.ModTime(), Status: journal.StatusQueued}
+	if br.journal == nil {
+		return newEntry, true
+	}
+	entry, ok := br.journal.Lookup(path)
+	if !ok || !entry.Matches(info.Size(), info.ModTime()) {
+		br.updateJournal(newEntry)
+		return newEntry, true
+	}
+	if entry.IsFinished() || (entry.IsFailed() && entry.Attempts >= br.maxAttempts) {
+		return entry, false
+	}
+	//queued, running when the last batch was interrupted, or failed or timed out with attempts left
+	return entry, true
 }
 
-func worker(wg *sync.WaitGroup, jobChan <-chan demoFile) {
-	defer wg.Done()
-	for demFile := range jobChan {
-		fmt.Println("Demos left:", len(jobChan))
-		ProcessDemoFile(demFile.demPath, demFile.fileID, demFile.destDir, demFile.tickRate)
+//processDir walks demDir and processes every demo found, including compressed demos and the demos of zip archives, with workerCount workers
+func (br *batchRun) processDir(demDir string, workerCount int) error {
+	jobs, resumedCount, err := br.collectJobs(demDir)
+	if err != nil {
+		return err
+	}
+	var totalBytes int64
+	for _, job := range jobs {
+		totalBytes += job.demo.Size
 	}
+	br.opts.Progress.BatchStarted(len(jobs), totalBytes, resumedCount)
+	defer br.opts.Progress.BatchFinished()
+
+	// make a channel with a capacity of 500.
+	jobChan := make(chan demoFile, 500)
+	wg := br.startWorkers(workerCount, jobChan)
+
+	for _, job := range jobs {
+		// enqueue a job
+		select {
+		case jobChan <- job:
+		case <-br.ctx.Done():
+		}
+		if br.ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobChan)
+	wg.Wait()
+	return br.ctx.Err()
 }
 
-func main() {
-	demPath := os.Args[2]
-	destDir := os.Args[3]
-
-	mode := flag.String("mode", "file", "process mode (file/dir)")
-	fileID := 0
-	tickRate, _ := strconv.Atoi(os.Args[4])
-	flag.Parse()
-	if *mode == "file" {
-		ProcessDemoFile(demPath, fileID, destDir, tickRate)
-	} else if *mode == "dir" {
-		workerCount := 7
-		// use a WaitGroup
-		var wg sync.WaitGroup
-
-		// make a channel with a capacity of 100.
-		jobChan := make(chan demoFile, 500)
-
-		for i := 0; i < workerCount; i++ {
-			go worker(&wg, jobChan)
-		}
-		wg.Add(workerCount)
-
-		filepath.Walk(demPath, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				fmt.Printf("prevent panic by handling failure accessing a path %q: %v\n", path, err)
-				return err
-			}
-			if info.IsDir() {
-				return nil
-			}
-			// enqueue a job
-			jobChan <- demoFile{demPath: path, fileID: fileID, destDir: destDir, tickRate: tickRate}
-			fileID++
+//collectJobs walks demDir for the demos to process, counting those the journal shows as handled
+func (br *batchRun) collectJobs(demDir string) (jobs []demoFile, resumedCount int, err error) {
+	err = filepath.Walk(demDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			br.opts.Progress.Warning(path, "walking the demo directory: "+err.Error())
+			return err
+		}
+		if br.ctx.Err() != nil {
+			return br.ctx.Err()
+		}
+		if info.IsDir() || !demo_source.IsDemoFile(info.Name()) {
+			return nil
+		}
+		demos, err := demo_source.List(path)
+		if err != nil {
+			br.opts.Progress.Warning(path, "skipping unreadable archive: "+err.Error())
 			return nil
-		})
-		wg.Wait()
+		}
+		for _, demo := range demos {
+			entry, ok := br.needsProcessing(demo, info)
+			if !ok {
+				resumedCount++
+				continue
+			}
+			jobs = append(jobs, demoFile{demo: demo, fileID: len(jobs), entry: entry})
+		}
+		return nil
+	})
+	return jobs, resumedCount, err
+}
 
-	} else {
-		log.Fatal("invalid mode.")
+func main() {
+	err := runCommand(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
 	}
-
 }
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
 	"github.com/mrdbarros/csgo_analyze/utils"
 )
 
@@ -14,6 +16,13 @@ func TestProcessDemoFile(t *testing.T) {
 	if dirExists {
 		utils.RemoveContents(destFolder)
 	}
-	ProcessDemoFile("/home/marcel/projetos/data/csgo_analyze/replays/0/2021-01-27__2053__1__10613458__de_inferno__timewess__vs__c4base.dem", 0,
-		destFolder, 32)
+	demPath := "/home/marcel/projetos/data/csgo_analyze/replays/0/2021-01-27__2053__1__10613458__de_inferno__timewess__vs__c4base.dem"
+	if demExists, _ := utils.Exists(demPath); !demExists {
+		t.Skip("test demo not available")
+	}
+	_, err := ProcessDemoFile(context.Background(), demPath, 0, ProcessOptions{DestDir: destFolder, TickRate: 32,
+		Pipeline: composite_handlers.DefaultPipelineConfig(), SkipProcessed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
 }
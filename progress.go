@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+)
+
+//progress events
+const (
+	eventBatchStarted  = "batch_started"
+	eventBatchFinished = "batch_finished"
+	eventDemoQueued    = "demo_queued"
+	eventDemoStarted   = "demo_started"
+	eventDemoHeader    = "demo_header"
+	eventRound         = "round"
+	eventWarning       = "warning"
+	eventDemoFinished  = "demo_finished"
+)
+
+const bytesPerMB = 1024 * 1024
+
+//progressReporter emits the progress of a run as json lines through a go-kit logger and optionally
+//renders it as a single terminal line. A nil reporter discards every event.
+type progressReporter struct {
+	mutex  sync.Mutex
+	logger kitlog.Logger
+	view   io.Writer //terminal the progress line is drawn on, nil when disabled
+
+	start         time.Time
+	totalDemos    int
+	totalBytes    int64
+	finishedDemos int
+	finishedBytes int64
+	failedDemos   int
+	running       map[string]*runningDemo //keyed by demo id
+}
+
+type runningDemo struct {
+	name        string
+	size        int64
+	start       time.Time
+	round       int
+	totalRounds int //last round the match can reach in the period of round
+}
+
+//newProgressReporter writes json lines to events and draws the terminal view on view. Both are optional.
+func newProgressReporter(events io.Writer, view io.Writer) *progressReporter {
+	logger := kitlog.NewNopLogger()
+	if events != nil {
+		logger = kitlog.NewJSONLogger(kitlog.NewSyncWriter(events))
+		logger = kitlog.With(logger, "ts", kitlog.DefaultTimestampUTC)
+	}
+	return &progressReporter{logger: logger, view: view, start: time.Now(), running: make(map[string]*runningDemo)}
+}
+
+//BatchStarted records the demos the run will process, used for the throughput and eta of the batch.
+//resumed counts the demos left out because the journal shows them as handled by an earlier batch.
+func (pr *progressReporter) BatchStarted(demos int, bytes int64, resumed int) {
+	if pr == nil {
+		return
+	}
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.start = time.Now()
+	pr.totalDemos, pr.totalBytes = demos, bytes
+	pr.logger.Log("event", eventBatchStarted, "demos", demos, "mb", toMB(bytes), "resumed", resumed)
+	pr.draw()
+}
+
+func (pr *progressReporter) BatchFinished() {
+	if pr == nil {
+		return
+	}
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	elapsed := time.Since(pr.start)
+	pr.logger.Log("event", eventBatchFinished, "demos", pr.finishedDemos, "failed", pr.failedDemos,
+		"elapsed", elapsed.Seconds(), "mbps", rate(pr.finishedBytes, elapsed))
+	if pr.view != nil {
+		fmt.Fprintln(pr.view)
+	}
+}
+
+//DemoQueued adds a demo to a run whose demos are not known when it starts, such as a watch
+func (pr *progressReporter) DemoQueued(id string, size int64) {
+	if pr == nil {
+		return
+	}
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.totalDemos++
+	pr.totalBytes += size
+	pr.logger.Log("event", eventDemoQueued, "demo", id, "mb", toMB(size))
+	pr.draw()
+}
+
+func (pr *progressReporter) DemoStarted(id string, name string, size int64) {
+	if pr == nil {
+		return
+	}
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.running[id] = &runningDemo{name: name, size: size, start: time.Now()}
+	pr.logger.Log("event", eventDemoStarted, "demo", id, "mb", toMB(size))
+	pr.draw()
+}
+
+func (pr *progressReporter) DemoHeader(id string, mapName string) {
+	if pr == nil {
+		return
+	}
+	pr.logger.Log("event", eventDemoHeader, "demo", id, "map", mapName)
+}
+
+//Round records a generated round, round of totalRounds. totalRounds is the last round of the period of round
+//and grows when the match goes to overtime. progress is the fraction of the demo parsed so far.
+func (pr *progressReporter) Round(id string, round int, totalRounds int, score string, progress float64) {
+	if pr == nil {
+		return
+	}
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	if demo, ok := pr.running[id]; ok {
+		demo.round, demo.totalRounds = round, totalRounds
+	}
+	pr.logger.Log("event", eventRound, "demo", id, "round", round, "total_rounds", totalRounds, "score", score,
+		"progress", progress)
+	pr.draw()
+}
+
+//Warning reports a problem that does not stop the run, id is empty when it concerns no demo.
+//The terminal view prints it above the progress line.
+func (pr *progressReporter) Warning(id string, msg string) {
+	if pr == nil {
+		return
+	}
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	pr.logger.Log("event", eventWarning, "demo", id, "msg", msg)
+	if pr.view != nil {
+		if id != "" {
+			msg = id + ": " + msg
+		}
+		fmt.Fprintf(pr.view, "\r\033[K%s\n", msg)
+		pr.draw()
+	}
+}
+
+//DemoFinished records the outcome of a demo and emits the throughput and eta of the batch
+func (pr *progressReporter) DemoFinished(id string, report demoReport) {
+	if pr == nil {
+		return
+	}
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+	demo, ok := pr.running[id]
+	if !ok {
+		demo = &runningDemo{start: time.Now()}
+	}
+	delete(pr.running, id)
+	pr.finishedDemos++
+	if report.Status == demoStatusSkipped {
+		//skipped demos are barely read, counting their bytes would inflate the throughput and shorten the eta
+		pr.totalBytes -= demo.size
+	} else {
+		pr.finishedBytes += demo.size
+	}
+	if report.Status == demoStatusFailed || report.Status == demoStatusTimedOut {
+		pr.failedDemos++
+	}
+
+	elapsed := time.Since(demo.start)
+	keyvals := []interface{}{"event", eventDemoFinished, "demo", id, "status", report.Status, "rounds", report.RoundsCompleted,
+		"elapsed", elapsed.Seconds(), "mbps", rate(demo.size, elapsed), "done", pr.finishedDemos, "total", pr.totalDemos,
+		"batch_mbps", rate(pr.finishedBytes, time.Since(pr.start))}
+	if eta, ok := pr.eta(); ok {
+		keyvals = append(keyvals, "eta", eta.Seconds())
+	}
+	if report.Status != demoStatusDone && report.Status != demoStatusSkipped {
+		keyvals = append(keyvals, "stage", report.Stage, "error", report.Error)
+	}
+	if report.SkipReason != "" {
+		keyvals = append(keyvals, "skip_reason", report.SkipReason)
+	}
+	pr.logger.Log(keyvals...)
+	pr.draw()
+}
+
+//eta extrapolates the time left from the bytes processed so far
+func (pr *progressReporter) eta() (time.Duration, bool) {
+	if pr.finishedBytes == 0 || pr.totalBytes <= pr.finishedBytes {
+		return 0, false
+	}
+	elapsed := time.Since(pr.start)
+	return time.Duration(float64(elapsed) * float64(pr.totalBytes-pr.finishedBytes) / float64(pr.finishedBytes)), true
+}
+
+//draw rewrites the terminal progress line, must be called with the mutex held
+func (pr *progressReporter) draw() {
+	if pr.view == nil {
+		return
+	}
+	line := fmt.Sprintf("[%d/%d] %d failed  %.1f MB/s", pr.finishedDemos, pr.totalDemos, pr.failedDemos,
+		rate(pr.finishedBytes, time.Since(pr.start)))
+	if eta, ok := pr.eta(); ok {
+		line += "  eta " + eta.Round(time.Second).String()
+	}
+
+	var running []string
+	for _, demo := range pr.running {
+		running = append(running, fmt.Sprintf("%s r%d/%d", demo.name, demo.round, demo.totalRounds))
+	}
+	sort.Strings(running)
+	if len(running) > 0 {
+		line += "  | " + strings.Join(running, ", ")
+	}
+	const maxWidth = 160
+	if len(line) > maxWidth {
+		line = line[:maxWidth-3] + "..."
+	}
+	fmt.Fprintf(pr.view, "\r\033[K%s", line)
+}
+
+func toMB(bytes int64) float64 {
+	return float64(bytes) / bytesPerMB
+}
+
+func rate(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return toMB(bytes) / elapsed.Seconds()
+}
+
+//progressSink reports every round of a demo as it is generated
+type progressSink struct {
+	reporter *progressReporter
+	demoID   string
+}
+
+func (ps progressSink) WriteRound(match *composite_handlers.MatchResult, round *composite_handlers.RoundResult) error {
+	ps.reporter.Round(ps.demoID, round.Number, match.Metadata.MatchFormat.PeriodEnd(round.Number), round.Score, match.Progress)
+	return nil
+}
+
+func (ps progressSink) WriteMatch(match *composite_handlers.MatchResult) error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestProgressReporterEvents(t *testing.T) {
+	var events, view bytes.Buffer
+	pr := newProgressReporter(&events, &view)
+	pr.BatchStarted(2, 2*bytesPerMB, 0)
+	pr.DemoStarted("a.dem", "a.dem", bytesPerMB)
+	pr.Round("a.dem", 3, 30, "03_ct_02_t_00", 0.25)
+	pr.DemoFinished("a.dem", demoReport{Status: demoStatusFailed, Stage: "parse", Error: "boom"})
+	pr.BatchFinished()
+
+	lines := strings.Split(strings.TrimSpace(events.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 events, got %q", lines)
+	}
+	var finished map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[3]), &finished); err != nil {
+		t.Fatal(err)
+	}
+	if finished["event"] != eventDemoFinished || finished["done"] != 1.0 || finished["total"] != 2.0 ||
+		finished["stage"] != "parse" || finished["eta"] == nil {
+		t.Errorf("unexpected demo_finished event %v", finished)
+	}
+	var round map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[2]), &round); err != nil || round["total_rounds"] != 30.0 {
+		t.Errorf("unexpected round event %v %v", round, err)
+	}
+	if !strings.Contains(view.String(), "a.dem r3/30") || !strings.Contains(view.String(), "[1/2] 1 failed") {
+		t.Errorf("unexpected terminal view %q", view.String())
+	}
+
+	//a nil reporter discards everything
+	var nilReporter *progressReporter
+	nilReporter.DemoStarted("a.dem", "a.dem", 1)
+}
+
+func TestProgressReporterLeavesSkippedDemosOutOfThroughput(t *testing.T) {
+	var view bytes.Buffer
+	pr := newProgressReporter(nil, &view)
+	pr.BatchStarted(2, 3*bytesPerMB, 0)
+	pr.DemoStarted("a.dem", "a.dem", bytesPerMB)
+	pr.DemoFinished("a.dem", demoReport{Status: demoStatusSkipped})
+	if pr.finishedBytes != 0 || pr.totalBytes != 2*bytesPerMB {
+		t.Errorf("skipped demo counted in the throughput: finished %d, total %d", pr.finishedBytes, pr.totalBytes)
+	}
+	if _, ok := pr.eta(); ok {
+		t.Error("no eta should be given before a demo is processed")
+	}
+
+	pr.Warning("", "journal write failed")
+	if !strings.Contains(view.String(), "journal write failed\n") {
+		t.Errorf("warning missing from the terminal view %q", view.String())
+	}
+}
@@ -0,0 +1,5 @@
+ALTER TABLE BASE_STATISTIC
+	ADD COLUMN STAT_KEY VARCHAR(64) NOT NULL DEFAULT '',
+	ADD COLUMN DESCRIPTION VARCHAR(255) NOT NULL DEFAULT '',
+	ADD COLUMN UNIT VARCHAR(16) NOT NULL DEFAULT '',
+	ADD COLUMN AGGREGATION VARCHAR(16) NOT NULL DEFAULT 'sum'
@@ -0,0 +1 @@
+ALTER TABLE CSGO_MATCH ADD COLUMN HAS_RESTORES TINYINT(1) NOT NULL DEFAULT 0
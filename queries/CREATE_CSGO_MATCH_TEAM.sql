@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS CSGO_MATCH_TEAM (
+	idCSGO_MATCH INT NOT NULL,
+	TEAM_KEY CHAR(1) NOT NULL,
+	TEAM_NAME VARCHAR(128) NOT NULL DEFAULT '',
+	STARTING_SIDE CHAR(2) NOT NULL,
+	SCORE INT NOT NULL,
+	ROUNDS_T INT NOT NULL,
+	ROUNDS_WON_T INT NOT NULL,
+	ROUNDS_CT INT NOT NULL,
+	ROUNDS_WON_CT INT NOT NULL,
+	PRIMARY KEY (idCSGO_MATCH, TEAM_KEY),
+	INDEX TEAM_NAME_IDX (TEAM_NAME),
+	FOREIGN KEY (idCSGO_MATCH) REFERENCES CSGO_MATCH(idCSGO_MATCH) ON DELETE CASCADE
+)
@@ -0,0 +1,7 @@
+SELECT CSGO_MATCH_TEAM.TEAM_NAME, CSGO_MATCH.MAP, COUNT(*) AS MATCHES,
+	SUM(CSGO_MATCH_TEAM.ROUNDS_WON_T) AS ROUNDS_WON_T, SUM(CSGO_MATCH_TEAM.ROUNDS_T) AS ROUNDS_T,
+	SUM(CSGO_MATCH_TEAM.ROUNDS_WON_CT) AS ROUNDS_WON_CT, SUM(CSGO_MATCH_TEAM.ROUNDS_CT) AS ROUNDS_CT
+	FROM CSGO_MATCH_TEAM
+	INNER JOIN CSGO_MATCH ON CSGO_MATCH.idCSGO_MATCH = CSGO_MATCH_TEAM.idCSGO_MATCH
+	WHERE CSGO_MATCH_TEAM.TEAM_NAME != ''
+	GROUP BY CSGO_MATCH_TEAM.TEAM_NAME, CSGO_MATCH.MAP
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	utils "github.com/mrdbarros/csgo_analyze/utils"
+)
+
+//status of a demo in the batch report
+const (
+	demoStatusDone        = "done"
+	demoStatusSkipped     = "skipped"
+	demoStatusFailed      = "failed"
+	demoStatusTimedOut    = "timed_out"   //stopped by the per demo timeout
+	demoStatusInterrupted = "interrupted" //stopped by a signal, left for the next batch
+)
+
+//demoReport is a single line of the batch report
+type demoReport struct {
+	DemoPath        string  `json:"demoPath"`
+	Hash            string  `json:"hash,omitempty"`
+	Status          string  `json:"status"`
+	SkipReason      string  `json:"skipReason,omitempty"` //set when the classification policy skipped the demo
+	Class           string  `json:"class,omitempty"`
+	Stage           string  `json:"stage,omitempty"`
+	Error           string  `json:"error,omitempty"`
+	RoundsCompleted int     `json:"roundsCompleted"`
+	TickRate        float64 `json:"tickRate,omitempty"`
+	TickRateSource  string  `json:"tickRateSource,omitempty"`
+}
+
+func newDemoReport(demPath string, result ProcessResult, err error) demoReport {
+	report := demoReport{DemoPath: demPath, Hash: result.Hash, RoundsCompleted: result.RoundsCompleted,
+		TickRate: result.TickRate, TickRateSource: result.TickRateSource, SkipReason: result.SkipReason, Class: result.Class}
+	switch {
+	case err != nil:
+		report.Status = demoStatusFailed
+		if errors.Is(err, context.DeadlineExceeded) {
+			report.Status = demoStatusTimedOut
+		} else if errors.Is(err, context.Canceled) {
+			report.Status = demoStatusInterrupted
+		}
+		report.Error = err.Error()
+		var stageErr *utils.StageError
+		if errors.As(err, &stageErr) {
+			report.Stage = stageErr.Stage
+			report.Error = stageErr.Err.Error()
+		}
+	case result.Skipped:
+		report.Status = demoStatusSkipped
+	default:
+		report.Status = demoStatusDone
+	}
+	return report
+}
+
+//reportWriter appends demo reports as json lines, safe for use by several workers
+type reportWriter struct {
+	mutex       sync.Mutex
+	file        *os.File
+	encoder     *json.Encoder
+	failedCount int
+}
+
+func openReportWriter(reportPath string) (*reportWriter, error) {
+	file, err := os.OpenFile(reportPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &reportWriter{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (rw *reportWriter) Write(report demoReport) error {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	if report.Status == demoStatusFailed || report.Status == demoStatusTimedOut {
+		rw.failedCount++
+	}
+	return rw.encoder.Encode(report)
+}
+
+//FailedCount returns the number of failed demos written so far
+func (rw *reportWriter) FailedCount() int {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	return rw.failedCount
+}
+
+func (rw *reportWriter) Close() error {
+	return rw.file.Close()
+}
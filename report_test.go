@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	utils "github.com/mrdbarros/csgo_analyze/utils"
+)
+
+func TestNewDemoReport(t *testing.T) {
+	result := ProcessResult{Hash: "abc", RoundsCompleted: 12}
+	report := newDemoReport("a.dem", result, utils.WithStage(utils.StageDatabase, errors.New("connection refused")))
+	if report.Status != demoStatusFailed || report.Stage != utils.StageDatabase ||
+		report.Error != "connection refused" || report.RoundsCompleted != 12 {
+		t.Errorf("unexpected failed report %+v", report)
+	}
+
+	report = newDemoReport("a.dem", ProcessResult{Hash: "abc", Skipped: true}, nil)
+	if report.Status != demoStatusSkipped || report.Stage != "" {
+		t.Errorf("unexpected skipped report %+v", report)
+	}
+}
+
+func TestNewDemoReportTimedOut(t *testing.T) {
+	report := newDemoReport("a.dem", ProcessResult{}, utils.WithStage(utils.StageParse, context.DeadlineExceeded))
+	if report.Status != demoStatusTimedOut || report.Stage != utils.StageParse {
+		t.Errorf("unexpected timed out report %+v", report)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+	statistic "github.com/mrdbarros/csgo_analyze/statistic"
+)
+
+//addDerivedStatistics adds the derived statistics and the ratings of each player from the sums of their terms,
+//computed in Go so that they do not depend on the RATIO_STATISTIC table. Ratios the repository already returned
+//are kept, ratings it returned are replaced by the ratings of the summed terms, since a sum of ratings is not a rating.
+func addDerivedStatistics(playersStats statistic.PlayersStatistics) (statistic.PlayersStatistics, error) {
+	var playerIDs []uint64
+	names := make(map[uint64]string)
+	values := make(map[uint64]map[string]float64)
+	rows := make(map[uint64]map[string]int)
+	for i, playerID := range playersStats.PlayerId {
+		if _, ok := values[playerID]; !ok {
+			playerIDs = append(playerIDs, playerID)
+			names[playerID] = playersStats.PlayerName[i]
+			values[playerID] = make(map[string]float64)
+			rows[playerID] = make(map[string]int)
+		}
+		values[playerID][playersStats.StatisticsName[i]] = playersStats.StatisticValue[i]
+		rows[playerID][playersStats.StatisticsName[i]] = i
+	}
+
+	for _, playerID := range playerIDs {
+		columns, derived, err := composite_handlers.DeriveStatistics(composite_handlers.DefaultDerivedStatistics,
+			values[playerID])
+		if err != nil {
+			return playersStats, err
+		}
+		for i, column := range columns {
+			if _, ok := values[playerID][column.Header]; ok {
+				continue
+			}
+			playersStats = appendStatistic(playersStats, playerID, names[playerID], column.Header, derived[i])
+		}
+
+		columns, rated, err := composite_handlers.RateStatistics(values[playerID])
+		if err != nil {
+			return playersStats, err
+		}
+		for i, column := range columns {
+			if row, ok := rows[playerID][column.Header]; ok {
+				playersStats.StatisticValue[row] = rated[i]
+				continue
+			}
+			playersStats = appendStatistic(playersStats, playerID, names[playerID], column.Header, rated[i])
+		}
+	}
+	return playersStats, nil
+}
+
+func appendStatistic(playersStats statistic.PlayersStatistics, playerID uint64, playerName string, name string,
+	value float64) statistic.PlayersStatistics {
+	playersStats.StatisticsName = append(playersStats.StatisticsName, name)
+	playersStats.PlayerId = append(playersStats.PlayerId, playerID)
+	playersStats.PlayerName = append(playersStats.PlayerName, playerName)
+	playersStats.StatisticValue = append(playersStats.StatisticValue, value)
+	return playersStats
+}
@@ -36,6 +36,11 @@ func (s service) GetStatistics(ctx context.Context,
 		level.Error(logger).Log("err", err)
 		return statistic.PlayersStatistics{}, err
 	}
+	playersStats, err = addDerivedStatistics(playersStats)
+	if err != nil {
+		level.Error(logger).Log("err", err)
+		return statistic.PlayersStatistics{}, err
+	}
 
 	logger.Log("got statistics")
 
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+//NewHTTPServer exposes the service endpoints over http
+func NewHTTPServer(ctx context.Context, endpoints Endpoints) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/statistics", httptransport.NewServer(
+		endpoints.GetStatistics,
+		decodeUserReq,
+		encodeResponse,
+	))
+
+	return mux
+}
@@ -0,0 +1,89 @@
+package sinks
+
+import (
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+	"github.com/mrdbarros/csgo_analyze/database"
+	utils "github.com/mrdbarros/csgo_analyze/utils"
+)
+
+//DatabaseSink inserts the match statistics of finished matches in the database, replacing earlier inserts of the same demo
+type DatabaseSink struct{}
+
+func (ds DatabaseSink) WriteRound(match *composite_handlers.MatchResult, round *composite_handlers.RoundResult) error {
+	return nil
+}
+
+func (ds DatabaseSink) WriteMatch(match *composite_handlers.MatchResult) error {
+	return utils.WithStage(utils.StageDatabase, ds.insertMatch(match))
+}
+
+func (ds DatabaseSink) insertMatch(match *composite_handlers.MatchResult) error {
+	if !match.Finished {
+		return nil
+	}
+	dbConn, err := database.OpenDBConn()
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	metadata := match.Metadata
+	matchID, err := dbConn.InsertMatch(metadata.FileName, metadata.Hash, metadata.Map,
+		metadata.TerroristFirstTeamScore, metadata.CTFirstTeamScore, metadata.MatchDatetime, metadata.HasRestores, true)
+	if err != nil {
+		return err
+	}
+	for _, team := range metadata.Teams {
+		err = dbConn.InsertMatchTeam(matchID, team.ID, team.Name, team.StartingSide, team.Score,
+			team.RoundsT, team.RoundsWonT, team.RoundsCT, team.RoundsWonCT)
+		if err != nil {
+			return err
+		}
+	}
+
+	stored := storedColumns(match.PlayerStatistics)
+	statsIDs, err := dbConn.InsertBaseStatistics(baseStatistics(match.PlayerStatistics, stored))
+	if err != nil {
+		return err
+	}
+	for _, player := range match.PlayerStatistics.Players {
+		err = dbConn.InsertPlayer(player.SteamID, player.Name)
+		if err != nil {
+			return err
+		}
+		values := make([]float64, len(stored))
+		for i, index := range stored {
+			values[i] = player.Values[index]
+		}
+		err = dbConn.InsertStatisticsFacts(statsIDs, values, player.SteamID, matchID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//storedColumns returns the indices of the columns stored in the database. Facts are summed over matches,
+//only summed statistics are stored: ratios and ratings are computed again from the sums of their terms,
+//the mean of a match can not be summed with the means of other matches.
+func storedColumns(stats composite_handlers.PlayerStatistics) []int {
+	var stored []int
+	for i, column := range stats.Columns {
+		if column.Definition.Aggregation == composite_handlers.AggregationSum {
+			stored = append(stored, i)
+		}
+	}
+	return stored
+}
+
+//baseStatistics describes the stored statistic columns as BASE_STATISTIC rows
+func baseStatistics(stats composite_handlers.PlayerStatistics, stored []int) []database.BaseStatistic {
+	rows := make([]database.BaseStatistic, len(stored))
+	for i, index := range stored {
+		column := stats.Columns[index]
+		definition := column.Definition
+		rows[i] = database.BaseStatistic{Name: column.Header, Key: definition.Key, Description: definition.Description,
+			Unit: definition.Unit, Aggregation: string(definition.Aggregation)}
+	}
+	return rows
+}
@@ -0,0 +1,244 @@
+package sinks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+	map_builder "github.com/mrdbarros/csgo_analyze/map_builder"
+	utils "github.com/mrdbarros/csgo_analyze/utils"
+)
+
+//FileSink writes a match as csv files and map images under a directory, one subdirectory per round
+type FileSink struct {
+	rootMatchPath string
+	mapGenerator  *map_builder.MapGenerator //nil when no map images are drawn
+	staged        bool                      //rootMatchPath is renamed after the hash of the match once it is written
+}
+
+//NewFileSink returns a sink writing under rootMatchPath. Map overview images are only loaded when drawIcons is set.
+func NewFileSink(rootMatchPath string, mapMetadata metadata.Map, imgSize int, drawIcons bool) (*FileSink, error) {
+	fs := &FileSink{rootMatchPath: rootMatchPath}
+	if drawIcons {
+		fs.mapGenerator = new(map_builder.MapGenerator)
+		if err := fs.mapGenerator.Setup(mapMetadata, imgSize); err != nil {
+			return nil, err
+		}
+	}
+	return fs, os.MkdirAll(rootMatchPath, 0700)
+}
+
+//NewStagedFileSink returns a sink writing under the directory stagingName of mapPath until the match is written,
+//for demos hashed while they are parsed. The directory is then renamed after the hash of the match,
+//replacing the outputs of an earlier run of the same demo.
+func NewStagedFileSink(mapPath string, stagingName string, mapMetadata metadata.Map, imgSize int, drawIcons bool) (*FileSink, error) {
+	fs, err := NewFileSink(filepath.Join(mapPath, stagingName), mapMetadata, imgSize, drawIcons)
+	if fs != nil {
+		fs.staged = true
+	}
+	return fs, err
+}
+
+//Staged reports whether the sink still writes under its staging directory
+func (fs *FileSink) Staged() bool {
+	return fs.staged
+}
+
+//unstage renames the staging directory of the sink after hash
+func (fs *FileSink) unstage(hash string) error {
+	matchPath := filepath.Join(filepath.Dir(fs.rootMatchPath), hash)
+	if err := os.RemoveAll(matchPath); err != nil {
+		return err
+	}
+	if err := os.Rename(fs.rootMatchPath, matchPath); err != nil {
+		return err
+	}
+	fs.rootMatchPath, fs.staged = matchPath, false
+	return nil
+}
+
+//WriteRound writes the round directory, replacing older outputs of the same round
+func (fs *FileSink) WriteRound(match *composite_handlers.MatchResult, round *composite_handlers.RoundResult) error {
+	roundDirPath, err := fs.createRoundDir(round)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(roundDirPath+"/winner.txt", []byte(round.Winner), 0600)
+	if err != nil {
+		return err
+	}
+
+	if fs.mapGenerator != nil {
+		err = map_builder.GenerateRoundMaps(*fs.mapGenerator, round.Icons, roundDirPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	periodicData := append([][]string{round.PeriodicHeaders}, utils.FloatMatrixToString(round.PeriodicFrames)...)
+	generalStatistics := [][]string{round.StatisticHeaders, utils.FloatSliceToString(round.Statistics)}
+	for csvPath, csvData := range map[string][][]string{roundDirPath + "/periodic_data.csv": periodicData,
+		roundDirPath + "/statistics.csv": generalStatistics, roundDirPath + "/player_statistics.csv": roundPlayerRows(round.PlayerStatistics, round.TeamSize),
+		roundDirPath + "/sides.csv": roundSideRows(match, round), roundDirPath + "/roster.csv": roundRosterRows(round)} {
+		if err = utils.WriteToCSV(csvData, csvPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *FileSink) createRoundDir(round *composite_handlers.RoundResult) (string, error) {
+	roundDirPath := fs.rootMatchPath + "/" + round.Score
+	dirExists, _ := utils.Exists(roundDirPath)
+	if dirExists {
+		return roundDirPath, utils.RemoveContents(roundDirPath)
+	}
+
+	//a round rollback leaves a directory with the same round number but another score
+	matches, err := filepath.Glob(fs.rootMatchPath + "/" + utils.PadLeft(strconv.Itoa(round.Number), "0", 2) + "*")
+	if err != nil {
+		return "", err
+	}
+	for _, oldDir := range matches {
+		if err = os.RemoveAll(oldDir); err != nil {
+			return "", err
+		}
+	}
+	return roundDirPath, os.MkdirAll(roundDirPath, 0700)
+}
+
+//writeAudit moves the rounds discarded by rollbacks under audit/rollback_<index>, with a list of the rollbacks.
+//The directory of a discarded round is only kept in place when a round played again replaced it.
+func (fs *FileSink) writeAudit(match *composite_handlers.MatchResult) error {
+	auditPath := fs.rootMatchPath + "/audit"
+	if err := os.RemoveAll(auditPath); err != nil || len(match.Metadata.Rollbacks) == 0 {
+		return err
+	}
+	if err := utils.WriteToCSV(rollbackRows(match.Metadata.Rollbacks), fs.rootMatchPath+"/rollbacks.csv"); err != nil {
+		return err
+	}
+
+	keptScores := make(map[string]bool)
+	for _, round := range match.Rounds {
+		keptScores[round.Score] = true
+	}
+	for i := range match.DiscardedRounds {
+		discarded := &match.DiscardedRounds[i]
+		if !keptScores[discarded.Round.Score] {
+			if err := os.RemoveAll(fs.rootMatchPath + "/" + discarded.Round.Score); err != nil {
+				return err
+			}
+		}
+		auditSink := &FileSink{rootMatchPath: auditPath + "/rollback_" + strconv.Itoa(discarded.Rollback),
+			mapGenerator: fs.mapGenerator}
+		if err := os.MkdirAll(auditSink.rootMatchPath, 0700); err != nil {
+			return err
+		}
+		if err := auditSink.WriteRound(match, &discarded.Round); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//rollbackRows lays out the rollbacks of the match with the ticks involved
+func rollbackRows(rollbacks []composite_handlers.Rollback) [][]string {
+	data := [][]string{{"Rollback", "Kind", "Tick", "FromRound", "ToRound", "DiscardedFromTick", "DiscardedRounds"}}
+	for i, rollback := range rollbacks {
+		discardedRounds := make([]string, len(rollback.DiscardedRounds))
+		for j, round := range rollback.DiscardedRounds {
+			discardedRounds[j] = strconv.Itoa(round)
+		}
+		data = append(data, []string{strconv.Itoa(i), rollback.Kind, strconv.Itoa(rollback.Tick),
+			strconv.Itoa(rollback.FromRound), strconv.Itoa(rollback.ToRound), strconv.Itoa(rollback.DiscardedFromTick),
+			strings.Join(discardedRounds, " ")})
+	}
+	return data
+}
+
+//roundPlayerRows lays out round statistics with one row per player slot, leaving empty slots blank
+func roundPlayerRows(stats composite_handlers.PlayerStatistics, teamSize int) [][]string {
+	if teamSize == 0 {
+		teamSize = composite_handlers.DefaultTeamSize
+	}
+	framedData := make([][]string, 2*teamSize)
+	for _, player := range stats.Players {
+		for player.Slot >= len(framedData) {
+			framedData = append(framedData, nil)
+		}
+		framedData[player.Slot] = append([]string{player.Name}, utils.FloatSliceToString(player.Values)...)
+	}
+	return append([][]string{append([]string{"Name"}, stats.Headers...)}, framedData...)
+}
+
+//roundSideRows lays out the team playing each side of the round
+func roundSideRows(match *composite_handlers.MatchResult, round *composite_handlers.RoundResult) [][]string {
+	teamNames := make(map[string]string)
+	for _, team := range match.Metadata.Teams {
+		teamNames[team.ID] = team.Name
+	}
+	return [][]string{{"Side", "Team", "Name"}, {"t", round.TTeam, teamNames[round.TTeam]},
+		{"ct", round.CTTeam, teamNames[round.CTTeam]}}
+}
+
+//roundRosterRows lays out the slots of the round and the players holding them
+func roundRosterRows(round *composite_handlers.RoundResult) [][]string {
+	data := [][]string{{"Slot", "Team", "SteamID", "Name", "Present"}}
+	for _, slot := range round.Roster {
+		data = append(data, []string{strconv.Itoa(slot.Slot), slot.Team, strconv.FormatUint(slot.SteamID, 10), slot.Name,
+			strconv.FormatBool(slot.Present)})
+	}
+	return data
+}
+
+//matchTeamRows lays out the teams of the match with their results on each side
+func matchTeamRows(match *composite_handlers.MatchResult) [][]string {
+	data := [][]string{{"Team", "Name", "StartingSide", "Score", "RoundsT", "RoundsWonT", "RoundsCT", "RoundsWonCT"}}
+	for _, team := range match.Metadata.Teams {
+		data = append(data, []string{team.ID, team.Name, team.StartingSide, strconv.Itoa(team.Score),
+			strconv.Itoa(team.RoundsT), strconv.Itoa(team.RoundsWonT), strconv.Itoa(team.RoundsCT), strconv.Itoa(team.RoundsWonCT)})
+	}
+	return data
+}
+
+//Discard removes everything written by the sink
+func (fs *FileSink) Discard() error {
+	return os.RemoveAll(fs.rootMatchPath)
+}
+
+//WriteMatch writes the match metadata, its teams, the audit of its rollbacks and, for finished matches, the match statistics
+func (fs *FileSink) WriteMatch(match *composite_handlers.MatchResult) error {
+	if fs.staged {
+		if err := fs.unstage(match.Metadata.Hash); err != nil {
+			return err
+		}
+	}
+	if err := fs.writeAudit(match); err != nil {
+		return err
+	}
+	metadataJSON, err := json.MarshalIndent(match.Metadata, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(fs.rootMatchPath+"/match_metadata.json", metadataJSON, 0644)
+	if err != nil {
+		return err
+	}
+	err = utils.WriteToCSV(matchTeamRows(match), fs.rootMatchPath+"/teams.csv")
+	if err != nil || !match.Finished {
+		return err
+	}
+
+	data := [][]string{append([]string{"Name", "SteamID"}, match.PlayerStatistics.Headers...)}
+	for _, player := range match.PlayerStatistics.Players {
+		data = append(data, append([]string{player.Name, strconv.FormatUint(player.SteamID, 10)},
+			utils.FloatSliceToString(player.Values)...))
+	}
+	return utils.WriteToCSV(data, fs.rootMatchPath+"/match_statistics.csv")
+}
@@ -0,0 +1,90 @@
+package sinks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+	"github.com/mrdbarros/csgo_analyze/composite_handlers"
+)
+
+func TestFileSinkReplacesRolledBackRounds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file_sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink, err := NewFileSink(filepath.Join(dir, "match"), metadata.Map{}, 800, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := &composite_handlers.MatchResult{}
+	round := composite_handlers.RoundResult{Number: 2, Score: "02_ct_01_t_00", Winner: "t",
+		PeriodicHeaders: []string{"round_time"}, PeriodicFrames: [][]float64{{1}, {3}},
+		PlayerStatistics: composite_handlers.PlayerStatistics{Headers: []string{"kills"},
+			Players: []composite_handlers.PlayerStatisticsRow{{Name: "b", Slot: 3, Values: []float64{2}}}}}
+	if err = sink.WriteRound(match, &round); err != nil {
+		t.Fatal(err)
+	}
+
+	//the round is played again after a rollback, with another score
+	round.Score = "02_ct_00_t_01"
+	if err = sink.WriteRound(match, &round); err != nil {
+		t.Fatal(err)
+	}
+	roundDirs, _ := filepath.Glob(filepath.Join(dir, "match", "02*"))
+	if len(roundDirs) != 1 || filepath.Base(roundDirs[0]) != round.Score {
+		t.Fatalf("expected only the replayed round directory, got %v", roundDirs)
+	}
+
+	playerStats, err := ioutil.ReadFile(filepath.Join(roundDirs[0], "player_statistics.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(playerStats), "\n")
+	if len(lines) != 12 || lines[0] != "Name,kills" || lines[4] != "b,2" {
+		t.Errorf("player statistics should have one row per slot, got %q", lines)
+	}
+
+	if err = sink.WriteMatch(match); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "match", "match_statistics.csv")); !os.IsNotExist(err) {
+		t.Error("match statistics should only be written for finished matches")
+	}
+}
+
+func TestStagedFileSinkMovesToTheMatchHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file_sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//outputs of an earlier run of the demo are replaced
+	if err = os.MkdirAll(filepath.Join(dir, "abc", "01_ct_00_t_01"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := NewStagedFileSink(dir, ".parsing_demo", metadata.Map{}, 800, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := &composite_handlers.MatchResult{Metadata: composite_handlers.MatchMetadata{Hash: "abc"}}
+	round := composite_handlers.RoundResult{Number: 1, Score: "01_ct_01_t_00", Winner: "ct"}
+	if err = sink.WriteRound(match, &round); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.WriteMatch(match); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := filepath.Glob(filepath.Join(dir, "*"))
+	roundDirs, _ := filepath.Glob(filepath.Join(dir, "abc", "01*"))
+	if sink.Staged() || len(entries) != 1 || len(roundDirs) != 1 || filepath.Base(roundDirs[0]) != round.Score {
+		t.Errorf("the staging directory should replace the outputs under the hash, got %v and rounds %v", entries, roundDirs)
+	}
+}
@@ -1,16 +1,70 @@
 package utils
 
 import (
+	"math"
+
 	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+//sources of the tick rate of a demo, from the most to the least reliable
+const (
+	TickRateOverride   = "override"    //set by the user
+	TickRateServerInfo = "server_info" //tick interval of the server info net message
+	TickRateHeader     = "header"      //playback ticks over playback time of the demo header
+	TickRateFrameRate  = "frame_rate"  //recorded frames over playback time, only a lower bound of the tick rate
+	TickRateDefault    = "default"     //nothing usable in the demo
 )
 
-func GetRoundTime(p dem.Parser, roundStartTime float64, tickRate int) float64 {
+const DefaultTickRate = 64.0
+
+//tick rates servers run on, header estimates are snapped to them
+var standardTickRates = []float64{16, 32, 64, 128}
+
+func GetRoundTime(p dem.Parser, roundStartTime float64, tickRate float64) float64 {
 	return GetCurrentTime(p, tickRate) - roundStartTime
 }
 
-func GetCurrentTime(p dem.Parser, tickRate int) float64 {
-	// currentFrame := p.CurrentFrame()
-	currentTime := p.CurrentTime()
+//GetCurrentTime returns the server time of the current tick in seconds. It counts from the load of the map,
+//not from the start of the demo, timings only use differences of it.
+//A tickRate of 0 uses the time of the parser, known once the server info gave it the tick interval.
+//Other tick rates, overrides or estimates for demos without server info, convert the ticks themselves.
+func GetCurrentTime(p dem.Parser, tickRate float64) float64 {
+	gs := p.GameState()
+	if gs == nil || tickRate <= 0 {
+		return p.CurrentTime().Seconds()
+	}
+	return float64(gs.IngameTick()) / tickRate
+}
+
+//TickRateFromInterval converts the tick interval of the server info message to a tick rate
+func TickRateFromInterval(tickInterval float32) float64 {
+	if tickInterval <= 0 {
+		return 0
+	}
+	//tick intervals are sent as float32, round away their error
+	return math.Round(100/float64(tickInterval)) / 100
+}
+
+//HeaderTickRate estimates the tick rate from the demo header, falling back to its frame rate when the tick count is broken
+func HeaderTickRate(header common.DemoHeader) (float64, string) {
+	if header.PlaybackTime > 0 {
+		if tickRate, ok := snapTickRate(float64(header.PlaybackTicks) / header.PlaybackTime.Seconds()); ok {
+			return tickRate, TickRateHeader
+		}
+		if frameRate, ok := snapTickRate(header.FrameRate()); ok {
+			return frameRate, TickRateFrameRate
+		}
+	}
+	return DefaultTickRate, TickRateDefault
+}
 
-	return currentTime.Seconds()
+//snapTickRate returns the standard tick rate within 10% of rate
+func snapTickRate(rate float64) (float64, bool) {
+	for _, standardRate := range standardTickRates {
+		if math.Abs(rate-standardRate) <= standardRate*0.1 {
+			return standardRate, true
+		}
+	}
+	return 0, false
 }
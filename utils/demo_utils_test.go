@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+func TestHeaderTickRate(t *testing.T) {
+	cases := []struct {
+		header     common.DemoHeader
+		tickRate   float64
+		tickSource string
+	}{
+		{common.DemoHeader{PlaybackTime: 100 * time.Second, PlaybackTicks: 12810, PlaybackFrames: 6400}, 128, TickRateHeader},
+		{common.DemoHeader{PlaybackTime: 100 * time.Second, PlaybackTicks: 6390, PlaybackFrames: 3200}, 64, TickRateHeader},
+		{common.DemoHeader{PlaybackTime: 100 * time.Second, PlaybackTicks: 0, PlaybackFrames: 6400}, 64, TickRateFrameRate},
+		{common.DemoHeader{}, DefaultTickRate, TickRateDefault},
+	}
+	for _, c := range cases {
+		tickRate, source := HeaderTickRate(c.header)
+		if tickRate != c.tickRate || source != c.tickSource {
+			t.Errorf("HeaderTickRate(%+v) = %v, %s; want %v, %s", c.header, tickRate, source, c.tickRate, c.tickSource)
+		}
+	}
+	if tickRate := TickRateFromInterval(0.015625); tickRate != 64 {
+		t.Errorf("TickRateFromInterval(0.015625) = %v", tickRate)
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import "fmt"
+
+//stages of demo processing reported alongside errors
+const (
+	StageOpen       = "open"
+	StageHash       = "hash"
+	StageHeader     = "header"
+	StageDatabase   = "database"
+	StageSetup      = "setup"
+	StageParse      = "parse"
+	StageGeneration = "generation"
+	StageOutput     = "output"
+)
+
+//StageError is an error tagged with the processing stage where it happened
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+//WithStage tags err with stage. Errors that already carry a stage keep it.
+func WithStage(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*StageError); ok {
+		return err
+	}
+	return &StageError{Stage: stage, Err: err}
+}
+
+//RecoveredError converts a value recovered from a panic into an error
+func RecoveredError(r interface{}) error {
+	if err, ok := r.(error); ok {
+		return fmt.Errorf("panic: %w", err)
+	}
+	return fmt.Errorf("panic: %v", r)
+}
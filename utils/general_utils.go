@@ -145,12 +145,14 @@ func RemoveContents(dir string) error {
 	return nil
 }
 
-func WriteToCSV(data [][]string, filePath string) {
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-	CheckError(err)
+//WriteToCSV writes data to a new csv file, replacing any file at filePath
+func WriteToCSV(data [][]string, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 	writer := csv.NewWriter(file)
 
-	err = writer.WriteAll(data)
-	CheckError(err)
-	defer file.Close()
+	return writer.WriteAll(data)
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mrdbarros/csgo_analyze/demo_source"
+	"github.com/mrdbarros/csgo_analyze/journal"
+)
+
+//watchedFile is a demo file found by the watcher
+type watchedFile struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	StableSince time.Time `json:"stableSince"` //first poll that found the current size and modification time
+	queued      bool      //the demos of the file were sent to the workers
+}
+
+//queueState is the state of the demos of a watch, served as json
+type queueState struct {
+	Settling []watchedFile   `json:"settling"` //files still being written
+	Queued   []journal.Entry `json:"queued"`
+	Running  []journal.Entry `json:"running"`
+}
+
+//watcher polls directories for demo files and queues them in the workers of a batch once they stopped changing
+type watcher struct {
+	run        *batchRun
+	dirs       []string
+	settleTime time.Duration //time the size of a file must stay the same before it is queued
+
+	nextFileID int //only used by scan, which the watch loop does not run concurrently
+
+	mutex sync.Mutex
+	files map[string]*watchedFile //keyed by path
+}
+
+func newWatcher(run *batchRun, dirs []string, settleTime time.Duration) *watcher {
+	return &watcher{run: run, dirs: dirs, settleTime: settleTime, files: make(map[string]*watchedFile)}
+}
+
+//watch polls the directories every pollInterval and processes the new demos with workerCount workers until ctx is done.
+//Demos waiting in the queue when it stops stay queued in the journal and are processed on the next start.
+func (w *watcher) watch(ctx context.Context, workerCount int, pollInterval time.Duration) {
+	jobChan := make(chan demoFile, 500)
+	wg := w.run.startWorkers(workerCount, jobChan)
+	defer wg.Wait()
+	defer close(jobChan)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for _, job := range w.scan(time.Now()) {
+			w.run.opts.Progress.DemoQueued(job.demo.ID(), job.demo.Size)
+			select {
+			case jobChan <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//scan walks the watched directories and returns the demos of the files whose size and modification time
+//did not change for the settle time. Files are only queued again after they change.
+//The directories are walked and archives listed without the mutex, so that serving the queue state does not wait for them.
+func (w *watcher) scan(now time.Time) []demoFile {
+	found := make(map[string]os.FileInfo)
+	for _, dir := range w.dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				//the directory may not exist yet or a file may be removed while walking, try again on the next poll
+				w.run.opts.Progress.Warning(path, "watch: skipping: "+err.Error())
+				return nil
+			}
+			if !info.IsDir() && demo_source.IsDemoFile(info.Name()) {
+				found[path] = info
+			}
+			return nil
+		})
+	}
+
+	var jobs []demoFile
+	for _, path := range w.settledFiles(found, now) {
+		info := found[path]
+		demos, err := demo_source.List(path)
+		if err != nil {
+			w.run.opts.Progress.Warning(path, "watch: skipping unreadable archive until it changes: "+err.Error())
+			continue
+		}
+		for _, demo := range demos {
+			if entry, ok := w.run.needsProcessing(demo, info); ok {
+				jobs = append(jobs, demoFile{demo: demo, fileID: w.nextFileID, entry: entry})
+				w.nextFileID++
+			}
+		}
+	}
+	return jobs
+}
+
+//settledFiles merges the files found by a scan into the state of the watcher and returns, sorted,
+//the paths of the files settled since the last scan, marked as queued
+func (w *watcher) settledFiles(found map[string]os.FileInfo, now time.Time) []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var settled []string
+	for path, info := range found {
+		file, ok := w.files[path]
+		if !ok || file.Size != info.Size() || !file.ModTime.Equal(info.ModTime()) {
+			w.files[path] = &watchedFile{Path: path, Size: info.Size(), ModTime: info.ModTime(), StableSince: now}
+			continue
+		}
+		if file.queued || now.Sub(file.StableSince) < w.settleTime {
+			continue
+		}
+		file.queued = true
+		settled = append(settled, path)
+	}
+	for path := range w.files {
+		if _, ok := found[path]; !ok {
+			delete(w.files, path)
+		}
+	}
+	sort.Strings(settled)
+	return settled
+}
+
+//queueState returns the files still settling and the queued and running demos of the journal
+func (w *watcher) queueState() queueState {
+	state := queueState{Settling: []watchedFile{}, Queued: []journal.Entry{}, Running: []journal.Entry{}}
+	w.mutex.Lock()
+	for _, file := range w.files {
+		if !file.queued {
+			state.Settling = append(state.Settling, *file)
+		}
+	}
+	w.mutex.Unlock()
+	sort.Slice(state.Settling, func(a, b int) bool { return state.Settling[a].Path < state.Settling[b].Path })
+
+	if w.run.journal != nil {
+		for _, entry := range w.run.journal.Entries() {
+			switch entry.Status {
+			case journal.StatusQueued:
+				state.Queued = append(state.Queued, entry)
+			case journal.StatusRunning:
+				state.Running = append(state.Running, entry)
+			}
+		}
+	}
+	return state
+}
+
+//ServeHTTP serves the queue state as json
+func (w *watcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(rw)
+	encoder.SetIndent("", "\t")
+	encoder.Encode(w.queueState())
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherQueuesSettledFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	demPath := filepath.Join(dir, "a.dem")
+	if err = ioutil.WriteFile(demPath, []byte("HL2DEMO"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := newWatcher(&batchRun{ctx: context.Background(), maxAttempts: 1}, []string{dir, filepath.Join(dir, "missing")}, time.Minute)
+
+	start := time.Now()
+	if jobs := w.scan(start); len(jobs) != 0 {
+		t.Fatalf("a file seen for the first time should settle first, got %d jobs", len(jobs))
+	}
+	if state := w.queueState(); len(state.Settling) != 1 || state.Settling[0].Path != demPath {
+		t.Errorf("expected the file to be settling, got %+v", state)
+	}
+
+	//the download is still being written
+	if err = ioutil.WriteFile(demPath, []byte("HL2DEMO and more"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := w.scan(start.Add(2 * time.Minute)); len(jobs) != 0 {
+		t.Fatalf("a file that changed should settle again, got %d jobs", len(jobs))
+	}
+
+	jobs := w.scan(start.Add(4 * time.Minute))
+	if len(jobs) != 1 || jobs[0].demo.ID() != demPath {
+		t.Fatalf("expected the settled demo to be queued, got %+v", jobs)
+	}
+	if jobs = w.scan(start.Add(6 * time.Minute)); len(jobs) != 0 {
+		t.Errorf("a queued file should not be queued again, got %d jobs", len(jobs))
+	}
+	if state := w.queueState(); len(state.Settling) != 0 {
+		t.Errorf("queued files are no longer settling, got %+v", state.Settling)
+	}
+}